@@ -0,0 +1,415 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio/internal/logger"
+	iampolicy "github.com/minio/pkg/iam/policy"
+)
+
+var (
+	// error returned when the disk cache is not configured
+	errCacheDisabled = AdminError{
+		Code:       "XMinioAdminCacheDisabled",
+		Message:    "Disk cache is not configured",
+		StatusCode: http.StatusNotImplemented,
+	}
+	// error returned when unpinning a prefix not pinned
+	errCachePinNotFound = AdminError{
+		Code:       "XMinioAdminCachePinNotFound",
+		Message:    "Prefix is not pinned in the disk cache",
+		StatusCode: http.StatusNotFound,
+	}
+	// error returned when canceling a pre-warm never started
+	errCachePrewarmNotFound = AdminError{
+		Code:       "XMinioAdminCachePrewarmNotFound",
+		Message:    "No pre-warm of the disk cache was started for this prefix",
+		StatusCode: http.StatusNotFound,
+	}
+	// error returned when the disk cache does not commit in writeback mode
+	errCacheWriteBackDisabled = AdminError{
+		Code:       "XMinioAdminCacheWriteBackDisabled",
+		Message:    "Disk cache is not configured with MINIO_CACHE_COMMIT=writeback",
+		StatusCode: http.StatusNotImplemented,
+	}
+	// error returned when objects are left uncommitted after all their attempts
+	errCacheWriteBackFailed = AdminError{
+		Code:       "XMinioAdminCacheWriteBackFailed",
+		Message:    "Objects failed to be committed to the backend",
+		StatusCode: http.StatusConflict,
+	}
+	// error returned when the cache is not committed in the requested time
+	errCacheWriteBackTimeout = AdminError{
+		Code:       "XMinioAdminCacheWriteBackTimeout",
+		Message:    "Disk cache was not committed to the backend in time",
+		StatusCode: http.StatusGatewayTimeout,
+	}
+)
+
+// cacheWriteBackInfo is the response of the write back admin APIs.
+type cacheWriteBackInfo struct {
+	Pending int                   `json:"pending"`
+	Failed  int                   `json:"failed"`
+	Queued  int                   `json:"queued,omitempty"`
+	Objects []WriteBackObjectInfo `json:"objects,omitempty"`
+}
+
+// cacheWriteBackLayer returns the disk cache once validateAdminReq passed.
+func cacheWriteBackLayer(ctx context.Context, w http.ResponseWriter, r *http.Request) CacheObjectLayer {
+	cacheAPI := newCachedObjectLayerFn()
+	if cacheAPI == nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, errCacheWriteBackDisabled), r.URL)
+	}
+	return cacheAPI
+}
+
+// cacheLayer returns the disk cache once validateAdminReq passed.
+func cacheLayer(ctx context.Context, w http.ResponseWriter, r *http.Request) CacheObjectLayer {
+	cacheAPI := newCachedObjectLayerFn()
+	if cacheAPI == nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, errCacheDisabled), r.URL)
+	}
+	return cacheAPI
+}
+
+// writeCacheWriteBackInfo replies with the number of objects of bucket/prefix
+// not committed to the backend, and when list is set with the objects of
+// status, or all of them if it is empty.
+func writeCacheWriteBackInfo(ctx context.Context, w http.ResponseWriter, r *http.Request, cacheAPI CacheObjectLayer, info cacheWriteBackInfo, list bool, status string) {
+	objects, err := cacheAPI.WriteBackObjects(r.Form.Get("bucket"), r.Form.Get("prefix"))
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	for _, oi := range objects {
+		if oi.Status == WriteBackFailed {
+			info.Failed++
+		} else {
+			info.Pending++
+		}
+		if list && (status == "" || oi.Status == status) {
+			info.Objects = append(info.Objects, oi)
+		}
+	}
+	writeCacheJSON(ctx, w, r, info)
+}
+
+// CacheWriteBackStatusHandler - GET /minio/admin/v3/cache/writeback?bucket={bucket}&prefix={prefix}&status={status}
+// ----------
+// Lists the objects of the disk cache not committed to the backend yet, with
+// their retry count and last error. status is either pending or failed.
+func (a adminAPIHandlers) CacheWriteBackStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CacheWriteBackStatus")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ServerInfoAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheWriteBackLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	status := r.Form.Get("status")
+	if status != "" && status != WriteBackPending && status != WriteBackFailed {
+		writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(ErrInvalidRequest), r.URL)
+		return
+	}
+	writeCacheWriteBackInfo(ctx, w, r, cacheAPI, cacheWriteBackInfo{}, true, status)
+}
+
+// CacheWriteBackFlushHandler - POST /minio/admin/v3/cache/writeback/flush?bucket={bucket}&prefix={prefix}
+// ----------
+// Uploads the objects of the disk cache under bucket/prefix to the backend at
+// once, failed objects are given all their attempts again. Without a bucket
+// the whole cache is flushed.
+func (a adminAPIHandlers) CacheWriteBackFlushHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CacheWriteBackFlush")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheWriteBackLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	queued, err := cacheAPI.FlushWriteBack(r.Form.Get("bucket"), r.Form.Get("prefix"))
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheWriteBackInfo(ctx, w, r, cacheAPI, cacheWriteBackInfo{Queued: queued}, false, "")
+}
+
+// CacheWriteBackWaitHandler - POST /minio/admin/v3/cache/writeback/wait?bucket={bucket}&prefix={prefix}&timeout={timeout}
+// ----------
+// Flushes the objects of the disk cache under bucket/prefix and blocks until
+// they are committed to the backend, for instance before a shutdown or a
+// drive swap. It fails if objects are left failed, or are still pending
+// after the optional timeout, a duration such as 10m.
+func (a adminAPIHandlers) CacheWriteBackWaitHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CacheWriteBackWait")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheWriteBackLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	waitCtx := ctx
+	if v := r.Form.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(ErrInvalidRequest), r.URL)
+			return
+		}
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := cacheAPI.WaitWriteBack(waitCtx, r.Form.Get("bucket"), r.Form.Get("prefix"))
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errCacheWriteBackTimeout
+	}
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheWriteBackInfo(ctx, w, r, cacheAPI, cacheWriteBackInfo{}, true, "")
+}
+
+// writeCacheJSON replies with v encoded in JSON.
+func writeCacheJSON(ctx context.Context, w http.ResponseWriter, r *http.Request, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeSuccessResponseJSON(w, data)
+}
+
+// cacheBucketLayer returns the disk cache once validateAdminReq passed and
+// the bucket of the request exists.
+func cacheBucketLayer(ctx context.Context, w http.ResponseWriter, r *http.Request, objectAPI ObjectLayer) CacheObjectLayer {
+	bucket := r.Form.Get("bucket")
+	if bucket == "" {
+		writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(ErrInvalidBucketName), r.URL)
+		return nil
+	}
+	if _, err := objectAPI.GetBucketInfo(ctx, bucket); err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return nil
+	}
+	return cacheLayer(ctx, w, r)
+}
+
+// CachePrewarmHandler - POST /minio/admin/v3/cache/prewarm?bucket={bucket}&prefix={prefix}&pin={bool}
+// ----------
+// Fetches the objects of bucket/prefix from the backend into the disk cache
+// in the background, regardless of MINIO_CACHE_AFTER. With pin set the prefix
+// is pinned first, so the objects fetched are never evicted.
+func (a adminAPIHandlers) CachePrewarmHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CachePrewarm")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheBucketLayer(ctx, w, r, objectAPI)
+	if cacheAPI == nil {
+		return
+	}
+
+	bucket, prefix := r.Form.Get("bucket"), r.Form.Get("prefix")
+	if r.Form.Get("pin") == "true" {
+		if err := cacheAPI.PinCache(bucket, prefix); err != nil {
+			writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+			return
+		}
+	}
+	writeCacheJSON(ctx, w, r, cacheAPI.PrewarmCache(bucket, prefix))
+}
+
+// CachePrewarmStatusHandler - GET /minio/admin/v3/cache/prewarm?bucket={bucket}&prefix={prefix}
+// ----------
+// Lists the progress of the pre-warms of bucket/prefix started since the
+// server started, without a bucket all of them are listed.
+func (a adminAPIHandlers) CachePrewarmStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CachePrewarmStatus")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ServerInfoAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	writeCacheJSON(ctx, w, r, cacheAPI.CachePrewarms(r.Form.Get("bucket"), r.Form.Get("prefix")))
+}
+
+// CachePrewarmCancelHandler - DELETE /minio/admin/v3/cache/prewarm?bucket={bucket}&prefix={prefix}
+// ----------
+// Stops the pre-warm of bucket/prefix, the objects already fetched stay in
+// the disk cache.
+func (a adminAPIHandlers) CachePrewarmCancelHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CachePrewarmCancel")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	info, err := cacheAPI.CancelPrewarm(r.Form.Get("bucket"), r.Form.Get("prefix"))
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheJSON(ctx, w, r, info)
+}
+
+// CachePinListHandler - GET /minio/admin/v3/cache/pin
+// ----------
+// Lists the prefixes pinned in the disk cache.
+func (a adminAPIHandlers) CachePinListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CachePinList")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ServerInfoAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	writeCacheJSON(ctx, w, r, cacheAPI.CachePins())
+}
+
+// CachePinHandler - POST /minio/admin/v3/cache/pin?bucket={bucket}&prefix={prefix}
+// ----------
+// Pins the objects of bucket/prefix, an object is pinned with its name as
+// prefix. Pinned objects are never evicted from the disk cache, but are still
+// removed once stale.
+func (a adminAPIHandlers) CachePinHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CachePin")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheBucketLayer(ctx, w, r, objectAPI)
+	if cacheAPI == nil {
+		return
+	}
+
+	if err := cacheAPI.PinCache(r.Form.Get("bucket"), r.Form.Get("prefix")); err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheJSON(ctx, w, r, cacheAPI.CachePins())
+}
+
+// CacheUnpinHandler - DELETE /minio/admin/v3/cache/pin?bucket={bucket}&prefix={prefix}
+// ----------
+// Removes a pin, the objects of bucket/prefix are evicted like the others
+// again unless another pin covers them.
+func (a adminAPIHandlers) CacheUnpinHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CacheUnpin")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ConfigUpdateAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	if err := cacheAPI.UnpinCache(r.Form.Get("bucket"), r.Form.Get("prefix")); err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheJSON(ctx, w, r, cacheAPI.CachePins())
+}
+
+// CacheResidencyHandler - GET /minio/admin/v3/cache/residency?bucket={bucket}&prefix={prefix}&delimiter={delimiter}
+// ----------
+// Reports the objects of bucket/prefix held by the disk cache, their size and
+// number of accesses, grouped by the prefixes ending at the next delimiter,
+// "/" unless given. Without a bucket the objects are grouped by bucket.
+func (a adminAPIHandlers) CacheResidencyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "CacheResidency")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.ServerInfoAdminAction)
+	if objectAPI == nil {
+		return
+	}
+	cacheAPI := cacheLayer(ctx, w, r)
+	if cacheAPI == nil {
+		return
+	}
+
+	delimiter := SlashSeparator
+	if _, ok := r.Form["delimiter"]; ok {
+		delimiter = r.Form.Get("delimiter")
+	}
+	residency, err := cacheAPI.CacheResidency(ctx, r.Form.Get("bucket"), r.Form.Get("prefix"), delimiter)
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeCacheJSON(ctx, w, r, residency)
+}
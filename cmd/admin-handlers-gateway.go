@@ -0,0 +1,116 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio/internal/handlers"
+	"github.com/minio/minio/internal/logger"
+	iampolicy "github.com/minio/pkg/iam/policy"
+)
+
+// GatewayAdminHandler - GET|POST|DELETE /minio/admin/v3/gateway/{op}
+// ----------
+// Runs an admin operation of the gateway backend, see GatewayAdmin.
+func (a adminAPIHandlers) GatewayAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "GatewayAdmin")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	op := mux.Vars(r)["op"]
+	gw, ok := unwrapGatewayLayer(newObjectLayerFn()).(GatewayAdmin)
+	action := iampolicy.AdminAction(iampolicy.ServerInfoAdminAction)
+	if r.Method != http.MethodGet || (ok && gw.GatewayAdminSensitive(op)) {
+		action = iampolicy.ConfigUpdateAdminAction
+	}
+	objectAPI, _ := validateAdminReq(ctx, w, r, action)
+	if objectAPI == nil {
+		return
+	}
+	if !ok {
+		writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(ErrNotImplemented), r.URL)
+		return
+	}
+
+	resp, err := gw.GatewayAdmin(ctx, op, r)
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeSuccessResponseJSON(w, data)
+}
+
+// GatewayHealHandler - POST /minio/admin/v3/heal/{bucket}/{prefix}
+// ----------
+// Starts, stops and reports the repair of the gateway backend with the
+// requests and responses of HealHandler, see GatewayHealer.
+func (a adminAPIHandlers) GatewayHealHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, "GatewayHeal")
+
+	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
+
+	objectAPI, _ := validateAdminReq(ctx, w, r, iampolicy.HealAdminAction)
+	if objectAPI == nil {
+		return
+	}
+
+	gh, ok := unwrapGatewayLayer(objectAPI).(GatewayHealer)
+	if !ok {
+		writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(ErrHealNotImplemented), r.URL)
+		return
+	}
+
+	hip, errCode := extractHealInitParams(mux.Vars(r), r.Form, r.Body)
+	if errCode != ErrNone {
+		writeErrorResponseJSON(ctx, w, errorCodes.ToAPIErr(errCode), r.URL)
+		return
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+	switch {
+	case hip.clientToken != "":
+		resp, err = gh.HealStatus(ctx, hip.clientToken)
+	case hip.forceStop:
+		resp, err = gh.StopHeal(ctx, hip.bucket, hip.objPrefix)
+	default:
+		resp, err = gh.StartHeal(ctx, hip.bucket, hip.objPrefix, hip.hs, hip.forceStart, handlers.GetSourceIP(r))
+	}
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeErrorResponseJSON(ctx, w, toAdminAPIErr(ctx, err), r.URL)
+		return
+	}
+	writeSuccessResponseJSON(w, data)
+}
@@ -89,8 +89,9 @@ func registerAdminRouter(router *mux.Router, enableConfigOps bool) {
 			Queries("profilerType", "{profilerType:.*}")
 		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/profiling/download").HandlerFunc(gz(httpTraceAll(adminAPI.DownloadProfilingHandler)))
 
-		// Config KV operations.
-		if enableConfigOps {
+		// Config KV operations, gateways keeping their config on the
+		// backend only serve these.
+		if enableConfigOps || gatewayKeepsConfig() {
 			adminRouter.Methods(http.MethodGet).Path(adminVersion+"/get-config-kv").HandlerFunc(gz(httpTraceHdrs(adminAPI.GetConfigKVHandler))).Queries("key", "{key:.*}")
 			adminRouter.Methods(http.MethodPut).Path(adminVersion + "/set-config-kv").HandlerFunc(gz(httpTraceHdrs(adminAPI.SetConfigKVHandler)))
 			adminRouter.Methods(http.MethodDelete).Path(adminVersion + "/del-config-kv").HandlerFunc(gz(httpTraceHdrs(adminAPI.DelConfigKVHandler)))
@@ -231,6 +232,31 @@ func registerAdminRouter(router *mux.Router, enableConfigOps bool) {
 		adminRouter.Methods(http.MethodPost).Path(adminVersion+"/kms/key/create").HandlerFunc(gz(httpTraceAll(adminAPI.KMSCreateKeyHandler))).Queries("key-id", "{key-id:.*}")
 		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/kms/key/status").HandlerFunc(gz(httpTraceAll(adminAPI.KMSKeyStatusHandler)))
 
+		// -- Disk cache write back APIs --
+		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/cache/writeback").HandlerFunc(gz(httpTraceAll(adminAPI.CacheWriteBackStatusHandler)))
+		adminRouter.Methods(http.MethodPost).Path(adminVersion + "/cache/writeback/flush").HandlerFunc(gz(httpTraceAll(adminAPI.CacheWriteBackFlushHandler)))
+		adminRouter.Methods(http.MethodPost).Path(adminVersion + "/cache/writeback/wait").HandlerFunc(gz(httpTraceAll(adminAPI.CacheWriteBackWaitHandler)))
+
+		// -- Disk cache pre-warm and pinning APIs --
+		adminRouter.Methods(http.MethodPost).Path(adminVersion + "/cache/prewarm").HandlerFunc(gz(httpTraceAll(adminAPI.CachePrewarmHandler)))
+		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/cache/prewarm").HandlerFunc(gz(httpTraceAll(adminAPI.CachePrewarmStatusHandler)))
+		adminRouter.Methods(http.MethodDelete).Path(adminVersion + "/cache/prewarm").HandlerFunc(gz(httpTraceAll(adminAPI.CachePrewarmCancelHandler)))
+		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/cache/pin").HandlerFunc(gz(httpTraceAll(adminAPI.CachePinListHandler)))
+		adminRouter.Methods(http.MethodPost).Path(adminVersion + "/cache/pin").HandlerFunc(gz(httpTraceAll(adminAPI.CachePinHandler)))
+		adminRouter.Methods(http.MethodDelete).Path(adminVersion + "/cache/pin").HandlerFunc(gz(httpTraceAll(adminAPI.CacheUnpinHandler)))
+		adminRouter.Methods(http.MethodGet).Path(adminVersion + "/cache/residency").HandlerFunc(gz(httpTraceAll(adminAPI.CacheResidencyHandler)))
+
+		if globalIsGateway {
+			// -- Gateway specific APIs --
+			adminRouter.Methods(http.MethodGet, http.MethodPost, http.MethodDelete).Path(adminVersion + "/gateway/{op:.*}").
+				HandlerFunc(gz(httpTraceHdrs(adminAPI.GatewayAdminHandler)))
+
+			// Heal operations of gateways repairing their backend
+			adminRouter.Methods(http.MethodPost).Path(adminVersion + "/heal/").HandlerFunc(gz(httpTraceAll(adminAPI.GatewayHealHandler)))
+			adminRouter.Methods(http.MethodPost).Path(adminVersion + "/heal/{bucket}").HandlerFunc(gz(httpTraceAll(adminAPI.GatewayHealHandler)))
+			adminRouter.Methods(http.MethodPost).Path(adminVersion + "/heal/{bucket}/{prefix:.*}").HandlerFunc(gz(httpTraceAll(adminAPI.GatewayHealHandler)))
+		}
+
 		if !globalIsGateway {
 			// Keep obdinfo for backward compatibility with mc
 			adminRouter.Methods(http.MethodGet).Path(adminVersion + "/obdinfo").
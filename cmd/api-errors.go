@@ -1990,6 +1990,8 @@ func toAPIErrorCode(ctx context.Context, err error) (apiErr APIErrorCode) {
 		apiErr = ErrNoSuchUpload
 	case InvalidPart:
 		apiErr = ErrInvalidPart
+	case InvalidPartOrder:
+		apiErr = ErrInvalidPartOrder
 	case InsufficientWriteQuorum:
 		apiErr = ErrSlowDown
 	case InsufficientReadQuorum:
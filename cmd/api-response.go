@@ -371,6 +371,32 @@ type DeleteObjectsResponse struct {
 	Errors []DeleteError `xml:"Error,omitempty"`
 }
 
+// PutObjectResult structure.
+type PutObjectResult struct {
+	Key       string
+	ETag      string `xml:"ETag,omitempty" json:",omitempty"`
+	Size      int64
+	VersionID string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+}
+
+// PutObjectError structure.
+type PutObjectError struct {
+	Code    string
+	Message string
+	Key     string
+}
+
+// PutMultipleObjectsResponse container for multiple object uploads.
+type PutMultipleObjectsResponse struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ PutMultipleObjectsResult" json:"-"`
+
+	// Collection of all uploaded objects
+	Uploaded []PutObjectResult `xml:"Uploaded,omitempty" json:",omitempty"`
+
+	// Collection of errors uploading certain objects.
+	Errors []PutObjectError `xml:"Error,omitempty" json:",omitempty"`
+}
+
 // PostResponse container for POST object request when success_action_status is set to 201
 type PostResponse struct {
 	Bucket   string
@@ -734,6 +760,33 @@ func generateMultiDeleteResponse(quiet bool, deletedObjects []DeletedObject, err
 	return deleteResp
 }
 
+// generateMultiPutResponse reports the outcome of each object of a
+// PutMultipleObjects call, errs holds the error of each object in objects.
+func generateMultiPutResponse(ctx context.Context, objects []string, objInfos []ObjectInfo, errs []error) PutMultipleObjectsResponse {
+	putResp := PutMultipleObjectsResponse{}
+	for i, object := range objects {
+		if errs[i] != nil {
+			apiErr := toAPIError(ctx, errs[i])
+			putResp.Errors = append(putResp.Errors, PutObjectError{
+				Code:    apiErr.Code,
+				Message: apiErr.Description,
+				Key:     object,
+			})
+			continue
+		}
+		result := PutObjectResult{
+			Key:       object,
+			Size:      objInfos[i].Size,
+			VersionID: objInfos[i].VersionID,
+		}
+		if objInfos[i].ETag != "" {
+			result.ETag = "\"" + objInfos[i].ETag + "\""
+		}
+		putResp.Uploaded = append(putResp.Uploaded, result)
+	}
+	return putResp
+}
+
 func writeResponse(w http.ResponseWriter, statusCode int, response []byte, mType mimeType) {
 	setCommonHeaders(w)
 	if mType != mimeNone {
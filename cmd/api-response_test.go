@@ -18,7 +18,9 @@
 package cmd
 
 import (
+	"context"
 	"net/http"
+	"reflect"
 	"testing"
 )
 
@@ -123,3 +125,26 @@ func TestGetURLScheme(t *testing.T) {
 		t.Errorf("Expected %s, got %s", httpsScheme, gotScheme)
 	}
 }
+
+// Tests the result document of PutMultipleObjects.
+func TestGenerateMultiPutResponse(t *testing.T) {
+	objects := []string{"a.txt", "b.txt", "c.txt"}
+	objInfos := []ObjectInfo{
+		{Name: "a.txt", Size: 5, ETag: "etag-a"},
+		{},
+		{Name: "c.txt", Size: 7, VersionID: "v1"},
+	}
+	errs := []error{nil, PrefixAccessDenied{Bucket: "bucket", Object: "b.txt"}, nil}
+
+	resp := generateMultiPutResponse(context.Background(), objects, objInfos, errs)
+	expectedUploaded := []PutObjectResult{
+		{Key: "a.txt", ETag: "\"etag-a\"", Size: 5},
+		{Key: "c.txt", Size: 7, VersionID: "v1"},
+	}
+	if !reflect.DeepEqual(resp.Uploaded, expectedUploaded) {
+		t.Errorf("Expected uploaded %v, got %v", expectedUploaded, resp.Uploaded)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Key != "b.txt" || resp.Errors[0].Code != "AccessDenied" {
+		t.Errorf("Expected an AccessDenied error for b.txt, got %v", resp.Errors)
+	}
+}
@@ -35,6 +35,13 @@ const (
 	bucketSSEConfig = "bucket-encryption.xml"
 )
 
+// gatewayEncrypts returns whether objAPI is a gateway whose backend encrypts
+// objects itself.
+func gatewayEncrypts(objAPI ObjectLayer) bool {
+	ge, ok := unwrapGatewayLayer(objAPI).(GatewayEncryption)
+	return ok && ge.BackendEncryption()
+}
+
 // PutBucketEncryptionHandler - Stores given bucket encryption configuration
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketEncryption.html
 func (api objectAPIHandlers) PutBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
@@ -48,7 +55,7 @@ func (api objectAPIHandlers) PutBucketEncryptionHandler(w http.ResponseWriter, r
 		return
 	}
 
-	if !objAPI.IsEncryptionSupported() {
+	if !objAPI.IsEncryptionSupported() && !gatewayEncrypts(objAPI) {
 		writeErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrNotImplemented), r.URL)
 		return
 	}
@@ -79,8 +86,9 @@ func (api objectAPIHandlers) PutBucketEncryptionHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Return error if KMS is not initialized
-	if GlobalKMS == nil {
+	// Return error if KMS is not initialized, gateways encrypting with
+	// their backend do not need one.
+	if GlobalKMS == nil && !gatewayEncrypts(objAPI) {
 		writeErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrKMSNotConfigured), r.URL)
 		return
 	}
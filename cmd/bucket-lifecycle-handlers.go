@@ -73,6 +73,12 @@ func (api objectAPIHandlers) PutBucketLifecycleHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// Only gateways applying the rules themselves abort incomplete uploads,
+	// the action is ignored by the other backends.
+	if la, ok := unwrapGatewayLayer(objAPI).(GatewayLifecycle); !ok || !la.AbortsIncompleteUploads() {
+		bucketLifecycle.RemoveAbortIncompleteMultipartUpload()
+	}
+
 	// Validate the received bucket policy document
 	if err = bucketLifecycle.Validate(); err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
@@ -50,83 +50,78 @@ func concurrentDecryptETag(ctx context.Context, objects []ObjectInfo) {
 	g.Wait()
 }
 
-func mergeListObjects(l1, l2 []ObjectInfo) []ObjectInfo {
-	mergedMap := make(map[string]ObjectInfo)
-
-	// Helper function to add/update map entries
-	addOrUpdate := func(obj ObjectInfo) {
-		if existingObj, found := mergedMap[obj.Name]; !found || obj.ModTime.After(existingObj.ModTime) {
-			mergedMap[obj.Name] = obj
+// mergeListObjects merges the listing pages of the backend and of the disk
+// cache, both listed after the same marker, into one page of at most maxKeys
+// objects and prefixes in lexical order. A truncated page only covers the
+// names up to its last one, so the merged page stops there and resumes after
+// it. Of an object listed by both, the most recently modified one is kept,
+// which is the cached one until it is committed to the backend.
+func mergeListObjects(backend, cache ListObjectsInfo, maxKeys int) (result ListObjectsInfo) {
+	objects := make(map[string]ObjectInfo, len(backend.Objects)+len(cache.Objects))
+	prefixes := make(map[string]bool, len(backend.Prefixes)+len(cache.Prefixes))
+	var names []string
+	bound, bounded := "", false
+	for _, page := range []ListObjectsInfo{backend, cache} {
+		last := ""
+		for _, obj := range page.Objects {
+			existing, found := objects[obj.Name]
+			if !found && !prefixes[obj.Name] {
+				names = append(names, obj.Name)
+			}
+			if !found || obj.ModTime.After(existing.ModTime) {
+				objects[obj.Name] = obj
+			}
+			if obj.Name > last {
+				last = obj.Name
+			}
 		}
-	}
-	for _, obj := range l1 {
-		addOrUpdate(obj)
-	}
-	for _, obj := range l2 {
-		addOrUpdate(obj)
-	}
-
-	mergedList := make([]ObjectInfo, 0, len(mergedMap))
-	for _, obj := range mergedMap {
-		mergedList = append(mergedList, obj)
-	}
-
-	return mergedList
-}
-
-func mergePrefixes(l1, l2 []string) []string {
-	mergedMap := make(map[string]bool)
-
-	// Helper function to add/update map entries
-	addOrUpdate := func(pre string) {
-		if _, found := mergedMap[pre]; !found {
-			mergedMap[pre] = true
+		for _, prefix := range page.Prefixes {
+			if _, found := objects[prefix]; !found && !prefixes[prefix] {
+				names = append(names, prefix)
+			}
+			prefixes[prefix] = true
+			if prefix > last {
+				last = prefix
+			}
+		}
+		if !page.IsTruncated {
+			continue
+		}
+		if last == "" {
+			last = page.NextMarker
+		}
+		if !bounded || last < bound {
+			bound, bounded = last, true
 		}
 	}
-	for _, pre := range l1 {
-		addOrUpdate(pre)
-	}
-	for _, pre := range l2 {
-		addOrUpdate(pre)
-	}
-
-	mergedList := make([]string, 0, len(mergedMap))
-	for pre, _ := range mergedMap {
-		mergedList = append(mergedList, pre)
-	}
-
-	return mergedList
-}
-
-func limitMergeObjects(mergeObjects []ObjectInfo, mergePrefixes []string, maxKeys int) ([]ObjectInfo, []string, string) {
-	objPrefixMap := map[string]ObjectInfo{}
-	for _, ob := range mergeObjects {
-		objPrefixMap[ob.Name] = ob
-	}
-	for _, pre := range mergePrefixes {
-		objPrefixMap[pre] = ObjectInfo{IsDir: true}
-	}
+	sort.Strings(names)
 
-	keys := make([]string, 0, len(objPrefixMap))
-	for key := range objPrefixMap {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-	limitedObjs := []ObjectInfo{}
-	limitedPrefixes := []string{}
-	nextMarker := ""
-	for i, key := range keys {
-		if objPrefixMap[key].IsDir {
-			limitedPrefixes = append(limitedPrefixes, key)
-		} else {
-			limitedObjs = append(limitedObjs, objPrefixMap[key])
+	for _, name := range names {
+		if bounded && name > bound {
+			break
 		}
-		if i >= (maxKeys - 1) {
-			nextMarker = key
+		if len(result.Objects)+len(result.Prefixes) == maxKeys {
+			result.IsTruncated = true
 			break
 		}
+		if prefixes[name] {
+			result.Prefixes = append(result.Prefixes, name)
+		} else {
+			result.Objects = append(result.Objects, objects[name])
+		}
+		result.NextMarker = name
+	}
+	if bounded && !result.IsTruncated {
+		// the names after the bound are listed by the next page.
+		if result.NextMarker == "" {
+			result.NextMarker = bound
+		}
+		result.IsTruncated = result.NextMarker != ""
+	}
+	if !result.IsTruncated {
+		result.NextMarker = ""
 	}
-	return limitedObjs, limitedPrefixes, nextMarker
+	return result
 }
 
 // Validate all the ListObjects query arguments, returns an APIErrorCode
@@ -338,6 +333,8 @@ func (api objectAPIHandlers) ListObjectsV2Handler(w http.ResponseWriter, r *http
 	if r.Header.Get(xMinIOExtract) == "true" && strings.Contains(prefix, archivePattern) {
 		// Inititate a list objects operation inside a zip file based in the input params
 		listObjectsV2Info, err = listObjectsV2InArchive(ctx, objectAPI, bucket, prefix, token, delimiter, maxKeys, fetchOwner, startAfter)
+		// archives are not cached.
+		cacheEnabled = false
 	} else {
 		// Inititate a list objects operation based on the input params.
 		// On success would return back ListObjectsInfo object to be
@@ -359,19 +356,30 @@ func (api objectAPIHandlers) ListObjectsV2Handler(w http.ResponseWriter, r *http
 		}()
 		wg.Wait()
 	}
-	if err != nil || errC != nil {
+	if err == nil {
+		err = errC
+	}
+	if err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 		return
 	}
 
-	mergeObjects := mergeListObjects(listObjectsV2Info.Objects, listObjectsV2InfoCache.Objects)
-	mergePrefixes := mergePrefixes(listObjectsV2Info.Prefixes, listObjectsV2InfoCache.Prefixes)
-	limitedObjects, limitedPrefix, nextMarker := limitMergeObjects(mergeObjects, mergePrefixes, maxKeys)
-	listObjectsV2Info.Objects = limitedObjects
-	listObjectsV2Info.Prefixes = limitedPrefix
-	if nextMarker != "" {
-		listObjectsV2Info.NextContinuationToken = nextMarker
-		listObjectsV2Info.IsTruncated = true
+	if cacheEnabled && maxKeys > 0 {
+		merged := mergeListObjects(ListObjectsInfo{
+			IsTruncated: listObjectsV2Info.IsTruncated,
+			NextMarker:  listObjectsV2Info.NextContinuationToken,
+			Objects:     listObjectsV2Info.Objects,
+			Prefixes:    listObjectsV2Info.Prefixes,
+		}, ListObjectsInfo{
+			IsTruncated: listObjectsV2InfoCache.IsTruncated,
+			NextMarker:  listObjectsV2InfoCache.NextContinuationToken,
+			Objects:     listObjectsV2InfoCache.Objects,
+			Prefixes:    listObjectsV2InfoCache.Prefixes,
+		}, maxKeys)
+		listObjectsV2Info.IsTruncated = merged.IsTruncated
+		listObjectsV2Info.NextContinuationToken = merged.NextMarker
+		listObjectsV2Info.Objects = merged.Objects
+		listObjectsV2Info.Prefixes = merged.Prefixes
 	}
 
 	concurrentDecryptETag(ctx, listObjectsV2Info.Objects)
@@ -498,18 +506,15 @@ func (api objectAPIHandlers) ListObjectsV1Handler(w http.ResponseWriter, r *http
 
 	wg.Wait()
 
-	if err != nil || errC != nil {
+	if err == nil {
+		err = errC
+	}
+	if err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 		return
 	}
-	mergeObjects := mergeListObjects(listObjectsInfo.Objects, listObjectsInfoCache.Objects)
-	mergePrefixes := mergePrefixes(listObjectsInfo.Prefixes, listObjectsInfoCache.Prefixes)
-	limitedObjects, limitedPrefix, nextMarker := limitMergeObjects(mergeObjects, mergePrefixes, maxKeys)
-	listObjectsInfo.Objects = limitedObjects
-	listObjectsInfo.Prefixes = limitedPrefix
-	if nextMarker != "" {
-		listObjectsInfo.NextMarker = nextMarker
-		listObjectsInfo.IsTruncated = true
+	if cacheEnabled && maxKeys > 0 {
+		listObjectsInfo = mergeListObjects(listObjectsInfo, listObjectsInfoCache, maxKeys)
 	}
 
 	concurrentDecryptETag(ctx, listObjectsInfo.Objects)
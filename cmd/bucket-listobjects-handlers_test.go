@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listNames lists names like a backend, as a page of at most maxKeys entries.
+func listNames(names []string, prefix, marker, delimiter string, maxKeys int) (result ListObjectsInfo) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if !strings.HasPrefix(name, prefix) || name <= marker {
+			continue
+		}
+		entry, isPrefix := name, false
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				entry, isPrefix = name[:len(prefix)+i+len(delimiter)], true
+			}
+		}
+		if entry <= marker || entry == result.NextMarker {
+			continue
+		}
+		if len(result.Objects)+len(result.Prefixes) == maxKeys {
+			result.IsTruncated = true
+			return result
+		}
+		if isPrefix {
+			result.Prefixes = append(result.Prefixes, entry)
+		} else {
+			result.Objects = append(result.Objects, ObjectInfo{Name: name})
+		}
+		result.NextMarker = entry
+	}
+	result.NextMarker = ""
+	return result
+}
+
+// listedNames returns the objects and prefixes of a page in lexical order.
+func listedNames(result ListObjectsInfo) []string {
+	var names []string
+	for _, obj := range result.Objects {
+		names = append(names, obj.Name)
+	}
+	names = append(names, result.Prefixes...)
+	sort.Strings(names)
+	return names
+}
+
+func TestMergeListObjects(t *testing.T) {
+	backendNames := []string{"a", "c/1", "c/2", "e", "f/g/h", "k", "m/n", "z"}
+	cacheNames := []string{"b", "c/3", "d/1", "e", "f-1", "j", "y"}
+
+	cache := &cacheObjects{listTree: NewThreadSafeListTree()}
+	for _, name := range cacheNames {
+		cache.listTree.Insert([]byte("bucket/"+name), ObjectInfo{Bucket: "bucket", Name: name, ModTime: time.Now()})
+	}
+
+	testCases := []struct {
+		prefix, marker, delimiter string
+	}{
+		{"", "", ""},
+		{"", "", "/"},
+		{"", "c/1", "/"},
+		{"", "c/", "/"},
+		{"c/", "", "/"},
+		{"f", "", "/"},
+		{"f", "", "-"},
+		{"c/", "a", ""},
+		{"c/", "x", "/"},
+	}
+	for i, tc := range testCases {
+		expected := listNames(append(backendNames, cacheNames...), tc.prefix, tc.marker, tc.delimiter, -1)
+		for maxKeys := 1; maxKeys <= 4; maxKeys++ {
+			var names []string
+			marker := tc.marker
+			for pages := 0; ; pages++ {
+				if pages > 20 {
+					t.Fatalf("Test %d, maxKeys %d: listing does not end", i+1, maxKeys)
+				}
+				backend := listNames(backendNames, tc.prefix, marker, tc.delimiter, maxKeys)
+				cached, err := cache.ListObjects(context.Background(), "bucket", tc.prefix, marker, tc.delimiter, maxKeys)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result := mergeListObjects(backend, cached, maxKeys)
+				if len(result.Objects)+len(result.Prefixes) > maxKeys {
+					t.Fatalf("Test %d, maxKeys %d: page holds more than maxKeys entries %v", i+1, maxKeys, listedNames(result))
+				}
+				page := listedNames(result)
+				names = append(names, page...)
+				if !result.IsTruncated {
+					break
+				}
+				if result.NextMarker != page[len(page)-1] {
+					t.Fatalf("Test %d, maxKeys %d: expected next marker %s, got %s", i+1, maxKeys, page[len(page)-1], result.NextMarker)
+				}
+				marker = result.NextMarker
+			}
+			if !reflect.DeepEqual(names, listedNames(expected)) {
+				t.Fatalf("Test %d, maxKeys %d: expected %v, got %v", i+1, maxKeys, listedNames(expected), names)
+			}
+		}
+	}
+}
+
+func TestMergeListObjectsNewest(t *testing.T) {
+	now := time.Now()
+	backend := ListObjectsInfo{Objects: []ObjectInfo{{Name: "a", ETag: "old", ModTime: now.Add(-time.Hour)}}}
+	cache := ListObjectsInfo{Objects: []ObjectInfo{{Name: "a", ETag: "new", ModTime: now}}}
+	result := mergeListObjects(backend, cache, 10)
+	if len(result.Objects) != 1 || result.Objects[0].ETag != "new" || result.IsTruncated {
+		t.Fatalf("Expected the cached version of a only, got %+v", result)
+	}
+}
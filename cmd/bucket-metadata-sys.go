@@ -18,6 +18,7 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -44,9 +45,16 @@ type BucketMetadataSys struct {
 	metadataMap map[string]BucketMetadata
 }
 
+// gatewayKeepsBucketMetadata returns whether the running gateway stores bucket
+// metadata in its backend, which is then cached here as for erasure and FS.
+func gatewayKeepsBucketMetadata() bool {
+	gm, ok := globalGateway.(GatewayMetadata)
+	return globalIsGateway && ok && gm.KeepsBucketMetadata()
+}
+
 // Remove bucket metadata from memory.
 func (sys *BucketMetadataSys) Remove(bucket string) {
-	if globalIsGateway {
+	if globalIsGateway && !gatewayKeepsBucketMetadata() {
 		return
 	}
 	sys.Lock()
@@ -61,7 +69,7 @@ func (sys *BucketMetadataSys) Remove(bucket string) {
 // so they should be replaced atomically and not appended to, etc.
 // Data is not persisted to disk.
 func (sys *BucketMetadataSys) Set(bucket string, meta BucketMetadata) {
-	if globalIsGateway {
+	if globalIsGateway && !gatewayKeepsBucketMetadata() {
 		return
 	}
 
@@ -84,6 +92,19 @@ func (sys *BucketMetadataSys) Update(bucket string, configFile string, configDat
 		return errInvalidArgument
 	}
 
+	if globalIsGateway && configFile == bucketVersioningConfig {
+		// Gateways keep the versioning state in their backend.
+		v, err := versioning.ParseConfig(bytes.NewReader(configData))
+		if err != nil {
+			return err
+		}
+		gv, ok := unwrapGatewayLayer(objAPI).(GatewayVersioning)
+		if !ok {
+			return NotImplemented{}
+		}
+		return gv.SetBucketVersioning(GlobalContext, bucket, v)
+	}
+
 	meta, err := loadBucketMetadata(GlobalContext, objAPI, bucket)
 	if err != nil {
 		log.Println("Error loading bucket metadata", err)
@@ -156,7 +177,7 @@ func (sys *BucketMetadataSys) Update(bucket string, configFile string, configDat
 // For all other bucket specific metadata, use the relevant
 // calls implemented specifically for each of those features.
 func (sys *BucketMetadataSys) Get(bucket string) (BucketMetadata, error) {
-	if globalIsGateway || bucket == minioMetaBucket {
+	if (globalIsGateway && !gatewayKeepsBucketMetadata()) || bucket == minioMetaBucket {
 		return newBucketMetadata(bucket), errConfigNotFound
 	}
 
@@ -287,7 +308,7 @@ func (sys *BucketMetadataSys) GetSSEConfig(bucket string) (*bucketsse.BucketSSEC
 // GetPolicyConfig returns configured bucket policy
 // The returned object may not be modified.
 func (sys *BucketMetadataSys) GetPolicyConfig(bucket string) (*policy.Policy, error) {
-	if globalIsGateway {
+	if globalIsGateway && !gatewayKeepsBucketMetadata() {
 		objAPI := newObjectLayerFn()
 		if objAPI == nil {
 			return nil, errServerNotInitialized
@@ -370,7 +391,7 @@ func (sys *BucketMetadataSys) GetConfig(bucket string) (BucketMetadata, error) {
 		return newBucketMetadata(bucket), errServerNotInitialized
 	}
 
-	if globalIsGateway {
+	if globalIsGateway && !gatewayKeepsBucketMetadata() {
 		return newBucketMetadata(bucket), nil
 	}
 
@@ -18,6 +18,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -27,6 +28,7 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	miniogopolicy "github.com/minio/minio-go/v7/pkg/policy"
+	"github.com/minio/minio-go/v7/pkg/tags"
 	"github.com/minio/minio/internal/handlers"
 	xhttp "github.com/minio/minio/internal/http"
 	"github.com/minio/minio/internal/logger"
@@ -167,6 +169,21 @@ func getConditionValues(r *http.Request, lc string, username string, claims map[
 		}
 	}
 
+	// Tags sent with the request and tags of the object it operates on.
+	if reqTags, err := tags.ParseObjectTags(r.Header.Get(xhttp.AmzObjectTagging)); err == nil {
+		for k, v := range reqTags.ToMap() {
+			args["RequestObjectTag/"+k] = []string{v}
+			args["RequestObjectTagKeys"] = append(args["RequestObjectTagKeys"], k)
+		}
+	}
+	if userTags, ok := r.Context().Value(existingObjectTagsKey{}).(string); ok {
+		if objTags, err := tags.ParseObjectTags(userTags); err == nil {
+			for k, v := range objTags.ToMap() {
+				args["ExistingObjectTag/"+k] = []string{v}
+			}
+		}
+	}
+
 	// JWT specific values
 	for k, v := range claims {
 		vStr, ok := v.(string)
@@ -186,6 +203,39 @@ func getConditionValues(r *http.Request, lc string, username string, claims map[
 	return args
 }
 
+type existingObjectTagsKey struct{}
+
+// policyUsesExistingObjectTags returns whether the bucket policy has
+// conditions on the tags of the objects.
+func policyUsesExistingObjectTags(bucket string) bool {
+	p, err := globalPolicySys.Get(bucket)
+	if err != nil {
+		return false
+	}
+	for _, st := range p.Statements {
+		for key := range st.Conditions.Keys() {
+			if strings.HasPrefix(key.Name(), "ExistingObjectTag/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withExistingObjectTags returns r carrying the tags of the object it reads,
+// so that bucket policies can have conditions on them. The object is only
+// looked up when the bucket policy refers to object tags.
+func withExistingObjectTags(ctx context.Context, objAPI ObjectLayer, r *http.Request, bucket, object string, opts ObjectOptions) *http.Request {
+	if !objAPI.IsTaggingSupported() || !policyUsesExistingObjectTags(bucket) {
+		return r
+	}
+	objInfo, err := objAPI.GetObjectInfo(ctx, bucket, object, opts)
+	if err != nil || objInfo.UserTags == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), existingObjectTagsKey{}, objInfo.UserTags))
+}
+
 // PolicyToBucketAccessPolicy converts a MinIO policy into a minio-go policy data structure.
 func PolicyToBucketAccessPolicy(bucketPolicy *policy.Policy) (*miniogopolicy.BucketAccessPolicy, error) {
 	// Return empty BucketAccessPolicy for empty bucket policy.
@@ -24,7 +24,7 @@ type BucketVersioningSys struct{}
 
 // Enabled enabled versioning?
 func (sys *BucketVersioningSys) Enabled(bucket string) bool {
-	vc, err := globalBucketMetadataSys.GetVersioningConfig(bucket)
+	vc, err := sys.Get(bucket)
 	if err != nil {
 		return false
 	}
@@ -33,7 +33,7 @@ func (sys *BucketVersioningSys) Enabled(bucket string) bool {
 
 // Suspended suspended versioning?
 func (sys *BucketVersioningSys) Suspended(bucket string) bool {
-	vc, err := globalBucketMetadataSys.GetVersioningConfig(bucket)
+	vc, err := sys.Get(bucket)
 	if err != nil {
 		return false
 	}
@@ -47,7 +47,11 @@ func (sys *BucketVersioningSys) Get(bucket string) (*versioning.Versioning, erro
 		if objAPI == nil {
 			return nil, errServerNotInitialized
 		}
-		return nil, NotImplemented{}
+		gv, ok := unwrapGatewayLayer(objAPI).(GatewayVersioning)
+		if !ok {
+			return nil, NotImplemented{}
+		}
+		return gv.GetBucketVersioning(GlobalContext, bucket)
 	}
 	return globalBucketMetadataSys.GetVersioningConfig(bucket)
 }
@@ -40,6 +40,7 @@ import (
 	"github.com/minio/minio/internal/config/scanner"
 	"github.com/minio/minio/internal/config/storageclass"
 	"github.com/minio/minio/internal/config/subnet"
+	"github.com/minio/minio/internal/config/zcn"
 	"github.com/minio/minio/internal/crypto"
 	xhttp "github.com/minio/minio/internal/http"
 	"github.com/minio/minio/internal/kms"
@@ -75,6 +76,9 @@ func initHelp() {
 	if globalIsErasure {
 		kvs[config.StorageClassSubSys] = storageclass.DefaultKVS
 	}
+	if globalGatewayName == ZCNBAckendGateway {
+		kvs[config.ZCNSubSys] = zcn.DefaultKVS
+	}
 	config.RegisterDefaultKVS(kvs)
 
 	// Captures help for each sub-system
@@ -205,6 +209,13 @@ func initHelp() {
 		}
 	}
 
+	if globalGatewayName == ZCNBAckendGateway {
+		helpSubSys = append(helpSubSys, config.HelpKV{
+			Key:         config.ZCNSubSys,
+			Description: "tune batching, transfers, encryption and compression of the zcn gateway",
+		})
+	}
+
 	helpMap := map[string]config.HelpKVS{
 		"":                          helpSubSys, // Help for all sub-systems.
 		config.SiteSubSys:           config.SiteHelp,
@@ -234,6 +245,7 @@ func initHelp() {
 		config.NotifyWebhookSubSys:  notify.HelpWebhook,
 		config.NotifyESSubSys:       notify.HelpES,
 		config.SubnetSubSys:         subnet.HelpSubnet,
+		config.ZCNSubSys:            zcn.Help,
 	}
 
 	config.RegisterHelpSubSys(helpMap)
@@ -313,6 +325,12 @@ func validateConfig(s config.Config) error {
 		return err
 	}
 
+	if globalGatewayName == ZCNBAckendGateway {
+		if _, err = zcn.LookupConfig(s[config.ZCNSubSys][config.Default]); err != nil {
+			return err
+		}
+	}
+
 	{
 		etcdCfg, err := etcd.LookupConfig(s[config.EtcdSubSys][config.Default], globalRootCAs)
 		if err != nil {
@@ -635,6 +653,13 @@ func applyDynamicConfig(ctx context.Context, objAPI ObjectLayer, s config.Config
 		return fmt.Errorf("Unable to apply scanner config: %w", err)
 	}
 
+	// Gateway backend tuning
+	if gt, ok := unwrapGatewayLayer(objAPI).(GatewayTuner); ok {
+		if err = gt.SetGatewayConfig(ctx, s[config.ZCNSubSys][config.Default]); err != nil {
+			return fmt.Errorf("Unable to apply zcn config: %w", err)
+		}
+	}
+
 	// Apply configurations.
 	// We should not fail after this.
 	var setDriveCounts []int
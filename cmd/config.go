@@ -183,6 +183,37 @@ func readServerConfig(ctx context.Context, objAPI ObjectLayer) (config.Config, e
 	return srvCfg.Merge(), nil
 }
 
+// gatewayKeepsConfig returns true for gateways which keep the server config
+// on their backend, the admin config KV API is served for them.
+func gatewayKeepsConfig() bool {
+	gm, ok := globalGateway.(GatewayMetadata)
+	return globalIsGateway && ok && gm.KeepsConfig()
+}
+
+// initGatewayConfig loads the config a gateway keeps on its backend, the config
+// set up from the environment is saved there on first start. Only the dynamic
+// sub-systems are applied, the others were set up from the environment before
+// the backend was initialized.
+func initGatewayConfig(ctx context.Context, objAPI ObjectLayer) error {
+	configFile := path.Join(minioConfigPrefix, minioConfigFile)
+	if err := checkConfig(ctx, objAPI, configFile); err != nil {
+		if err != errConfigNotFound {
+			return err
+		}
+		globalServerConfigMu.RLock()
+		err = saveServerConfig(ctx, objAPI, globalServerConfig)
+		globalServerConfigMu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+	srvCfg, err := readServerConfig(ctx, objAPI)
+	if err != nil {
+		return err
+	}
+	return applyDynamicConfig(ctx, objAPI, srvCfg)
+}
+
 // ConfigSys - config system.
 type ConfigSys struct{}
 
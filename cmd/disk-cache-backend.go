@@ -27,7 +27,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"path"
@@ -177,7 +176,11 @@ type diskCache struct {
 	commitWriteback    bool
 	commitWritethrough bool
 
-	retryWritebackCh chan ObjectInfo
+	// wbJournal holds the objects waiting to be committed to the backend
+	// when commitWriteback is set.
+	wbJournal *writeBackJournal
+	// pins holds the prefixes purge never evicts.
+	pins *cachePins
 	// nsMutex namespace lock
 	nsMutex *nsLockMap
 	// Object functions pointing to the corresponding functions of backend implementation.
@@ -205,9 +208,7 @@ func newDiskCache(ctx context.Context, dir string, config cache.Config) (*diskCa
 		enableRange:        config.Range,
 		commitWriteback:    config.CacheCommitMode == CommitWriteBack,
 		commitWritethrough: config.CacheCommitMode == CommitWriteThrough,
-
-		retryWritebackCh: make(chan ObjectInfo, 100000),
-		online:           1,
+		online:             1,
 		pool: sync.Pool{
 			New: func() interface{} {
 				b := disk.AlignedBlock(int(cacheBlkSize))
@@ -216,26 +217,25 @@ func newDiskCache(ctx context.Context, dir string, config cache.Config) (*diskCa
 		},
 		nsMutex: newNSLock(false),
 	}
-	go cache.purgeWait(ctx)
-	go cache.cleanupStaleUploads(ctx)
 	if cache.commitWriteback {
+		wbJournal, err := openWriteBackJournal(pathJoin(dir, minioMetaBucket, writeBackJournalFile))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open the write back journal of '%s' dir, %w", dir, err)
+		}
+		cache.wbJournal = wbJournal
 		go func() {
-			tickInterval := time.Duration(config.WriteBackInterval) * time.Second
-			log.Println("write back time interval", tickInterval)
-			ticker := time.NewTicker(tickInterval)
-			defer ticker.Stop()
-			defer close(cache.retryWritebackCh)
-			for {
-				select {
-				case <-ticker.C:
-					cache.scanCacheWritebackFailures(ctx)
-				case <-ctx.Done():
-					return
-				}
-			}
+			<-ctx.Done()
+			cache.wbJournal.Close()
 		}()
-		//go cache.scanCacheWritebackFailures(ctx)
+		go cache.scanCacheWritebackFailures(ctx)
 	}
+	pins, err := loadCachePins(pathJoin(dir, minioMetaBucket, cachePinsFile))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load the cache pins of '%s' dir, %w", dir, err)
+	}
+	cache.pins = pins
+	go cache.purgeWait(ctx)
+	go cache.cleanupStaleUploads(ctx)
 	cache.diskSpaceAvailable(0) // update if cache usage is already high.
 	cache.NewNSLockFn = func(cachePath string) RWLocker {
 		return cache.nsMutex.NewNSLock(nil, cachePath, "")
@@ -265,6 +265,30 @@ func (c *diskCache) diskUsageLow() bool {
 	return low
 }
 
+// diskUsageHigh returns true if disk usage reaches or exceeds the high watermark
+// w.r.t configured cache quota, a GC is queued when it does.
+func (c *diskCache) diskUsageHigh() bool {
+	gcTriggerPct := c.quotaPct * c.highWatermark / 100
+	di, err := disk.GetInfo(c.dir)
+	if err != nil {
+		reqInfo := (&logger.ReqInfo{}).AppendTags("cachePath", c.dir)
+		ctx := logger.SetReqInfo(GlobalContext, reqInfo)
+		logger.LogIf(ctx, err)
+		return true
+	}
+	if di.Total == 0 {
+		return true
+	}
+	usedPercent := float64(di.Used) * 100 / float64(di.Total)
+	atomic.StoreUint64(&c.stats.UsagePercent, uint64(usedPercent))
+	if usedPercent < float64(gcTriggerPct) {
+		return false
+	}
+	atomic.StoreInt32(&c.stats.UsageState, 1)
+	c.queueGC()
+	return true
+}
+
 // Returns if the disk usage reaches  or exceeds configured cache quota when size is added.
 // If current usage without size exceeds high watermark a GC is automatically queued.
 func (c *diskCache) diskSpaceAvailable(size int64) bool {
@@ -408,6 +432,10 @@ func (c *diskCache) purge(ctx context.Context) {
 			return nil
 		}
 		cc := cacheControlOpts(objInfo)
+		// pinned objects are only removed once stale.
+		if c.pins.pinned(meta.Bucket, meta.Object) && (cc == nil || !cc.isStale(objInfo.ModTime)) {
+			return nil
+		}
 		switch {
 		case cc != nil:
 			if cc.isStale(objInfo.ModTime) {
@@ -864,8 +892,42 @@ func (c *diskCache) Put(ctx context.Context, bucket, object string, data io.Read
 	return c.put(ctx, bucket, object, data, size, rs, opts, incHitsOnly, writeback)
 }
 
+// Prewarm caches the object to disk without waiting for the number of
+// accesses configured by MINIO_CACHE_AFTER. It reports false when the cached
+// object is not committed to the backend yet, it is newer than data and is
+// kept.
+func (c *diskCache) Prewarm(ctx context.Context, bucket, object string, data io.Reader, size int64, opts ObjectOptions) (bool, error) {
+	cLock, lkctx, err := c.GetLockContext(ctx, bucket, object)
+	if err != nil {
+		return false, err
+	}
+	ctx = lkctx.Context()
+	defer cLock.Unlock(lkctx.Cancel)
+
+	if c.wbJournal != nil && c.wbJournal.pending(bucket, object) {
+		return false, nil
+	}
+	meta, _, _, err := c.statCache(ctx, getCacheSHADir(c.dir, bucket, object))
+	if err == nil {
+		status, ok := meta.Meta[writeBackStatusHeader]
+		if ok && status != CommitComplete.String() {
+			return false, nil
+		}
+	}
+	if _, err = c.putAfter(ctx, bucket, object, data, size, nil, opts, false, false, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Caches the object to disk
 func (c *diskCache) put(ctx context.Context, bucket, object string, data io.Reader, size int64, rs *HTTPRangeSpec, opts ObjectOptions, incHitsOnly, writeback bool) (oi ObjectInfo, err error) {
+	return c.putAfter(ctx, bucket, object, data, size, rs, opts, incHitsOnly, writeback, c.after)
+}
+
+// putAfter caches the object to disk once it was accessed after times, until
+// then only its access count is saved.
+func (c *diskCache) putAfter(ctx context.Context, bucket, object string, data io.Reader, size int64, rs *HTTPRangeSpec, opts ObjectOptions, incHitsOnly, writeback bool, after int) (oi ObjectInfo, err error) {
 	if !c.diskSpaceAvailable(size) {
 		io.Copy(ioutil.Discard, data)
 		return oi, errDiskFull
@@ -873,11 +935,11 @@ func (c *diskCache) put(ctx context.Context, bucket, object string, data io.Read
 	cachePath := getCacheSHADir(c.dir, bucket, object)
 	meta, _, numHits, err := c.statCache(ctx, cachePath)
 	// Case where object not yet cached
-	if osIsNotExist(err) && c.after >= 1 {
+	if osIsNotExist(err) && after >= 1 {
 		return oi, c.saveMetadata(ctx, bucket, object, opts.UserDefined, size, nil, "", false)
 	}
 	// Case where object already has a cache metadata entry but not yet cached
-	if err == nil && numHits < c.after {
+	if err == nil && numHits < after {
 		cETag := extractETag(meta.Meta)
 		bETag := extractETag(opts.UserDefined)
 		if cETag == bETag {
@@ -925,6 +987,8 @@ func (c *diskCache) put(ctx context.Context, bucket, object string, data io.Read
 		return oi, IncompleteBody{Bucket: bucket, Object: object}
 	}
 	if writeback {
+		// drop the parts of an earlier version uploaded in multiple parts.
+		removeAll(getCacheSHADir(c.dir, bucket, object))
 		metadata["content-md5"] = md5sum
 		if md5bytes, err := base64.StdEncoding.DecodeString(md5sum); err == nil {
 			metadata["etag"] = hex.EncodeToString(md5bytes)
@@ -1239,10 +1303,9 @@ func (c *diskCache) Exists(ctx context.Context, bucket, object string) bool {
 	return true
 }
 
-// queues writeback upload failures on server startup
+// journals the uncommitted writeback uploads missing from the write back
+// journal on server startup, such as the ones of caches predating it.
 func (c *diskCache) scanCacheWritebackFailures(ctx context.Context) {
-	log.Println("scan cache write back failures")
-	//defer close(c.retryWritebackCh) // don't close the channel
 	filterFn := func(name string, typ os.FileMode) error {
 		if name == minioMetaBucket {
 			// Proceed to next file.
@@ -1259,11 +1322,9 @@ func (c *diskCache) scanCacheWritebackFailures(ctx context.Context) {
 		if !ok || status == CommitComplete.String() {
 			return nil
 		}
-		select {
-		case c.retryWritebackCh <- objInfo:
-		default:
+		if err = c.wbJournal.addMissing(objInfo); err != nil {
+			logger.LogIf(ctx, fmt.Errorf("Unable to journal %s/%s for write back: %w", objInfo.Bucket, objInfo.Name, err))
 		}
-
 		return nil
 	}
 
@@ -1484,6 +1545,13 @@ func (c *diskCache) uploadIDExists(bucket, object, uploadID string) (err error)
 	return nil
 }
 
+// uploadMeta returns the metadata of the multipart upload uploadID being cached.
+func (c *diskCache) uploadMeta(ctx context.Context, bucket, object, uploadID string) (*cacheMeta, error) {
+	uploadIDDir := path.Join(getMultipartCacheSHADir(c.dir, bucket, object), uploadID)
+	meta, _, _, err := c.statCache(ctx, uploadIDDir)
+	return meta, err
+}
+
 // CompleteMultipartUpload completes multipart upload on cache. The parts and cache.json are moved from the temporary location in
 // .minio.sys/multipart/cacheSHA/.. to cacheSHA path after part verification succeeds.
 func (c *diskCache) CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, uploadedParts []CompletePart, roi ObjectInfo, opts ObjectOptions) (oi ObjectInfo, err error) {
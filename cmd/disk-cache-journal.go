@@ -0,0 +1,471 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio/internal/logger"
+)
+
+const (
+	writeBackJournalFile    = "writeback-journal.bin"
+	writeBackJournalVersion = 1
+	writeBackJournalHdrLen  = 2 // 2 bytes
+
+	// writeBackMaxPending is the number of objects a cache drive holds for
+	// write back, further uploads go to the backend directly.
+	writeBackMaxPending = 100000
+	// writeBackMaxRetries is the number of failed uploads after which an
+	// object is dead-lettered, it stays on the cache drive until requeued.
+	writeBackMaxRetries = 10
+	writeBackRetryBase  = 5 * time.Second
+	writeBackRetryMax   = 30 * time.Minute
+
+	// the journal is compacted once it holds this many records more than
+	// twice the pending entries.
+	writeBackJournalCompactMin = 1000
+)
+
+var errWriteBackJournalClosed = errors.New("write back journal is closed")
+
+// writeBackEntry is an object waiting on a cache drive to be committed to
+// the backend. Every change of an entry is appended to the journal as a
+// record holding its full state, the latest record of an object wins.
+type writeBackEntry struct {
+	Bucket      string    `json:"bucket"`
+	Object      string    `json:"object"`
+	ETag        string    `json:"etag"`
+	Size        int64     `json:"size"`
+	Queued      time.Time `json:"queued"`
+	Retries     int       `json:"retries,omitempty"`
+	NextAttempt time.Time `json:"next,omitempty"`
+	LastError   string    `json:"error,omitempty"`
+	Dead        bool      `json:"dead,omitempty"`
+	// Removed records an entry committed or superseded, it is only set on
+	// journal records.
+	Removed bool `json:"removed,omitempty"`
+
+	inflight bool
+}
+
+func (e *writeBackEntry) key() string {
+	return pathJoin(e.Bucket, e.Object)
+}
+
+// writeBackRetryDelay returns how long an upload waits after its nth failure.
+func writeBackRetryDelay(retries int) time.Duration {
+	d := writeBackRetryBase
+	for i := 1; i < retries && d < writeBackRetryMax; i++ {
+		d *= 2
+	}
+	if d > writeBackRetryMax {
+		d = writeBackRetryMax
+	}
+	return d
+}
+
+// writeBackJournal is the append-only log of the objects of a cache drive
+// that are not committed to the backend yet. It is replayed on startup so
+// no acknowledged upload is lost across restarts.
+type writeBackJournal struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	records int
+	entries map[string]*writeBackEntry
+	// notifyC is signalled when an entry is added or due again.
+	notifyC chan struct{}
+	// flushC is signalled when the entries are to be dispatched at once.
+	flushC chan struct{}
+}
+
+// openWriteBackJournal loads the journal at path, creating it if needed.
+func openWriteBackJournal(path string) (*writeBackJournal, error) {
+	j := &writeBackJournal{
+		path:    path,
+		entries: make(map[string]*writeBackEntry),
+		notifyC: make(chan struct{}, 1),
+		flushC:  make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return nil, err
+	}
+	if err := j.replay(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		if errors.Is(err, errUnsupportedJournalVersion) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// A record cut short by a crash ends the journal, it is dropped
+		// when the journal is rewritten below.
+		logger.LogIf(GlobalContext, fmt.Errorf("write back journal %s: %w", path, err))
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *writeBackJournal) replay() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var hdr [writeBackJournalHdrLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if binary.LittleEndian.Uint16(hdr[:]) != writeBackJournalVersion {
+		return errUnsupportedJournalVersion
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var e writeBackEntry
+		if err = dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		j.records++
+		j.apply(&e)
+	}
+}
+
+func (j *writeBackJournal) apply(e *writeBackEntry) {
+	if e.Removed {
+		if cur, ok := j.entries[e.key()]; ok && (e.ETag == "" || cur.ETag == e.ETag) {
+			delete(j.entries, e.key())
+		}
+		return
+	}
+	j.entries[e.key()] = e
+}
+
+// append writes e to the journal and applies it, the caller holds the lock.
+func (j *writeBackJournal) append(e writeBackEntry) error {
+	if j.file == nil {
+		return errWriteBackJournalClosed
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err = j.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err = j.file.Sync(); err != nil {
+		return err
+	}
+	j.records++
+	j.apply(&e)
+	if j.records > 2*len(j.entries)+writeBackJournalCompactMin {
+		return j.compactLocked()
+	}
+	return nil
+}
+
+func (j *writeBackJournal) compact() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.compactLocked()
+}
+
+// compactLocked rewrites the journal with one record per entry.
+func (j *writeBackJournal) compactLocked() error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var hdr [writeBackJournalHdrLen]byte
+	binary.LittleEndian.PutUint16(hdr[:], writeBackJournalVersion)
+	w.Write(hdr[:])
+	enc := json.NewEncoder(w)
+	for _, e := range j.entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, j.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o666)
+	j.records = len(j.entries)
+	return err
+}
+
+func (j *writeBackJournal) notify() {
+	select {
+	case j.notifyC <- struct{}{}:
+	default:
+	}
+}
+
+// full returns true when the drive holds writeBackMaxPending objects for write back.
+func (j *writeBackJournal) full() bool {
+	j.Lock()
+	defer j.Unlock()
+	return len(j.entries) >= writeBackMaxPending
+}
+
+// add records oi as waiting to be committed, replacing an earlier version
+// of the object.
+func (j *writeBackJournal) add(oi ObjectInfo) error {
+	j.Lock()
+	defer j.Unlock()
+	queued := time.Now().UTC()
+	if cur, ok := j.entries[pathJoin(oi.Bucket, oi.Name)]; ok {
+		// the object stays as old as its oldest uncommitted version
+		queued = cur.Queued
+	}
+	err := j.append(writeBackEntry{
+		Bucket: oi.Bucket,
+		Object: oi.Name,
+		ETag:   oi.ETag,
+		Size:   oi.Size,
+		Queued: queued,
+	})
+	if err == nil {
+		j.notify()
+	}
+	return err
+}
+
+// addMissing records oi unless the journal already holds this version of it.
+func (j *writeBackJournal) addMissing(oi ObjectInfo) error {
+	j.Lock()
+	cur, ok := j.entries[pathJoin(oi.Bucket, oi.Name)]
+	journaled := ok && cur.ETag == oi.ETag
+	j.Unlock()
+	if journaled {
+		return nil
+	}
+	return j.add(oi)
+}
+
+// pending returns true when bucket/object waits to be committed, dead-lettered
+// objects included.
+func (j *writeBackJournal) pending(bucket, object string) bool {
+	j.Lock()
+	defer j.Unlock()
+	_, ok := j.entries[pathJoin(bucket, object)]
+	return ok
+}
+
+// remove drops the entry of bucket/object, for any version when etag is empty.
+func (j *writeBackJournal) remove(bucket, object, etag string) error {
+	j.Lock()
+	defer j.Unlock()
+	cur, ok := j.entries[pathJoin(bucket, object)]
+	if !ok || (etag != "" && cur.ETag != etag) {
+		return nil
+	}
+	return j.append(writeBackEntry{Bucket: bucket, Object: object, ETag: cur.ETag, Removed: true})
+}
+
+// failed records a failed upload of e, the entry is retried after a bounded
+// exponential delay or dead-lettered after writeBackMaxRetries attempts. It
+// returns the updated entry.
+func (j *writeBackJournal) failed(e writeBackEntry, uploadErr error) (writeBackEntry, error) {
+	j.Lock()
+	defer j.Unlock()
+	cur, ok := j.entries[e.key()]
+	if !ok || cur.ETag != e.ETag {
+		return e, nil
+	}
+	cur.inflight = false
+	next := *cur
+	next.Retries++
+	next.LastError = uploadErr.Error()
+	next.NextAttempt = time.Now().UTC().Add(writeBackRetryDelay(next.Retries))
+	next.Dead = next.Retries >= writeBackMaxRetries
+	if err := j.append(next); err != nil {
+		return next, err
+	}
+	// the dispatcher waits for the retry from now on.
+	j.notify()
+	return next, nil
+}
+
+// nextRetry returns when the earliest failed upload waiting for a retry is
+// due, ok is false when no upload waits.
+func (j *writeBackJournal) nextRetry() (next time.Time, ok bool) {
+	j.Lock()
+	defer j.Unlock()
+	for _, e := range j.entries {
+		if e.inflight || e.Dead || e.NextAttempt.IsZero() {
+			continue
+		}
+		if !ok || e.NextAttempt.Before(next) {
+			next, ok = e.NextAttempt, true
+		}
+	}
+	return next, ok
+}
+
+// due marks the entries ready for an upload at now as in flight and returns
+// them. Without force they are only returned once there are min of them.
+func (j *writeBackJournal) due(now time.Time, min int, force bool) []writeBackEntry {
+	j.Lock()
+	defer j.Unlock()
+	if !force && len(j.entries) < min {
+		return nil
+	}
+	var ready []*writeBackEntry
+	for _, e := range j.entries {
+		if e.inflight || e.Dead || e.NextAttempt.After(now) {
+			continue
+		}
+		ready = append(ready, e)
+	}
+	if len(ready) == 0 || (!force && len(ready) < min) {
+		return nil
+	}
+	entries := make([]writeBackEntry, len(ready))
+	for i, e := range ready {
+		e.inflight = true
+		entries[i] = *e
+	}
+	return entries
+}
+
+// matches returns true when e is an object of bucket under prefix, every
+// object matches an empty bucket.
+func (e *writeBackEntry) matches(bucket, prefix string) bool {
+	if bucket == "" {
+		return true
+	}
+	return e.Bucket == bucket && strings.HasPrefix(e.Object, prefix)
+}
+
+// list returns the entries of bucket/prefix sorted by name.
+func (j *writeBackJournal) list(bucket, prefix string) []writeBackEntry {
+	j.Lock()
+	defer j.Unlock()
+	var entries []writeBackEntry
+	for _, e := range j.entries {
+		if e.matches(bucket, prefix) {
+			entries = append(entries, *e)
+		}
+	}
+	sort.Slice(entries, func(i, k int) bool {
+		return entries[i].key() < entries[k].key()
+	})
+	return entries
+}
+
+// flush makes the entries of bucket/prefix due at once, dead-lettered ones
+// are given writeBackMaxRetries attempts again. It returns the number of
+// entries to be dispatched.
+func (j *writeBackJournal) flush(bucket, prefix string) (int, error) {
+	j.Lock()
+	defer j.Unlock()
+	var flushed []writeBackEntry
+	for _, e := range j.entries {
+		if e.inflight || !e.matches(bucket, prefix) {
+			continue
+		}
+		flushed = append(flushed, *e)
+	}
+	for _, e := range flushed {
+		if e.NextAttempt.IsZero() && !e.Dead {
+			continue
+		}
+		e.NextAttempt = time.Time{}
+		if e.Dead {
+			e.Dead = false
+			e.Retries = 0
+		}
+		if err := j.append(e); err != nil {
+			return 0, err
+		}
+	}
+	select {
+	case j.flushC <- struct{}{}:
+	default:
+	}
+	return len(flushed), nil
+}
+
+// writeBackJournalStats is the state of the write back queue of a cache drive.
+type writeBackJournalStats struct {
+	Pending int
+	Dead    int
+	// Oldest is when the oldest pending object was queued.
+	Oldest time.Time
+}
+
+func (j *writeBackJournal) stats() (s writeBackJournalStats) {
+	j.Lock()
+	defer j.Unlock()
+	for _, e := range j.entries {
+		if e.Dead {
+			s.Dead++
+			continue
+		}
+		s.Pending++
+		if s.Oldest.IsZero() || e.Queued.Before(s.Oldest) {
+			s.Oldest = e.Queued
+		}
+	}
+	return s
+}
+
+// Close closes the journal, later changes fail with errWriteBackJournalClosed.
+func (j *writeBackJournal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteBackRetryDelay(t *testing.T) {
+	testCases := []struct {
+		retries  int
+		expected time.Duration
+	}{
+		{1, writeBackRetryBase},
+		{2, 2 * writeBackRetryBase},
+		{4, 8 * writeBackRetryBase},
+		{writeBackMaxRetries, writeBackRetryMax},
+		{100, writeBackRetryMax},
+	}
+	for _, tc := range testCases {
+		if d := writeBackRetryDelay(tc.retries); d != tc.expected {
+			t.Errorf("retries %d: expected %s, got %s", tc.retries, tc.expected, d)
+		}
+	}
+}
+
+func TestWriteBackJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal", writeBackJournalFile)
+	j, err := openWriteBackJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err = j.add(ObjectInfo{Bucket: "bucket", Name: name, ETag: "etag-" + name, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = j.remove("bucket", "a", "etag-a"); err != nil {
+		t.Fatal(err)
+	}
+	// a stale etag leaves the entry in place.
+	if err = j.remove("bucket", "b", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	e := *j.entries["bucket/c"]
+	for i := 0; i < writeBackMaxRetries; i++ {
+		if e, err = j.failed(e, errors.New("backend down")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !e.Dead || e.Retries != writeBackMaxRetries || e.LastError != "backend down" {
+		t.Fatalf("Expected c to be dead-lettered, got %+v", e)
+	}
+	j.Close()
+
+	// Simulate a crash in the middle of a record.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"bucket":"bucket","object":"d"`)
+	f.Close()
+
+	j, err = openWriteBackJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if len(j.entries) != 2 || j.entries["bucket/b"] == nil || j.entries["bucket/c"] == nil {
+		t.Fatalf("Expected b and c to be replayed, got %v", j.entries)
+	}
+	s := j.stats()
+	if s.Pending != 1 || s.Dead != 1 || s.Oldest.IsZero() {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+
+	// Dead entries are never due, the others only once min of them are ready.
+	if due := j.due(time.Now(), 2, false); len(due) != 0 {
+		t.Fatalf("Expected no due entries below the threshold, got %v", due)
+	}
+	due := j.due(time.Now(), 2, true)
+	if len(due) != 1 || due[0].Object != "b" {
+		t.Fatalf("Expected b to be due, got %v", due)
+	}
+	b := due[0]
+	// In flight entries are not handed out twice.
+	if due = j.due(time.Now(), 0, true); len(due) != 0 {
+		t.Fatalf("Expected no due entries, got %v", due)
+	}
+	select {
+	case <-j.notifyC:
+	default:
+	}
+	next, err := j.failed(b, errors.New("timeout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due = j.due(time.Now(), 0, true); len(due) != 0 {
+		t.Fatalf("Expected b to wait for its retry, got %v", due)
+	}
+	// the dispatcher is woken up to wait for the retry.
+	select {
+	case <-j.notifyC:
+	default:
+		t.Fatal("Expected the failure to notify the dispatcher")
+	}
+	if at, ok := j.nextRetry(); !ok || !at.Equal(next.NextAttempt) {
+		t.Fatalf("Expected the next retry at %v, got %v", next.NextAttempt, at)
+	}
+	if due = j.due(next.NextAttempt, 0, true); len(due) != 1 {
+		t.Fatalf("Expected b to be due for a retry, got %v", due)
+	}
+}
+
+func TestWriteBackJournalFlush(t *testing.T) {
+	j, err := openWriteBackJournal(filepath.Join(t.TempDir(), writeBackJournalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for _, oi := range []ObjectInfo{
+		{Bucket: "bucket", Name: "dir/b", ETag: "1"},
+		{Bucket: "bucket", Name: "dir/a", ETag: "2"},
+		{Bucket: "bucket", Name: "other", ETag: "3"},
+		{Bucket: "archive", Name: "dir/a", ETag: "4"},
+	} {
+		if err = j.add(oi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := j.list("bucket", "dir/")
+	if len(entries) != 2 || entries[0].Object != "dir/a" || entries[1].Object != "dir/b" {
+		t.Fatalf("Expected bucket/dir/a and bucket/dir/b, got %v", entries)
+	}
+	if entries = j.list("", ""); len(entries) != 4 {
+		t.Fatalf("Expected all 4 entries, got %v", entries)
+	}
+
+	e := *j.entries["bucket/dir/a"]
+	for i := 0; i < writeBackMaxRetries; i++ {
+		if e, err = j.failed(e, errors.New("backend down")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = j.failed(*j.entries["bucket/dir/b"], errors.New("backend down")); err != nil {
+		t.Fatal(err)
+	}
+	if due := j.due(time.Now(), 0, true); len(due) != 2 {
+		t.Fatalf("Expected the 2 entries outside bucket/dir/ to be due, got %v", due)
+	}
+
+	flushed, err := j.flush("bucket", "dir/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed != 2 {
+		t.Fatalf("Expected 2 flushed entries, got %d", flushed)
+	}
+	if a := j.entries["bucket/dir/a"]; a.Dead || a.Retries != 0 {
+		t.Fatalf("Expected bucket/dir/a to be requeued, got %+v", a)
+	}
+	if b := j.entries["bucket/dir/b"]; b.Retries != 1 || b.LastError == "" {
+		t.Fatalf("Expected bucket/dir/b to keep its retries, got %+v", b)
+	}
+	if due := j.due(time.Now(), 0, true); len(due) != 2 {
+		t.Fatalf("Expected the flushed entries to be due, got %v", due)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	cachePinsFile    = "cache-pins.json"
+	cachePinsVersion = 1
+)
+
+// CachePin is a bucket prefix whose objects are never evicted from the disk
+// cache, an object is pinned with its full name as prefix.
+type CachePin struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+func (p CachePin) matches(bucket, object string) bool {
+	return p.Bucket == bucket && strings.HasPrefix(object, p.Prefix)
+}
+
+// cachePinsV1 is the content of the pins file of a cache drive.
+type cachePinsV1 struct {
+	Version int        `json:"version"`
+	Pins    []CachePin `json:"pins"`
+}
+
+// cachePins holds the pins of a cache drive, they are persisted in
+// .minio.sys/cache-pins.json so they survive restarts.
+type cachePins struct {
+	sync.RWMutex
+	path string
+	pins []CachePin
+}
+
+// loadCachePins reads the pins saved at path, a missing file holds no pins.
+func loadCachePins(path string) (*cachePins, error) {
+	p := &cachePins{path: path}
+	data, err := os.ReadFile(path)
+	if osIsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v cachePinsV1
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.Version != cachePinsVersion {
+		return nil, fmt.Errorf("unknown cache pins version %d", v.Version)
+	}
+	p.pins = v.Pins
+	return p, nil
+}
+
+// pinned reports whether object of bucket is pinned, it is safe to call on
+// a nil cachePins.
+func (p *cachePins) pinned(bucket, object string) bool {
+	if p == nil {
+		return false
+	}
+	p.RLock()
+	defer p.RUnlock()
+	for _, pin := range p.pins {
+		if pin.matches(bucket, object) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the pins ordered by bucket and prefix.
+func (p *cachePins) list() []CachePin {
+	p.RLock()
+	defer p.RUnlock()
+	return append([]CachePin{}, p.pins...)
+}
+
+// add pins the given prefixes, it reports whether any of them was new.
+func (p *cachePins) add(pins ...CachePin) (bool, error) {
+	p.Lock()
+	defer p.Unlock()
+	var added bool
+	for _, pin := range pins {
+		i := sort.Search(len(p.pins), func(i int) bool {
+			return !cachePinLess(p.pins[i], pin)
+		})
+		if i < len(p.pins) && p.pins[i] == pin {
+			continue
+		}
+		p.pins = append(p.pins, CachePin{})
+		copy(p.pins[i+1:], p.pins[i:])
+		p.pins[i] = pin
+		added = true
+	}
+	if !added {
+		return false, nil
+	}
+	return true, p.save()
+}
+
+// remove unpins pin, it reports whether it was pinned.
+func (p *cachePins) remove(pin CachePin) (bool, error) {
+	p.Lock()
+	defer p.Unlock()
+	for i := range p.pins {
+		if p.pins[i] == pin {
+			p.pins = append(p.pins[:i], p.pins[i+1:]...)
+			return true, p.save()
+		}
+	}
+	return false, nil
+}
+
+// save writes the pins to a temporary file renamed over the previous one,
+// p must be locked.
+func (p *cachePins) save() error {
+	data, err := json.Marshal(cachePinsV1{Version: cachePinsVersion, Pins: p.pins})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p.path), 0o777); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+func cachePinLess(a, b CachePin) bool {
+	if a.Bucket != b.Bucket {
+		return a.Bucket < b.Bucket
+	}
+	return a.Prefix < b.Prefix
+}
@@ -0,0 +1,386 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	objectlock "github.com/minio/minio/internal/bucket/object/lock"
+	"github.com/minio/minio/internal/logger"
+)
+
+// number of backend objects listed at once by a pre-warm.
+const cachePrewarmListKeys = 1000
+
+// Status values of CachePrewarmInfo.
+const (
+	CachePrewarmRunning  = "running"
+	CachePrewarmDone     = "done"
+	CachePrewarmCanceled = "canceled"
+	CachePrewarmFailed   = "failed"
+)
+
+// CachePrewarmInfo is the progress of the pre-warm of a bucket prefix,
+// objects are skipped when already cached or not cacheable.
+type CachePrewarmInfo struct {
+	Bucket   string    `json:"bucket"`
+	Prefix   string    `json:"prefix,omitempty"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Objects  int64     `json:"objects"`
+	Cached   int64     `json:"cached"`
+	Skipped  int64     `json:"skipped"`
+	Failed   int64     `json:"failed"`
+	Bytes    int64     `json:"bytes"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// cachePrewarm is a pre-warm running in the background.
+type cachePrewarm struct {
+	sync.Mutex
+	info   CachePrewarmInfo
+	cancel context.CancelFunc
+}
+
+func (p *cachePrewarm) status() CachePrewarmInfo {
+	p.Lock()
+	defer p.Unlock()
+	return p.info
+}
+
+func (p *cachePrewarm) update(size int64, cached bool, err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.info.Objects++
+	switch {
+	case err != nil:
+		p.info.Failed++
+	case cached:
+		p.info.Cached++
+		p.info.Bytes += size
+	default:
+		p.info.Skipped++
+	}
+}
+
+func (p *cachePrewarm) finish(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.info.Finished = UTCNow()
+	switch {
+	case errors.Is(err, context.Canceled):
+		p.info.Status = CachePrewarmCanceled
+	case err != nil:
+		p.info.Status = CachePrewarmFailed
+		p.info.Error = err.Error()
+	default:
+		p.info.Status = CachePrewarmDone
+	}
+}
+
+// PrewarmCache fetches the objects of bucket/prefix from the backend into the
+// cache in the background, regardless of their number of accesses. A
+// pre-warm of the same prefix already running is returned as is.
+func (c *cacheObjects) PrewarmCache(bucket, prefix string) CachePrewarmInfo {
+	key := pathJoin(bucket, prefix)
+	c.prewarmMu.Lock()
+	defer c.prewarmMu.Unlock()
+	if p, ok := c.prewarms[key]; ok {
+		if info := p.status(); info.Status == CachePrewarmRunning {
+			return info
+		}
+	}
+	if c.prewarms == nil {
+		c.prewarms = make(map[string]*cachePrewarm)
+	}
+	ctx, cancel := context.WithCancel(GlobalContext)
+	p := &cachePrewarm{
+		info: CachePrewarmInfo{
+			Bucket:  bucket,
+			Prefix:  prefix,
+			Status:  CachePrewarmRunning,
+			Started: UTCNow(),
+		},
+		cancel: cancel,
+	}
+	c.prewarms[key] = p
+	go c.prewarm(ctx, p)
+	return p.status()
+}
+
+// CachePrewarms returns the pre-warms of bucket/prefix started since the
+// server started, ordered by bucket and prefix. An empty bucket returns them
+// all.
+func (c *cacheObjects) CachePrewarms(bucket, prefix string) []CachePrewarmInfo {
+	c.prewarmMu.Lock()
+	defer c.prewarmMu.Unlock()
+	infos := []CachePrewarmInfo{}
+	for _, p := range c.prewarms {
+		info := p.status()
+		if bucket != "" && (info.Bucket != bucket || !strings.HasPrefix(info.Prefix, prefix)) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return cachePinLess(CachePin{infos[i].Bucket, infos[i].Prefix}, CachePin{infos[j].Bucket, infos[j].Prefix})
+	})
+	return infos
+}
+
+// CancelPrewarm stops the pre-warm of bucket/prefix, objects already fetched
+// stay cached.
+func (c *cacheObjects) CancelPrewarm(bucket, prefix string) (CachePrewarmInfo, error) {
+	c.prewarmMu.Lock()
+	p, ok := c.prewarms[pathJoin(bucket, prefix)]
+	c.prewarmMu.Unlock()
+	if !ok {
+		return CachePrewarmInfo{}, errCachePrewarmNotFound
+	}
+	p.cancel()
+	// wait for the object being fetched.
+	for p.status().Status == CachePrewarmRunning {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return p.status(), nil
+}
+
+func (c *cacheObjects) prewarm(ctx context.Context, p *cachePrewarm) {
+	defer p.cancel()
+	bucket, prefix := p.info.Bucket, p.info.Prefix
+	var marker string
+	for {
+		loi, err := c.InnerListObjectsFn(ctx, bucket, prefix, marker, "", cachePrewarmListKeys)
+		if err != nil {
+			p.finish(err)
+			return
+		}
+		for _, oi := range loi.Objects {
+			if err = ctx.Err(); err != nil {
+				p.finish(err)
+				return
+			}
+			cached, err := c.prewarmObject(ctx, oi)
+			if ctx.Err() != nil {
+				p.finish(ctx.Err())
+				return
+			}
+			p.update(oi.Size, cached, err)
+			if errors.Is(err, errDiskFull) {
+				// the remaining objects would not fit either.
+				p.finish(err)
+				return
+			}
+			if err != nil {
+				reqInfo := (&logger.ReqInfo{}).AppendTags("object", pathJoin(bucket, oi.Name))
+				logger.LogIf(logger.SetReqInfo(ctx, reqInfo), err)
+			}
+		}
+		if !loi.IsTruncated || len(loi.Objects) == 0 {
+			break
+		}
+		marker = loi.NextMarker
+		if marker == "" {
+			marker = loi.Objects[len(loi.Objects)-1].Name
+		}
+	}
+	p.finish(ctx.Err())
+}
+
+// prewarmObject caches the backend object oi, it reports false for objects
+// already cached or not cacheable.
+func (c *cacheObjects) prewarmObject(ctx context.Context, oi ObjectInfo) (bool, error) {
+	if strings.HasSuffix(oi.Name, SlashSeparator) || c.isCacheExclude(oi.Bucket, oi.Name) ||
+		oi.Size > c.maxCacheFileSize || !oi.IsCacheable() {
+		return false, nil
+	}
+	objRetention := objectlock.GetObjectRetentionMeta(oi.UserDefined)
+	legalHold := objectlock.GetObjectLegalHoldMeta(oi.UserDefined)
+	if objRetention.Mode.Valid() || legalHold.Status.Valid() {
+		return false, nil
+	}
+	dcache, err := c.getCacheToLoc(ctx, oi.Bucket, oi.Name)
+	if err != nil {
+		return false, err
+	}
+	if cached, _, err := dcache.Stat(ctx, oi.Bucket, oi.Name); err == nil &&
+		(cached.ETag == oi.ETag || writebackInProgress(cached.UserDefined)) {
+		// objects not committed yet are newer than their backend copy.
+		return false, nil
+	}
+	bReader, err := c.InnerGetObjectNInfoFn(ctx, oi.Bucket, oi.Name, nil, http.Header{}, readLock, ObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer bReader.Close()
+	return dcache.Prewarm(ctx, oi.Bucket, oi.Name, bReader, bReader.ObjInfo.Size, ObjectOptions{
+		UserDefined: getMetadata(bReader.ObjInfo),
+	})
+}
+
+// PinCache pins the objects of bucket/prefix on all cache drives, purge
+// never evicts them until they are stale.
+func (c *cacheObjects) PinCache(bucket, prefix string) error {
+	for _, dcache := range c.cache {
+		if dcache == nil {
+			continue
+		}
+		if _, err := dcache.pins.add(CachePin{Bucket: bucket, Prefix: prefix}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnpinCache removes the pin of bucket/prefix, its objects are evicted like
+// the others again.
+func (c *cacheObjects) UnpinCache(bucket, prefix string) error {
+	var found bool
+	for _, dcache := range c.cache {
+		if dcache == nil {
+			continue
+		}
+		removed, err := dcache.pins.remove(CachePin{Bucket: bucket, Prefix: prefix})
+		if err != nil {
+			return err
+		}
+		found = found || removed
+	}
+	if !found {
+		return errCachePinNotFound
+	}
+	return nil
+}
+
+// CachePins returns the pins ordered by bucket and prefix.
+func (c *cacheObjects) CachePins() []CachePin {
+	for _, dcache := range c.cache {
+		if dcache != nil {
+			return dcache.pins.list()
+		}
+	}
+	return []CachePin{}
+}
+
+// syncCachePins gives every cache drive the pins of the others, so pins
+// survive a drive replacement.
+func (c *cacheObjects) syncCachePins(ctx context.Context) {
+	var pins []CachePin
+	for _, dcache := range c.cache {
+		if dcache != nil {
+			pins = append(pins, dcache.pins.list()...)
+		}
+	}
+	for _, dcache := range c.cache {
+		if dcache != nil {
+			_, err := dcache.pins.add(pins...)
+			logger.LogIf(ctx, err)
+		}
+	}
+}
+
+// CacheResidencyInfo is the disk cache usage of the objects under a prefix.
+// Objects are resident once fully cached, the others only have ranges cached
+// or are tracked with their number of accesses until MINIO_CACHE_AFTER.
+type CacheResidencyInfo struct {
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"`
+	Resident int64  `json:"resident"`
+	Size     int64  `json:"size"`
+	Ranges   int64  `json:"ranges"`
+	Tracked  int64  `json:"tracked"`
+	Hits     int64  `json:"hits"`
+	Pinned   int64  `json:"pinned"`
+}
+
+// CacheResidency reports the cache usage of the objects under bucket/prefix,
+// grouped by the prefixes ending at the next delimiter. Objects without one
+// are reported under prefix itself, all objects of a bucket are grouped
+// under it when the bucket is empty.
+func (c *cacheObjects) CacheResidency(ctx context.Context, bucket, prefix, delimiter string) ([]CacheResidencyInfo, error) {
+	residency := make(map[CachePin]*CacheResidencyInfo)
+	for _, dcache := range c.cache {
+		if dcache == nil || !dcache.IsOnline() {
+			continue
+		}
+		filterFn := func(name string, typ os.FileMode) error {
+			if name == minioMetaBucket {
+				// Proceed to next file.
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			meta, partial, numHits, err := dcache.statCachedMeta(ctx, pathJoin(dcache.dir, name))
+			if err != nil || meta.Bucket == "" {
+				// Proceed to next file.
+				return nil
+			}
+			group := CachePin{Bucket: meta.Bucket}
+			if bucket != "" {
+				if meta.Bucket != bucket || !strings.HasPrefix(meta.Object, prefix) {
+					return nil
+				}
+				group.Prefix = prefix
+				if delimiter != "" {
+					if i := strings.Index(meta.Object[len(prefix):], delimiter); i >= 0 {
+						group.Prefix = meta.Object[:len(prefix)+i+len(delimiter)]
+					}
+				}
+			}
+			info, ok := residency[group]
+			if !ok {
+				info = &CacheResidencyInfo{Bucket: group.Bucket, Prefix: group.Prefix}
+				residency[group] = info
+			}
+			switch {
+			case !partial:
+				info.Resident++
+				info.Size += meta.Stat.Size
+			case len(meta.Ranges) > 0:
+				info.Ranges++
+			default:
+				info.Tracked++
+			}
+			info.Hits += int64(numHits)
+			if dcache.pins.pinned(meta.Bucket, meta.Object) {
+				info.Pinned++
+			}
+			return nil
+		}
+		if err := readDirFn(dcache.dir, filterFn); err != nil {
+			return nil, err
+		}
+	}
+	infos := make([]CacheResidencyInfo, 0, len(residency))
+	for _, info := range residency {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return cachePinLess(CachePin{infos[i].Bucket, infos[i].Prefix}, CachePin{infos[j].Bucket, infos[j].Prefix})
+	})
+	return infos, nil
+}
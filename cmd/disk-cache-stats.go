@@ -19,6 +19,7 @@ package cmd
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 // CacheDiskStats represents cache disk statistics
@@ -33,6 +34,15 @@ type CacheDiskStats struct {
 	// indicates the current usage percentage of this cache disk
 	UsagePercent uint64
 	Dir          string
+	// WriteBack is set when objects are committed to the backend
+	// asynchronously, the WriteBack fields are only set then.
+	WriteBack bool
+	// number of objects waiting to be committed to the backend
+	WriteBackPending int
+	// number of objects that failed all their write back attempts
+	WriteBackFailed int
+	// time the oldest object waiting to be committed was cached
+	WriteBackOldest time.Time
 }
 
 // GetUsageLevelString gets the string representation for the usage level.
@@ -26,6 +26,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +41,7 @@ import (
 	"github.com/minio/minio/internal/logger"
 	"github.com/minio/minio/internal/sync/errgroup"
 	"github.com/minio/pkg/wildcard"
+	"github.com/minio/sio"
 	art "github.com/plar/go-adaptive-radix-tree"
 )
 
@@ -99,10 +101,26 @@ type CacheObjectLayer interface {
 	AbortMultipartUpload(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) error
 	CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, uploadedParts []CompletePart, opts ObjectOptions) (objInfo ObjectInfo, err error)
 	CopyObjectPart(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject, uploadID string, partID int, startOffset int64, length int64, srcInfo ObjectInfo, srcOpts, dstOpts ObjectOptions) (pi PartInfo, e error)
+	GetMultipartInfo(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) (info MultipartInfo, err error)
+	ListObjectParts(ctx context.Context, bucket, object, uploadID string, partNumberMarker int, maxParts int, opts ObjectOptions) (result ListPartsInfo, err error)
 
 	// Storage operations.
 	StorageInfo(ctx context.Context) CacheStorageInfo
 	CacheStats() *CacheStats
+
+	// Write back operations.
+	WriteBackObjects(bucket, prefix string) ([]WriteBackObjectInfo, error)
+	FlushWriteBack(bucket, prefix string) (int, error)
+	WaitWriteBack(ctx context.Context, bucket, prefix string) error
+
+	// Pre-warm and pinning operations.
+	PrewarmCache(bucket, prefix string) CachePrewarmInfo
+	CachePrewarms(bucket, prefix string) []CachePrewarmInfo
+	CancelPrewarm(bucket, prefix string) (CachePrewarmInfo, error)
+	PinCache(bucket, prefix string) error
+	UnpinCache(bucket, prefix string) error
+	CachePins() []CachePin
+	CacheResidency(ctx context.Context, bucket, prefix, delimiter string) ([]CacheResidencyInfo, error)
 }
 
 // Abstracts disk caching - used by the S3 layer
@@ -123,18 +141,22 @@ type cacheObjects struct {
 	contentSearchEnable string
 	// if true migration is in progress from v1 to v2
 	migrating bool
-	// retry queue for writeback cache mode to reattempt upload to backend
-	wbRetryCh chan ObjectInfo
 	// Cache stats
 	cacheStats *CacheStats
 
 	//listTree                art.Tree
-	listTree                *ThreadSafeListTree
-	writeBackUploadBufferCh chan ObjectInfo
-	writeBackInputCh        chan ObjectInfo
+	listTree *ThreadSafeListTree
+	// interval at which all due writeback uploads are dispatched
+	wbInterval time.Duration
+	// writeback uploads handed to the upload workers
+	writeBackUploadCh chan writeBackUpload
+	// pre-warms started since the server started, by bucket/prefix.
+	prewarmMu sync.Mutex
+	prewarms  map[string]*cachePrewarm
 
 	InnerGetObjectNInfoFn          func(ctx context.Context, bucket, object string, rs *HTTPRangeSpec, h http.Header, lockType LockType, opts ObjectOptions) (gr *GetObjectReader, err error)
 	InnerGetObjectInfoFn           func(ctx context.Context, bucket, object string, opts ObjectOptions) (objInfo ObjectInfo, err error)
+	InnerListObjectsFn             func(ctx context.Context, bucket, prefix, marker, delimiter string, maxKeys int) (result ListObjectsInfo, err error)
 	InnerDeleteObjectFn            func(ctx context.Context, bucket, object string, opts ObjectOptions) (objInfo ObjectInfo, err error)
 	InnerPutObjectFn               func(ctx context.Context, bucket, object string, data *PutObjReader, opts ObjectOptions) (objInfo ObjectInfo, err error)
 	InnerCopyObjectFn              func(ctx context.Context, srcBucket, srcObject, destBucket, destObject string, srcInfo ObjectInfo, srcOpts, dstOpts ObjectOptions) (objInfo ObjectInfo, err error)
@@ -143,6 +165,8 @@ type cacheObjects struct {
 	InnerAbortMultipartUploadFn    func(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) error
 	InnerCompleteMultipartUploadFn func(ctx context.Context, bucket, object, uploadID string, uploadedParts []CompletePart, opts ObjectOptions) (objInfo ObjectInfo, err error)
 	InnerCopyObjectPartFn          func(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject, uploadID string, partID int, startOffset int64, length int64, srcInfo ObjectInfo, srcOpts, dstOpts ObjectOptions) (pi PartInfo, e error)
+	InnerGetMultipartInfoFn        func(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) (info MultipartInfo, err error)
+	InnerListObjectPartsFn         func(ctx context.Context, bucket, object, uploadID string, partNumberMarker int, maxParts int, opts ObjectOptions) (result ListPartsInfo, err error)
 }
 
 func (c *cacheObjects) incHitsToMeta(ctx context.Context, dcache *diskCache, bucket, object string, size int64, eTag string, rs *HTTPRangeSpec) error {
@@ -530,76 +554,48 @@ func (c *cacheObjects) CopyObject(ctx context.Context, srcBucket, srcObject, dst
 
 // ListObjects from disk cache
 func (c *cacheObjects) ListObjects(ctx context.Context, bucket, prefix, marker, delimiter string, maxKeys int) (result ListObjectsInfo, err error) {
-	log.Printf("listobject cache prefix %s marker %s delim %s maxkey %d \n", prefix, marker, delimiter, maxKeys)
-	objInfos := []ObjectInfo{}
-	prefixes := map[string]bool{}
-
-	if marker != "" {
-		// Marker not common with prefix is not implemented. Send an empty response
-		if !HasPrefix(marker, prefix) {
-			return ListObjectsInfo{}, nil
-		}
-	}
-
-	if maxKeys == 0 {
-		return ListObjectsInfo{}, nil
-	}
-	if delimiter == "" {
-		delimiter = SlashSeparator
-	}
-	if delimiter == SlashSeparator && prefix == SlashSeparator {
-		return ListObjectsInfo{}, nil
+	if maxKeys <= 0 {
+		return result, nil
 	}
-	// for prefix add trailing slash
-	if prefix != "" {
-		if !strings.HasSuffix(prefix, "/") {
-			prefix = prefix + "/"
-		}
-	}
-	rootprefix := bucket + "/" + prefix
-	rootMarker := bucket + "/" + marker
-	objectCount := 0
+	bucketPrefix := bucket + SlashSeparator
 	leafFilter := func(n art.Node) bool {
-		if n.Kind() == art.Leaf {
-			if strings.HasPrefix(string(n.Key()), rootprefix) {
-				if marker == "" || string(n.Key()) > rootMarker {
-					trimmed := strings.TrimPrefix(string(n.Key()), rootprefix)
-					parts := strings.Split(trimmed, delimiter)
-					if len(parts) > 0 && parts[0] != "" {
-						if (len(objInfos) + len(prefixes)) < maxKeys {
-							if len(parts) == 1 {
-								ob, ok := n.Value().(ObjectInfo)
-								if ok {
-									objInfos = append(objInfos, ob)
-								}
-							} else if delimiter != "" {
-								dir := prefix + parts[0] + delimiter
-								if marker == "" || dir > marker {
-									prefixes[dir] = true
-								}
-							}
-						}
-					}
-					objectCount++
+		if n.Kind() != art.Leaf {
+			return true
+		}
+		name := strings.TrimPrefix(string(n.Key()), bucketPrefix)
+		if name <= marker {
+			return true
+		}
+		var dir string
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				dir = name[:len(prefix)+i+len(delimiter)]
+				if dir <= marker || dir == result.NextMarker {
+					// the objects of a listed common prefix are skipped.
+					return true
 				}
 			}
 		}
+		if len(result.Objects)+len(result.Prefixes) == maxKeys {
+			result.IsTruncated = true
+			return false
+		}
+		if dir != "" {
+			result.Prefixes = append(result.Prefixes, dir)
+			result.NextMarker = dir
+			return true
+		}
+		if oi, ok := n.Value().(ObjectInfo); ok {
+			result.Objects = append(result.Objects, oi)
+			result.NextMarker = name
+		}
 		return true
 	}
-	c.prefixSearch(rootprefix, leafFilter)
-	var uPrefixes []string
-	for key := range prefixes {
-		uPrefixes = append(uPrefixes, key)
-	}
-	isTruncated := false
-	if objectCount > maxKeys {
-		isTruncated = true
+	c.prefixSearch(bucketPrefix+prefix, leafFilter)
+	if !result.IsTruncated {
+		result.NextMarker = ""
 	}
-	return ListObjectsInfo{
-		Objects:     objInfos,
-		Prefixes:    unique(uPrefixes),
-		IsTruncated: isTruncated,
-	}, nil
+	return result, nil
 }
 
 func (c *cacheObjects) prefixSearch(rootprefix string, leafFilter art.Callback) {
@@ -654,18 +650,6 @@ func getCacheStat(cacheObjPath string) (meta *cacheMeta, partial bool, numHits i
 	return meta, partial, meta.Hits, nil
 }
 
-func unique(items []string) []string {
-	keys := make(map[string]bool)
-	var list []string
-	for _, entry := range items {
-		if _, value := keys[entry]; !value {
-			keys[entry] = true
-			list = append(list, entry)
-		}
-	}
-	return list
-}
-
 // StorageInfo - returns underlying storage statistics.
 func (c *cacheObjects) StorageInfo(ctx context.Context) (cInfo CacheStorageInfo) {
 	var total, free uint64
@@ -873,19 +857,27 @@ func (c *cacheObjects) PutObject(ctx context.Context, bucket, object string, r *
 		log.Println("uploading backend as cache exclude")
 		return putObjectFn(ctx, bucket, object, r, opts)
 	}
+	if c.commitWriteback && dcache.wbJournal.full() {
+		// the writeback queue of the drive is full, the client waits on
+		// the backend until it drains.
+		log.Println("uploading to backend as the writeback queue is full")
+		dcache.Delete(ctx, bucket, object)
+		return putObjectFn(ctx, bucket, object, r, opts)
+	}
 	if c.commitWriteback {
 		log.Println("uploading to cache writeback", object)
 		oi, err := dcache.Put(ctx, bucket, object, r, r.Size(), nil, opts, false, true)
 		if err != nil {
 			return ObjectInfo{}, err
 		}
+		// the object is only acknowledged once journaled, so its upload
+		// survives restarts.
+		if err = dcache.wbJournal.add(oi); err != nil {
+			dcache.Delete(ctx, bucket, object)
+			return ObjectInfo{}, err
+		}
 		objPath := oi.Bucket + "/" + oi.Name
 		c.listTree.Insert([]byte(objPath), oi)
-		//go c.uploadObject(GlobalContext, oi) // use schedule to upload in batch
-		select {
-		case c.writeBackInputCh <- oi:
-		default:
-		}
 		return oi, nil
 	}
 	if !c.commitWritethrough {
@@ -959,69 +951,118 @@ func (c *cacheObjects) PutObject(ctx context.Context, bucket, object string, r *
 	return info, err
 }
 
-// upload cached object to backend in async commit mode.
-func (c *cacheObjects) uploadObject(ctx context.Context, oi ObjectInfo) {
-	log.Printf("uploading object %s in backend in async commit mode", oi.Name)
-	dcache, err := c.getCacheToLoc(ctx, oi.Bucket, oi.Name)
-	if err != nil {
-		// disk cache could not be located.
-		logger.LogIf(ctx, fmt.Errorf("Could not upload %s/%s to backend: %w", oi.Bucket, oi.Name, err))
+// upload cached object to backend in async commit mode, the outcome is
+// recorded in the writeback journal of dcache.
+func (c *cacheObjects) uploadObject(ctx context.Context, dcache *diskCache, e writeBackEntry) {
+	log.Printf("uploading object %s in backend in async commit mode", e.Object)
+	if !dcache.Exists(ctx, e.Bucket, e.Object) {
+		// the object was removed from the cache since.
+		logger.LogIf(ctx, dcache.wbJournal.remove(e.Bucket, e.Object, e.ETag))
 		return
 	}
-	cReader, _, bErr := dcache.Get(ctx, oi.Bucket, oi.Name, nil, http.Header{}, ObjectOptions{})
-	if bErr != nil {
+	cReader, _, err := dcache.Get(ctx, e.Bucket, e.Object, nil, http.Header{}, ObjectOptions{})
+	if err != nil {
+		c.writeBackFailed(ctx, dcache, e, ObjectInfo{}, err)
 		return
 	}
 	defer cReader.Close()
 
-	if cReader.ObjInfo.ETag != oi.ETag {
+	st := cacheCommitStatus(cReader.ObjInfo.UserDefined[writeBackStatusHeader])
+	if cReader.ObjInfo.ETag != e.ETag || st == CommitComplete || st.String() == "" {
+		// the object was committed or replaced by a newer version since.
+		logger.LogIf(ctx, dcache.wbJournal.remove(e.Bucket, e.Object, e.ETag))
 		return
 	}
-	st := cacheCommitStatus(oi.UserDefined[writeBackStatusHeader])
-	if st == CommitComplete || st.String() == "" {
-		return
+	var objInfo ObjectInfo
+	if len(cReader.ObjInfo.Parts) > 0 {
+		objInfo, err = c.uploadObjectParts(ctx, e, cReader, cReader.ObjInfo.Parts)
+	} else {
+		var hashReader *hash.Reader
+		hashReader, err = hash.NewReader(cReader, e.Size, "", "", e.Size)
+		if err != nil {
+			c.writeBackFailed(ctx, dcache, e, cReader.ObjInfo, err)
+			return
+		}
+		var opts ObjectOptions
+		opts.UserDefined = make(map[string]string)
+		opts.UserDefined[xhttp.ContentMD5] = cReader.ObjInfo.UserDefined["content-md5"]
+		objInfo, err = c.InnerPutObjectFn(ctx, e.Bucket, e.Object, NewPutObjReader(hashReader), opts)
 	}
-	hashReader, err := hash.NewReader(cReader, oi.Size, "", "", oi.Size)
 	if err != nil {
+		c.writeBackFailed(ctx, dcache, e, cReader.ObjInfo, err)
 		return
 	}
-	var opts ObjectOptions
-	opts.UserDefined = make(map[string]string)
-	opts.UserDefined[xhttp.ContentMD5] = oi.UserDefined["content-md5"]
-	objInfo, err := c.InnerPutObjectFn(ctx, oi.Bucket, oi.Name, NewPutObjReader(hashReader), opts)
-	wbCommitStatus := CommitComplete
-	size := objInfo.Size
-	if err != nil {
-		wbCommitStatus = CommitFailed
-	}
 	meta := cloneMSS(cReader.ObjInfo.UserDefined)
-	retryCnt := 0
-	if wbCommitStatus == CommitFailed {
-		retryCnt, _ = strconv.Atoi(meta[writeBackRetryHeader])
-		retryCnt++
-		meta[writeBackRetryHeader] = strconv.Itoa(retryCnt)
-		size = cReader.ObjInfo.Size
-	} else {
-		delete(meta, writeBackRetryHeader)
-		c.deleteFromListTree(oi.Bucket + "/" + oi.Name)
-	}
-	meta[writeBackStatusHeader] = wbCommitStatus.String()
-	meta["etag"] = oi.ETag
-	dcache.SaveMetadata(ctx, oi.Bucket, oi.Name, meta, size, nil, "", false, wbCommitStatus == CommitComplete)
-	if retryCnt > 0 {
-		// slow down retries
-		time.Sleep(time.Second * time.Duration(retryCnt%10+1))
-		c.queueWritebackRetry(oi)
-	}
+	delete(meta, writeBackRetryHeader)
+	meta[writeBackStatusHeader] = CommitComplete.String()
+	meta["etag"] = e.ETag
+	// the parts of multipart uploads are already in place.
+	finalizeWB := len(cReader.ObjInfo.Parts) == 0
+	dcache.SaveMetadata(ctx, e.Bucket, e.Object, meta, objInfo.Size, nil, "", false, finalizeWB)
+	logger.LogIf(ctx, dcache.wbJournal.remove(e.Bucket, e.Object, e.ETag))
+	c.deleteFromListTree(e.Bucket + "/" + e.Object)
 	if c.contentSearchEnable == "true" {
 		log.Println("indexing file started")
-		cReader2, _, bErr2 := dcache.Get(ctx, oi.Bucket, oi.Name, nil, http.Header{}, ObjectOptions{})
+		cReader2, _, bErr2 := dcache.Get(ctx, e.Bucket, e.Object, nil, http.Header{}, ObjectOptions{})
 		if bErr2 != nil {
 			return
 		}
 		defer cReader2.Close()
-		c.indexFile(cReader2, oi.Bucket, oi.Name)
+		c.indexFile(cReader2, e.Bucket, e.Object)
+	}
+}
+
+// uploadObjectParts commits the object of e uploaded in parts as a multipart
+// upload of the same parts, so the backend computes the ETag the client was
+// given. r reads the whole object.
+func (c *cacheObjects) uploadObjectParts(ctx context.Context, e writeBackEntry, r io.Reader, parts []ObjectPartInfo) (ObjectInfo, error) {
+	uploadID, err := c.InnerNewMultipartUploadFn(ctx, e.Bucket, e.Object, ObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	uploadedParts := make([]CompletePart, 0, len(parts))
+	for _, part := range parts {
+		size := part.Size
+		if globalCacheKMS != nil {
+			// the sizes of parts encrypted in the cache.
+			plainSize, err := sio.DecryptedSize(uint64(part.ActualSize))
+			if err != nil {
+				logger.LogIf(ctx, c.InnerAbortMultipartUploadFn(ctx, e.Bucket, e.Object, uploadID, ObjectOptions{}))
+				return ObjectInfo{}, err
+			}
+			size = int64(plainSize)
+		}
+		hashReader, err := hash.NewReader(io.LimitReader(r, size), size, "", "", size)
+		if err == nil {
+			var pi PartInfo
+			pi, err = c.InnerPutObjectPartFn(ctx, e.Bucket, e.Object, uploadID, part.Number, NewPutObjReader(hashReader), ObjectOptions{})
+			uploadedParts = append(uploadedParts, CompletePart{PartNumber: pi.PartNumber, ETag: pi.ETag})
+		}
+		if err != nil {
+			logger.LogIf(ctx, c.InnerAbortMultipartUploadFn(ctx, e.Bucket, e.Object, uploadID, ObjectOptions{}))
+			return ObjectInfo{}, err
+		}
 	}
+	return c.InnerCompleteMultipartUploadFn(ctx, e.Bucket, e.Object, uploadID, uploadedParts, ObjectOptions{})
+}
+
+// writeBackFailed records a failed upload of e, it is retried after a delay
+// growing with each attempt until it is dead-lettered.
+func (c *cacheObjects) writeBackFailed(ctx context.Context, dcache *diskCache, e writeBackEntry, oi ObjectInfo, uploadErr error) {
+	next, err := dcache.wbJournal.failed(e, uploadErr)
+	logger.LogIf(ctx, err)
+	if next.Dead {
+		logger.LogIf(ctx, fmt.Errorf("Giving up committing %s/%s to the backend after %d attempts: %w", e.Bucket, e.Object, next.Retries, uploadErr))
+	}
+	if oi.UserDefined == nil || next.Retries == e.Retries {
+		// the object was replaced by a newer version since.
+		return
+	}
+	meta := cloneMSS(oi.UserDefined)
+	meta[writeBackStatusHeader] = CommitFailed.String()
+	meta[writeBackRetryHeader] = strconv.Itoa(next.Retries)
+	meta["etag"] = e.ETag
+	dcache.SaveMetadata(ctx, e.Bucket, e.Object, meta, oi.Size, nil, "", false, false)
 }
 
 func (c *cacheObjects) indexFile(body io.ReadCloser, bucket string, object string) {
@@ -1060,18 +1101,6 @@ func (c *cacheObjects) deleteFromListTree(key string) {
 	c.listTree.Delete([]byte(key))
 }
 
-func (c *cacheObjects) queueWritebackRetry(oi ObjectInfo) {
-	c.uploadObject(GlobalContext, oi)
-	// remove it as wbRetryCh has limited buffer and its not needed
-	// select {
-	// case <-GlobalContext.Done():
-	// 	return
-	// case c.wbRetryCh <- oi:
-	// 	c.uploadObject(GlobalContext, oi)
-	// default:
-	// }
-}
-
 // Returns cacheObjects for use by Server.
 func newServerCacheObjects(ctx context.Context, config cache.Config) (CacheObjectLayer, error) {
 	// list of disk caches for cache "drives" specified in config.json or MINIO_CACHE_DRIVES env var.
@@ -1080,27 +1109,30 @@ func newServerCacheObjects(ctx context.Context, config cache.Config) (CacheObjec
 		return nil, err
 	}
 	c := &cacheObjects{
-		cache:                   cache,
-		exclude:                 config.Exclude,
-		after:                   config.After,
-		migrating:               migrateSw,
-		commitWriteback:         config.CacheCommitMode == CommitWriteBack,
-		commitWritethrough:      config.CacheCommitMode == CommitWriteThrough,
-		maxCacheFileSize:        config.MaxCacheFileSize,
-		uploadWorkers:           config.UploadWorkers,
-		uploadQueueTh:           config.UploadQueueTh,
-		indexSvcUrl:             config.IndexSvcUrl,
-		contentSearchEnable:     config.ContentSearchEnable,
-		cacheStats:              newCacheStats(),
-		listTree:                newThreadSafeListTree(),
-		writeBackUploadBufferCh: make(chan ObjectInfo, 100000),
-		writeBackInputCh:        make(chan ObjectInfo, 100000),
+		cache:               cache,
+		exclude:             config.Exclude,
+		after:               config.After,
+		migrating:           migrateSw,
+		commitWriteback:     config.CacheCommitMode == CommitWriteBack,
+		commitWritethrough:  config.CacheCommitMode == CommitWriteThrough,
+		maxCacheFileSize:    config.MaxCacheFileSize,
+		uploadWorkers:       config.UploadWorkers,
+		uploadQueueTh:       config.UploadQueueTh,
+		indexSvcUrl:         config.IndexSvcUrl,
+		contentSearchEnable: config.ContentSearchEnable,
+		cacheStats:          newCacheStats(),
+		listTree:            NewThreadSafeListTree(),
+		wbInterval:          time.Duration(config.WriteBackInterval) * time.Second,
+		writeBackUploadCh:   make(chan writeBackUpload),
 		InnerGetObjectInfoFn: func(ctx context.Context, bucket, object string, opts ObjectOptions) (ObjectInfo, error) {
 			return newObjectLayerFn().GetObjectInfo(ctx, bucket, object, opts)
 		},
 		InnerGetObjectNInfoFn: func(ctx context.Context, bucket, object string, rs *HTTPRangeSpec, h http.Header, lockType LockType, opts ObjectOptions) (gr *GetObjectReader, err error) {
 			return newObjectLayerFn().GetObjectNInfo(ctx, bucket, object, rs, h, lockType, opts)
 		},
+		InnerListObjectsFn: func(ctx context.Context, bucket, prefix, marker, delimiter string, maxKeys int) (ListObjectsInfo, error) {
+			return newObjectLayerFn().ListObjects(ctx, bucket, prefix, marker, delimiter, maxKeys)
+		},
 		InnerDeleteObjectFn: func(ctx context.Context, bucket, object string, opts ObjectOptions) (ObjectInfo, error) {
 			return newObjectLayerFn().DeleteObject(ctx, bucket, object, opts)
 		},
@@ -1125,6 +1157,12 @@ func newServerCacheObjects(ctx context.Context, config cache.Config) (CacheObjec
 		InnerCopyObjectPartFn: func(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject, uploadID string, partID int, startOffset int64, length int64, srcInfo ObjectInfo, srcOpts, dstOpts ObjectOptions) (pi PartInfo, e error) {
 			return newObjectLayerFn().CopyObjectPart(ctx, srcBucket, srcObject, dstBucket, dstObject, uploadID, partID, startOffset, length, srcInfo, srcOpts, dstOpts)
 		},
+		InnerGetMultipartInfoFn: func(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) (MultipartInfo, error) {
+			return newObjectLayerFn().GetMultipartInfo(ctx, bucket, object, uploadID, opts)
+		},
+		InnerListObjectPartsFn: func(ctx context.Context, bucket, object, uploadID string, partNumberMarker int, maxParts int, opts ObjectOptions) (ListPartsInfo, error) {
+			return newObjectLayerFn().ListObjectParts(ctx, bucket, object, uploadID, partNumberMarker, maxParts, opts)
+		},
 	}
 	c.cacheStats.GetDiskStats = func() []CacheDiskStats {
 		cacheDiskStats := make([]CacheDiskStats, len(c.cache))
@@ -1139,6 +1177,13 @@ func newServerCacheObjects(ctx context.Context, config cache.Config) (CacheObjec
 				cacheDiskStats[i].Dir = dcache.stats.Dir
 				atomic.StoreInt32(&cacheDiskStats[i].UsageState, atomic.LoadInt32(&dcache.stats.UsageState))
 				atomic.StoreUint64(&cacheDiskStats[i].UsagePercent, atomic.LoadUint64(&dcache.stats.UsagePercent))
+				if dcache.wbJournal != nil {
+					wbStats := dcache.wbJournal.stats()
+					cacheDiskStats[i].WriteBack = true
+					cacheDiskStats[i].WriteBackPending = wbStats.Pending
+					cacheDiskStats[i].WriteBackFailed = wbStats.Dead
+					cacheDiskStats[i].WriteBackOldest = wbStats.Oldest
+				}
 			}
 		}
 		return cacheDiskStats
@@ -1146,20 +1191,21 @@ func newServerCacheObjects(ctx context.Context, config cache.Config) (CacheObjec
 	if migrateSw {
 		go c.migrateCacheFromV1toV2(ctx)
 	}
+	c.syncCachePins(ctx)
 	go c.gc(ctx)
 	if c.commitWriteback {
-		c.wbRetryCh = make(chan ObjectInfo, 10000)
-		go func() {
-			<-GlobalContext.Done()
-			close(c.wbRetryCh)
-			close(c.writeBackInputCh)
-		}()
-		go c.queuePendingWriteback(ctx)
+		if c.wbInterval <= 0 {
+			c.wbInterval = time.Minute
+		}
 		go c.recreateListTreeOnStartUp()
 		for i := 0; i < c.uploadWorkers; i++ {
-			go c.uploadToBackendFromCh()
+			go c.uploadToBackendFromCh(ctx)
+		}
+		for _, dcache := range c.cache {
+			if dcache != nil {
+				go c.dispatchWriteBack(ctx, dcache)
+			}
 		}
-		go c.batcher()
 	}
 
 	return c, nil
@@ -1188,30 +1234,174 @@ func (c *cacheObjects) gc(ctx context.Context) {
 	}
 }
 
-func (c *cacheObjects) batcher() {
-	var batch []ObjectInfo
-	for obj := range c.writeBackInputCh {
-		batch = append(batch, obj)
-		if len(batch) >= c.uploadQueueTh {
-			for _, batchItem := range batch {
-				c.writeBackUploadBufferCh <- batchItem
+// writeBackUpload is a journaled object of a cache drive handed to the
+// upload workers.
+type writeBackUpload struct {
+	dcache *diskCache
+	entry  writeBackEntry
+}
+
+// dispatchWriteBack hands the due writeback uploads of dcache to the upload
+// workers as soon as uploadQueueTh of them are waiting, and all of them every
+// writeback interval. The workers being busy holds back the dispatch.
+func (c *cacheObjects) dispatchWriteBack(ctx context.Context, dcache *diskCache) {
+	ticker := time.NewTicker(c.wbInterval)
+	defer ticker.Stop()
+	for {
+		force := false
+		// failed uploads are retried as soon as their delay expired.
+		var retry *time.Timer
+		var retryC <-chan time.Time
+		if next, ok := dcache.wbJournal.nextRetry(); ok {
+			retry = time.NewTimer(time.Until(next))
+			retryC = retry.C
+		}
+		select {
+		case <-ctx.Done():
+			if retry != nil {
+				retry.Stop()
+			}
+			return
+		case <-dcache.wbJournal.notifyC:
+		case <-dcache.wbJournal.flushC:
+			force = true
+		case <-ticker.C:
+			force = true
+		case <-retryC:
+			force = true
+		}
+		if retry != nil {
+			retry.Stop()
+		}
+		for _, e := range dcache.wbJournal.due(time.Now(), c.uploadQueueTh, force) {
+			select {
+			case c.writeBackUploadCh <- writeBackUpload{dcache: dcache, entry: e}:
+			case <-ctx.Done():
+				return
 			}
-			batch = nil // Reset batch
 		}
 	}
+}
 
-	if len(batch) > 0 {
-		for _, batchItem := range batch {
-			c.writeBackUploadBufferCh <- batchItem
+func (c *cacheObjects) uploadToBackendFromCh(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-c.writeBackUploadCh:
+			c.uploadObject(ctx, u.dcache, u.entry)
 		}
 	}
+}
 
-	close(c.writeBackUploadBufferCh)
+// WriteBackObjectInfo is an object of a cache drive not committed to the
+// backend yet.
+type WriteBackObjectInfo struct {
+	Bucket    string    `json:"bucket"`
+	Object    string    `json:"object"`
+	ETag      string    `json:"etag"`
+	Size      int64     `json:"size"`
+	Disk      string    `json:"disk"`
+	Queued    time.Time `json:"queued"`
+	Status    string    `json:"status"`
+	Retries   int       `json:"retries"`
+	LastError string    `json:"lastError,omitempty"`
+	// NextAttempt is when a failed upload is retried.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
 }
 
-func (c *cacheObjects) uploadToBackendFromCh() {
-	for obj := range c.writeBackUploadBufferCh {
-		c.uploadObject(GlobalContext, obj)
+// Status values of WriteBackObjectInfo.
+const (
+	WriteBackPending = "pending"
+	WriteBackFailed  = "failed"
+)
+
+// WriteBackObjects lists the objects of bucket/prefix not committed to the
+// backend yet, ordered by cache drive and name. All objects are listed for an
+// empty bucket.
+func (c *cacheObjects) WriteBackObjects(bucket, prefix string) ([]WriteBackObjectInfo, error) {
+	if !c.commitWriteback {
+		return nil, errCacheWriteBackDisabled
+	}
+	var objects []WriteBackObjectInfo
+	for _, dcache := range c.cache {
+		if dcache == nil {
+			continue
+		}
+		for _, e := range dcache.wbJournal.list(bucket, prefix) {
+			status := WriteBackPending
+			if e.Dead {
+				status = WriteBackFailed
+			}
+			objects = append(objects, WriteBackObjectInfo{
+				Bucket:      e.Bucket,
+				Object:      e.Object,
+				ETag:        e.ETag,
+				Size:        e.Size,
+				Disk:        dcache.dir,
+				Queued:      e.Queued,
+				Status:      status,
+				Retries:     e.Retries,
+				LastError:   e.LastError,
+				NextAttempt: e.NextAttempt,
+			})
+		}
+	}
+	return objects, nil
+}
+
+// FlushWriteBack uploads the objects of bucket/prefix to the backend at once,
+// including the failed ones. It returns the number of objects queued.
+func (c *cacheObjects) FlushWriteBack(bucket, prefix string) (int, error) {
+	if !c.commitWriteback {
+		return 0, errCacheWriteBackDisabled
+	}
+	var queued int
+	for _, dcache := range c.cache {
+		if dcache == nil {
+			continue
+		}
+		n, err := dcache.wbJournal.flush(bucket, prefix)
+		if err != nil {
+			return queued, err
+		}
+		queued += n
+	}
+	return queued, nil
+}
+
+// WaitWriteBack flushes the objects of bucket/prefix and blocks until they
+// are all committed to the backend, or have failed all their attempts.
+func (c *cacheObjects) WaitWriteBack(ctx context.Context, bucket, prefix string) error {
+	if _, err := c.FlushWriteBack(bucket, prefix); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		objects, err := c.WriteBackObjects(bucket, prefix)
+		if err != nil {
+			return err
+		}
+		var failed int
+		for _, oi := range objects {
+			if oi.Status == WriteBackFailed {
+				failed++
+			}
+		}
+		if failed == len(objects) {
+			if failed == 0 {
+				return nil
+			}
+			err := errCacheWriteBackFailed
+			err.Message = fmt.Sprintf("%d objects failed to be committed to the backend", failed)
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -1246,29 +1436,6 @@ func (c *cacheObjects) recreateListTreeOnStartUp() {
 	}
 }
 
-// queues any pending or failed async commits when server restarts
-func (c *cacheObjects) queuePendingWriteback(ctx context.Context) {
-	for _, dcache := range c.cache {
-		if dcache != nil {
-			go func(d *diskCache) {
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case oi, ok := <-d.retryWritebackCh:
-						if !ok {
-							return
-						}
-						c.queueWritebackRetry(oi)
-					default:
-						time.Sleep(time.Second * 1)
-					}
-				}
-			}(dcache)
-		}
-	}
-}
-
 // NewMultipartUpload - Starts a new multipart upload operation to backend - if writethrough mode is enabled, starts caching the multipart.
 func (c *cacheObjects) NewMultipartUpload(ctx context.Context, bucket, object string, opts ObjectOptions) (uploadID string, err error) {
 	newMultipartUploadFn := c.InnerNewMultipartUploadFn
@@ -1300,6 +1467,19 @@ func (c *cacheObjects) NewMultipartUpload(ctx context.Context, bucket, object st
 		dcache.Delete(ctx, bucket, object)
 		return newMultipartUploadFn(ctx, bucket, object, opts)
 	}
+	if c.commitWriteback {
+		if dcache.wbJournal.full() || dcache.diskUsageHigh() {
+			// the writeback queue of the drive is full or the drive is
+			// above its high watermark, the upload goes to the backend.
+			dcache.Delete(ctx, bucket, object)
+			return newMultipartUploadFn(ctx, bucket, object, opts)
+		}
+		// stage the upload in the cache, it is committed to the backend
+		// with the same parts once completed.
+		meta := cloneMSS(opts.UserDefined)
+		meta[writeBackStatusHeader] = CommitPending.String()
+		return dcache.NewMultipartUpload(ctx, bucket, object, mustGetUUID(), ObjectOptions{UserDefined: meta})
+	}
 	if !c.commitWritethrough {
 		return newMultipartUploadFn(ctx, bucket, object, opts)
 	}
@@ -1318,6 +1498,9 @@ func (c *cacheObjects) PutObjectPart(ctx context.Context, bucket, object, upload
 		// disk cache could not be located,execute backend call.
 		return putObjectPartFn(ctx, bucket, object, uploadID, partID, data, opts)
 	}
+	if meta, ok := c.writeBackUpload(ctx, dcache, bucket, object, uploadID); ok {
+		return c.putWriteBackPart(ctx, dcache, meta, bucket, object, uploadID, partID, data, opts)
+	}
 
 	if !c.commitWritethrough {
 		return putObjectPartFn(ctx, bucket, object, uploadID, partID, data, opts)
@@ -1416,6 +1599,10 @@ func (c *cacheObjects) CopyObjectPart(ctx context.Context, srcBucket, srcObject,
 		// disk cache could not be located,execute backend call.
 		return copyObjectPartFn(ctx, srcBucket, srcObject, dstBucket, dstObject, uploadID, partID, startOffset, length, srcInfo, srcOpts, dstOpts)
 	}
+	if meta, ok := c.writeBackUpload(ctx, dcache, dstBucket, dstObject, uploadID); ok {
+		// the source range is read by the handler.
+		return c.putWriteBackPart(ctx, dcache, meta, dstBucket, dstObject, uploadID, partID, srcInfo.PutObjReader, dstOpts)
+	}
 
 	if !c.commitWritethrough {
 		return copyObjectPartFn(ctx, srcBucket, srcObject, dstBucket, dstObject, uploadID, partID, startOffset, length, srcInfo, srcOpts, dstOpts)
@@ -1455,14 +1642,17 @@ func (c *cacheObjects) CopyObjectPart(ctx context.Context, srcBucket, srcObject,
 // finalizes the upload saved in cache multipart dir.
 func (c *cacheObjects) CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, uploadedParts []CompletePart, opts ObjectOptions) (oi ObjectInfo, err error) {
 	completeMultipartUploadFn := c.InnerCompleteMultipartUploadFn
-	if !c.commitWritethrough {
-		return completeMultipartUploadFn(ctx, bucket, object, uploadID, uploadedParts, opts)
-	}
 	dcache, err := c.getCacheToLoc(ctx, bucket, object)
 	if err != nil {
 		// disk cache could not be located,execute backend call.
 		return completeMultipartUploadFn(ctx, bucket, object, uploadID, uploadedParts, opts)
 	}
+	if _, ok := c.writeBackUpload(ctx, dcache, bucket, object, uploadID); ok {
+		return c.completeWriteBackUpload(ctx, dcache, bucket, object, uploadID, uploadedParts, opts)
+	}
+	if !c.commitWritethrough {
+		return completeMultipartUploadFn(ctx, bucket, object, uploadID, uploadedParts, opts)
+	}
 
 	// perform multipart upload on backend and cache simultaneously
 	oi, err = completeMultipartUploadFn(ctx, bucket, object, uploadID, uploadedParts, opts)
@@ -1491,14 +1681,18 @@ func (c *cacheObjects) CompleteMultipartUpload(ctx context.Context, bucket, obje
 // AbortMultipartUpload - aborts multipart upload on backend and cache.
 func (c *cacheObjects) AbortMultipartUpload(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) error {
 	abortMultipartUploadFn := c.InnerAbortMultipartUploadFn
-	if !c.commitWritethrough {
-		return abortMultipartUploadFn(ctx, bucket, object, uploadID, opts)
-	}
 	dcache, err := c.getCacheToLoc(ctx, bucket, object)
 	if err != nil {
 		// disk cache could not be located,execute backend call.
 		return abortMultipartUploadFn(ctx, bucket, object, uploadID, opts)
 	}
+	if _, ok := c.writeBackUpload(ctx, dcache, bucket, object, uploadID); ok {
+		// the upload was never started on the backend.
+		return dcache.AbortUpload(bucket, object, uploadID)
+	}
+	if !c.commitWritethrough {
+		return abortMultipartUploadFn(ctx, bucket, object, uploadID, opts)
+	}
 	if err = dcache.uploadIDExists(bucket, object, uploadID); err != nil {
 		return toObjectErr(err, bucket, object, uploadID)
 	}
@@ -1512,3 +1706,146 @@ func (c *cacheObjects) AbortMultipartUpload(ctx context.Context, bucket, object,
 	go dcache.AbortUpload(bucket, object, uploadID)
 	return nil
 }
+
+// writeBackUpload returns the metadata of the multipart upload uploadID if it
+// is staged in dcache for write back.
+func (c *cacheObjects) writeBackUpload(ctx context.Context, dcache *diskCache, bucket, object, uploadID string) (*cacheMeta, bool) {
+	if !c.commitWriteback {
+		return nil, false
+	}
+	meta, err := dcache.uploadMeta(ctx, bucket, object, uploadID)
+	if err != nil || !writebackInProgress(meta.Meta) {
+		return nil, false
+	}
+	return meta, true
+}
+
+// putWriteBackPart caches a part of a multipart upload staged for write back.
+// The upload only exists in the cache, so a part that would take it past the
+// max cache file size or that does not fit on the drive is rejected.
+func (c *cacheObjects) putWriteBackPart(ctx context.Context, dcache *diskCache, meta *cacheMeta, bucket, object, uploadID string, partID int, data *PutObjReader, opts ObjectOptions) (PartInfo, error) {
+	size := data.Size()
+	for i, number := range meta.PartNumbers {
+		if number != partID {
+			size += meta.PartSizes[i]
+		}
+	}
+	if size > c.maxCacheFileSize {
+		return PartInfo{}, ObjectTooLarge{Bucket: bucket, Object: object}
+	}
+	if !dcache.diskSpaceAvailable(data.Size()) {
+		return PartInfo{}, toObjectErr(errDiskFull, bucket, object, uploadID)
+	}
+	info, err := dcache.PutObjectPart(ctx, bucket, object, uploadID, partID, data, data.Size(), opts)
+	if err != nil {
+		return PartInfo{}, toObjectErr(err, bucket, object, uploadID)
+	}
+	if err = dcache.SavePartMetadata(ctx, bucket, object, uploadID, partID, info); err != nil {
+		return PartInfo{}, toObjectErr(err, bucket, object, uploadID)
+	}
+	return info, nil
+}
+
+// completeWriteBackUpload completes a multipart upload staged for write back,
+// the object is journaled to be committed to the backend like a single PUT,
+// as a multipart upload of the same parts.
+func (c *cacheObjects) completeWriteBackUpload(ctx context.Context, dcache *diskCache, bucket, object, uploadID string, uploadedParts []CompletePart, opts ObjectOptions) (ObjectInfo, error) {
+	roi := ObjectInfo{
+		ETag:    getCompleteMultipartMD5(uploadedParts),
+		ModTime: UTCNow(),
+	}
+	oi, err := dcache.CompleteMultipartUpload(ctx, bucket, object, uploadID, uploadedParts, roi, opts)
+	if err != nil {
+		return ObjectInfo{}, toObjectErr(err, bucket, object, uploadID)
+	}
+	// drop the data of an earlier version uploaded with a single PUT.
+	removeAll(getCacheWriteBackSHADir(dcache.dir, bucket, object))
+	if err = dcache.wbJournal.add(oi); err != nil {
+		dcache.Delete(ctx, bucket, object)
+		return ObjectInfo{}, err
+	}
+	c.listTree.Insert([]byte(oi.Bucket+"/"+oi.Name), oi)
+	return oi, nil
+}
+
+// GetMultipartInfo returns the metadata of a multipart upload, from the cache
+// if it is staged there for write back.
+func (c *cacheObjects) GetMultipartInfo(ctx context.Context, bucket, object, uploadID string, opts ObjectOptions) (MultipartInfo, error) {
+	dcache, err := c.getCacheToLoc(ctx, bucket, object)
+	if err != nil {
+		return c.InnerGetMultipartInfoFn(ctx, bucket, object, uploadID, opts)
+	}
+	meta, ok := c.writeBackUpload(ctx, dcache, bucket, object, uploadID)
+	if !ok {
+		return c.InnerGetMultipartInfoFn(ctx, bucket, object, uploadID, opts)
+	}
+	return MultipartInfo{
+		Bucket:      bucket,
+		Object:      object,
+		UploadID:    uploadID,
+		Initiated:   meta.Stat.ModTime,
+		UserDefined: writeBackUploadMeta(meta),
+	}, nil
+}
+
+// ListObjectParts lists the parts of a multipart upload, from the cache if it
+// is staged there for write back.
+func (c *cacheObjects) ListObjectParts(ctx context.Context, bucket, object, uploadID string, partNumberMarker int, maxParts int, opts ObjectOptions) (ListPartsInfo, error) {
+	dcache, err := c.getCacheToLoc(ctx, bucket, object)
+	if err != nil {
+		return c.InnerListObjectPartsFn(ctx, bucket, object, uploadID, partNumberMarker, maxParts, opts)
+	}
+	meta, ok := c.writeBackUpload(ctx, dcache, bucket, object, uploadID)
+	if !ok {
+		return c.InnerListObjectPartsFn(ctx, bucket, object, uploadID, partNumberMarker, maxParts, opts)
+	}
+	partETags, err := decryptCachePartETags(meta)
+	if err != nil {
+		return ListPartsInfo{}, err
+	}
+	parts := make([]PartInfo, 0, len(meta.PartNumbers))
+	for i, number := range meta.PartNumbers {
+		if number <= partNumberMarker {
+			continue
+		}
+		parts = append(parts, PartInfo{
+			PartNumber:   number,
+			ETag:         partETags[i],
+			Size:         meta.PartSizes[i],
+			ActualSize:   meta.PartActualSizes[i],
+			LastModified: meta.Stat.ModTime,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	result := ListPartsInfo{
+		Bucket:           bucket,
+		Object:           object,
+		UploadID:         uploadID,
+		PartNumberMarker: partNumberMarker,
+		MaxParts:         maxParts,
+		UserDefined:      writeBackUploadMeta(meta),
+	}
+	if len(parts) > maxParts {
+		parts = parts[:maxParts]
+		result.IsTruncated = true
+	}
+	result.Parts = parts
+	if len(parts) > 0 {
+		result.NextPartNumberMarker = parts[len(parts)-1].PartNumber
+	}
+	return result, nil
+}
+
+// writeBackUploadMeta returns the metadata of a multipart upload staged for
+// write back without the internal metadata of the cache, the parts are stored
+// as they are sent.
+func writeBackUploadMeta(meta *cacheMeta) map[string]string {
+	userDefined := make(map[string]string, len(meta.Meta))
+	for k, v := range meta.Meta {
+		if !strings.HasPrefix(strings.ToLower(k), ReservedMetadataPrefixLower) {
+			userDefined[k] = v
+		}
+	}
+	return userDefined
+}
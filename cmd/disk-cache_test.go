@@ -18,8 +18,17 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/minio/minio/internal/config/cache"
+	"github.com/minio/minio/internal/hash"
 )
 
 // Tests ToObjectInfo function.
@@ -72,3 +81,323 @@ func TestCacheExclusion(t *testing.T) {
 		}
 	}
 }
+
+// Tests multipart uploads staged in the cache and committed with their parts.
+func TestCacheWriteBackMultipartUpload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dcache, err := newDiskCache(ctx, t.TempDir(), cache.Config{
+		MaxUse:          100,
+		WatermarkLow:    80,
+		WatermarkHigh:   90,
+		CacheCommitMode: CommitWriteBack,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		committed   []byte
+		backendETag string
+	)
+	c := &cacheObjects{
+		cache:            []*diskCache{dcache},
+		commitWriteback:  true,
+		maxCacheFileSize: 100 << 20,
+		listTree:         NewThreadSafeListTree(),
+		InnerNewMultipartUploadFn: func(ctx context.Context, bucket, object string, opts ObjectOptions) (string, error) {
+			return "backend-upload", nil
+		},
+		InnerPutObjectPartFn: func(ctx context.Context, bucket, object, uploadID string, partID int, data *PutObjReader, opts ObjectOptions) (PartInfo, error) {
+			b, err := ioutil.ReadAll(data)
+			committed = append(committed, b...)
+			return PartInfo{PartNumber: partID, ETag: getMD5Hash(b), Size: int64(len(b))}, err
+		},
+		InnerCompleteMultipartUploadFn: func(ctx context.Context, bucket, object, uploadID string, uploadedParts []CompletePart, opts ObjectOptions) (ObjectInfo, error) {
+			backendETag = getCompleteMultipartMD5(uploadedParts)
+			return ObjectInfo{Bucket: bucket, Name: object, ETag: backendETag, Size: int64(len(committed))}, nil
+		},
+	}
+
+	uploadID, err := c.NewMultipartUpload(ctx, "bucket", "object", ObjectOptions{UserDefined: map[string]string{"content-type": "text/plain"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := c.GetMultipartInfo(ctx, "bucket", "object", uploadID, ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mi.UserDefined[writeBackStatusHeader]; ok || mi.UserDefined["content-type"] != "text/plain" {
+		t.Fatalf("Unexpected upload metadata %v", mi.UserDefined)
+	}
+
+	data := [][]byte{bytes.Repeat([]byte("a"), globalMinPartSize), []byte("end")}
+	var parts []CompletePart
+	for i, b := range data {
+		hr, err := hash.NewReader(bytes.NewReader(b), int64(len(b)), "", "", int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pi, err := c.PutObjectPart(ctx, "bucket", "object", uploadID, i+1, NewPutObjReader(hr), ObjectOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, CompletePart{PartNumber: pi.PartNumber, ETag: pi.ETag})
+	}
+	lpi, err := c.ListObjectParts(ctx, "bucket", "object", uploadID, 0, 1, ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lpi.Parts) != 1 || !lpi.IsTruncated || lpi.NextPartNumberMarker != 1 || lpi.Parts[0].ETag != parts[0].ETag {
+		t.Fatalf("Unexpected parts listing %+v", lpi)
+	}
+
+	oi, err := c.CompleteMultipartUpload(ctx, "bucket", "object", uploadID, parts, ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oi.ETag != getCompleteMultipartMD5(parts) {
+		t.Fatalf("Expected ETag %s, got %s", getCompleteMultipartMD5(parts), oi.ETag)
+	}
+	if _, ok := c.listTree.Search([]byte("bucket/object")); !ok {
+		t.Fatal("Expected the uncommitted object to be listed")
+	}
+	due := dcache.wbJournal.due(time.Now(), 0, true)
+	if len(due) != 1 || due[0].ETag != oi.ETag {
+		t.Fatalf("Expected the object to be journaled, got %v", due)
+	}
+
+	c.uploadObject(ctx, dcache, due[0])
+	if !bytes.Equal(committed, append(data[0], data[1]...)) {
+		t.Fatalf("Expected the parts to be committed as an object of %d bytes, got %d bytes", oi.Size, len(committed))
+	}
+	if backendETag != oi.ETag {
+		t.Fatalf("Expected the backend ETag %s, got %s", oi.ETag, backendETag)
+	}
+	if entries := dcache.wbJournal.list("", ""); len(entries) != 0 {
+		t.Fatalf("Expected the object to be committed, got %v", entries)
+	}
+	if _, ok := c.listTree.Search([]byte("bucket/object")); ok {
+		t.Fatal("Expected the committed object to be removed from the list tree")
+	}
+	gr, _, err := dcache.Get(ctx, "bucket", "object", nil, nil, ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gr.Close()
+	if st := cacheCommitStatus(gr.ObjInfo.UserDefined[writeBackStatusHeader]); st != CommitComplete {
+		t.Fatalf("Expected the cached object to be committed, got %s", st)
+	}
+}
+
+// Tests that a multipart upload staged for write back is limited to the max
+// cache file size.
+func TestCacheWriteBackMultipartUploadTooLarge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dcache, err := newDiskCache(ctx, t.TempDir(), cache.Config{
+		MaxUse:          100,
+		WatermarkLow:    80,
+		WatermarkHigh:   90,
+		CacheCommitMode: CommitWriteBack,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &cacheObjects{
+		cache:            []*diskCache{dcache},
+		commitWriteback:  true,
+		maxCacheFileSize: globalMinPartSize,
+		listTree:         NewThreadSafeListTree(),
+	}
+	uploadID, err := c.NewMultipartUpload(ctx, "bucket", "object", ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putPart := func(partID int, size int) error {
+		b := bytes.Repeat([]byte("a"), size)
+		hr, err := hash.NewReader(bytes.NewReader(b), int64(size), "", "", int64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.PutObjectPart(ctx, "bucket", "object", uploadID, partID, NewPutObjReader(hr), ObjectOptions{})
+		return err
+	}
+	if err = putPart(1, globalMinPartSize); err != nil {
+		t.Fatal(err)
+	}
+	// uploading a part again replaces it.
+	if err = putPart(1, globalMinPartSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := putPart(2, 1).(ObjectTooLarge); !ok {
+		t.Fatal("Expected the part exceeding the max cache file size to be rejected")
+	}
+}
+
+// Tests that pre-warming keeps the objects not committed to the backend yet.
+func TestCachePrewarmWriteBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dcache, err := newDiskCache(ctx, t.TempDir(), cache.Config{
+		MaxUse:          100,
+		WatermarkLow:    80,
+		WatermarkHigh:   90,
+		CacheCommitMode: CommitWriteBack,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := []byte("stale")
+	staleInfo := ObjectInfo{Bucket: "bucket", Name: "object", Size: int64(len(stale)), ETag: getMD5Hash(stale)}
+	c := &cacheObjects{
+		cache:            []*diskCache{dcache},
+		commitWriteback:  true,
+		maxCacheFileSize: 1 << 20,
+		InnerGetObjectNInfoFn: func(ctx context.Context, bucket, object string, rs *HTTPRangeSpec, h http.Header, lockType LockType, opts ObjectOptions) (*GetObjectReader, error) {
+			return NewGetObjectReaderFromReader(bytes.NewReader(stale), staleInfo, opts)
+		},
+	}
+
+	data := []byte("acknowledged")
+	hr, err := hash.NewReader(bytes.NewReader(data), int64(len(data)), "", "", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oi, err := dcache.Put(ctx, "bucket", "object", NewPutObjReader(hr), hr.Size(), nil, ObjectOptions{}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dcache.wbJournal.add(oi); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, err := c.prewarmObject(ctx, staleInfo); err != nil || cached {
+		t.Fatalf("Expected the uncommitted object to be skipped, got %v, %v", cached, err)
+	}
+	// the journal is checked even if the cache metadata was committed.
+	meta := cloneMSS(oi.UserDefined)
+	meta[writeBackStatusHeader] = CommitComplete.String()
+	if err = dcache.SaveMetadata(ctx, "bucket", "object", meta, oi.Size, nil, "", false, true); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := dcache.Prewarm(ctx, "bucket", "object", bytes.NewReader(stale), staleInfo.Size, ObjectOptions{}); err != nil || cached {
+		t.Fatalf("Expected the journaled object to be skipped, got %v, %v", cached, err)
+	}
+	gr, _, err := dcache.Get(ctx, "bucket", "object", nil, nil, ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gr.Close()
+	if b, err := ioutil.ReadAll(gr); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("Expected the cached object to be kept, got %q, %v", b, err)
+	}
+	if due := dcache.wbJournal.due(time.Now(), 0, true); len(due) != 1 || due[0].ETag != oi.ETag {
+		t.Fatalf("Expected the object to stay journaled, got %v", due)
+	}
+}
+
+func TestCachePrewarm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	dcache, err := newDiskCache(ctx, dir, cache.Config{
+		MaxUse:        100,
+		WatermarkLow:  80,
+		WatermarkHigh: 90,
+		After:         3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := map[string][]byte{
+		"dir/a":     []byte("a"),
+		"dir/sub/b": []byte("bb"),
+		"other":     []byte("ccc"),
+	}
+	objInfo := func(name string) ObjectInfo {
+		data := backend[name]
+		return ObjectInfo{Bucket: "bucket", Name: name, Size: int64(len(data)), ETag: getMD5Hash(data)}
+	}
+	c := &cacheObjects{
+		cache:            []*diskCache{dcache},
+		maxCacheFileSize: 1 << 20,
+		InnerListObjectsFn: func(ctx context.Context, bucket, prefix, marker, delimiter string, maxKeys int) (result ListObjectsInfo, err error) {
+			for _, name := range []string{"dir/a", "dir/sub/b", "other"} {
+				if strings.HasPrefix(name, prefix) && name > marker {
+					result.Objects = append(result.Objects, objInfo(name))
+				}
+			}
+			return result, nil
+		},
+		InnerGetObjectNInfoFn: func(ctx context.Context, bucket, object string, rs *HTTPRangeSpec, h http.Header, lockType LockType, opts ObjectOptions) (*GetObjectReader, error) {
+			return NewGetObjectReaderFromReader(bytes.NewReader(backend[object]), objInfo(object), opts)
+		},
+	}
+	prewarm := func() CachePrewarmInfo {
+		c.PrewarmCache("bucket", "dir/")
+		for {
+			infos := c.CachePrewarms("bucket", "dir/")
+			if len(infos) != 1 {
+				t.Fatalf("Expected one pre-warm, got %+v", infos)
+			}
+			if infos[0].Status != CachePrewarmRunning {
+				return infos[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// objects are cached without waiting for MINIO_CACHE_AFTER accesses.
+	info := prewarm()
+	if info.Status != CachePrewarmDone || info.Objects != 2 || info.Cached != 2 || info.Bytes != 3 {
+		t.Fatalf("Unexpected pre-warm %+v", info)
+	}
+	for _, name := range []string{"dir/a", "dir/sub/b"} {
+		if oi, _, err := dcache.Stat(ctx, "bucket", name); err != nil || oi.ETag != objInfo(name).ETag {
+			t.Fatalf("Expected %s to be cached, got %+v, %v", name, oi, err)
+		}
+	}
+	if dcache.Exists(ctx, "bucket", "other") {
+		t.Fatal("Expected other not to be cached")
+	}
+	// cached objects are skipped.
+	if info = prewarm(); info.Cached != 0 || info.Skipped != 2 {
+		t.Fatalf("Unexpected pre-warm %+v", info)
+	}
+	if _, err = c.CancelPrewarm("bucket", "other"); err != errCachePrewarmNotFound {
+		t.Fatalf("Expected %v, got %v", errCachePrewarmNotFound, err)
+	}
+
+	if err = c.PinCache("bucket", "dir/sub/"); err != nil {
+		t.Fatal(err)
+	}
+	residency, err := c.CacheResidency(ctx, "bucket", "dir/", SlashSeparator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CacheResidencyInfo{
+		{Bucket: "bucket", Prefix: "dir/", Resident: 1, Size: 1, Hits: 1},
+		{Bucket: "bucket", Prefix: "dir/sub/", Resident: 1, Size: 2, Hits: 1, Pinned: 1},
+	}
+	if !reflect.DeepEqual(residency, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, residency)
+	}
+
+	// pins are saved on the cache drive.
+	pins, err := loadCachePins(pathJoin(dir, minioMetaBucket, cachePinsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pins.pinned("bucket", "dir/sub/b") || pins.pinned("bucket", "dir/a") {
+		t.Fatalf("Unexpected pins %+v", pins.list())
+	}
+	if err = c.UnpinCache("bucket", "dir/sub/"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.UnpinCache("bucket", "dir/sub/"); err != errCachePinNotFound {
+		t.Fatalf("Expected %v, got %v", errCachePinNotFound, err)
+	}
+	if pins := c.CachePins(); len(pins) != 0 {
+		t.Fatalf("Expected no pins, got %+v", pins)
+	}
+}
@@ -1470,6 +1470,6 @@ func (fs *FSObjects) PutMultipleObjects(
 	objects []string,
 	r []*PutObjReader,
 	opts []ObjectOptions,
-) (objInfo []ObjectInfo, err error) {
-	return nil, NotImplemented{}
+) ([]ObjectInfo, []error) {
+	return putMultipleObjectsNotImplemented(objects)
 }
@@ -17,7 +17,14 @@
 
 package cmd
 
-import "github.com/minio/madmin-go"
+import (
+	"context"
+	"net/http"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio/internal/bucket/versioning"
+	"github.com/minio/minio/internal/config"
+)
 
 // GatewayMinioSysTmp prefix is used in Azure/GCS gateway for save metadata sent by Initialize Multipart Upload API.
 const (
@@ -38,3 +45,89 @@ type Gateway interface {
 	// NewGatewayLayer returns a new  ObjectLayer.
 	NewGatewayLayer(creds madmin.Credentials) (ObjectLayer, error)
 }
+
+// GatewayMetadata is implemented by gateways which store server metadata on
+// their backend, as the erasure and FS backends do.
+type GatewayMetadata interface {
+	// KeepsBucketMetadata returns true when bucket metadata, like bucket
+	// policies and lifecycle, encryption and notification configurations, is
+	// stored on the backend.
+	KeepsBucketMetadata() bool
+	// KeepsConfig returns true when the server config is stored on the
+	// backend, its keys are then changed through the admin config API.
+	KeepsConfig() bool
+}
+
+// GatewayEncryption is implemented by gateway object layers whose backend
+// encrypts objects itself, bucket encryption is then configured without a KMS.
+type GatewayEncryption interface {
+	// BackendEncryption returns true when objects requesting server side
+	// encryption are encrypted by the backend.
+	BackendEncryption() bool
+}
+
+// GatewayLifecycle is implemented by gateway object layers which apply the
+// bucket lifecycle rules themselves, as there is no scanner in gateway mode.
+type GatewayLifecycle interface {
+	// AbortsIncompleteUploads returns true when the
+	// AbortIncompleteMultipartUpload action of the rules is applied.
+	AbortsIncompleteUploads() bool
+}
+
+// GatewayVersioning is implemented by gateway object layers which keep the
+// bucket versioning state in their backend.
+type GatewayVersioning interface {
+	SetBucketVersioning(ctx context.Context, bucket string, v *versioning.Versioning) error
+	GetBucketVersioning(ctx context.Context, bucket string) (*versioning.Versioning, error)
+}
+
+// GatewayAdmin is implemented by gateway object layers with admin operations
+// of their own, they are served at <admin prefix>/gateway/{op}.
+type GatewayAdmin interface {
+	// GatewayAdmin runs op with the query and body of r and returns the
+	// response, which is sent to the client as JSON. GET requests must not
+	// change any state.
+	GatewayAdmin(ctx context.Context, op string, r *http.Request) (interface{}, error)
+	// GatewayAdminSensitive returns true when the GET request of op reads
+	// sensitive state, it then needs the admin action of the changes.
+	GatewayAdminSensitive(op string) bool
+}
+
+// GatewayMetrics is implemented by gateway object layers which export metrics
+// of their backend, they are served by metrics v2 in the minio_gateway
+// namespace with the gateway name as subsystem.
+type GatewayMetrics interface {
+	GatewayMetrics(ctx context.Context) []GatewayMetric
+}
+
+// GatewayMetric is a gauge, or a counter when Counter is set, of a gateway
+// backend.
+type GatewayMetric struct {
+	Name    string
+	Help    string
+	Counter bool
+	Value   float64
+	Labels  map[string]string
+}
+
+// GatewayHealer is implemented by gateway object layers which repair their
+// backend themselves, the repair is started, stopped and reported through the
+// heal admin API.
+type GatewayHealer interface {
+	// StartHeal starts repairing bucket and prefix unless a repair of them is
+	// in progress, which is restarted when forceStart is set.
+	StartHeal(ctx context.Context, bucket, prefix string, opts madmin.HealOpts, forceStart bool, clientAddr string) (madmin.HealStartSuccess, error)
+	// StopHeal stops the repair of bucket and prefix.
+	StopHeal(ctx context.Context, bucket, prefix string) (madmin.HealStopSuccess, error)
+	// HealStatus returns the progress of the repair started with
+	// clientToken, the items are those repaired since the last call.
+	HealStatus(ctx context.Context, clientToken string) (madmin.HealTaskStatus, error)
+}
+
+// GatewayTuner is implemented by gateway object layers which are tuned at
+// runtime through the zcn config sub-system.
+type GatewayTuner interface {
+	// SetGatewayConfig applies kvs of the sub-system, it is called on start
+	// and whenever the sub-system is changed through the admin config API.
+	SetGatewayConfig(ctx context.Context, kvs config.KVS) error
+}
@@ -52,7 +52,7 @@ type GatewayLocker struct {
 
 // NewNSLock - implements gateway level locker
 func (l *GatewayLocker) NewNSLock(bucket string, objects ...string) RWLocker {
-	return l.nsMutex.NewNSLock(nil, bucket, objects...)
+	return l.nsMutex.NewNSLock(getGatewayLockers, bucket, objects...)
 }
 
 // Walk - implements common gateway level Walker, to walk on all objects recursively at a prefix
@@ -97,9 +97,18 @@ func (l *GatewayLocker) Walk(ctx context.Context, bucket, prefix string, results
 	return nil
 }
 
+// unwrapGatewayLayer returns the gateway object layer wrapped by
+// GatewayLocker, the optional gateway interfaces are asserted on it.
+func unwrapGatewayLayer(objAPI ObjectLayer) ObjectLayer {
+	if l, ok := objAPI.(*GatewayLocker); ok {
+		return l.ObjectLayer
+	}
+	return objAPI
+}
+
 // NewGatewayLayerWithLocker - initialize gateway with locker.
 func NewGatewayLayerWithLocker(gwLayer ObjectLayer) ObjectLayer {
-	return &GatewayLocker{ObjectLayer: gwLayer, nsMutex: newNSLock(false)}
+	return &GatewayLocker{ObjectLayer: gwLayer, nsMutex: newNSLock(IsGatewayDistributed())}
 }
 
 // RegisterGatewayCommand registers a new command for gateway.
@@ -167,6 +176,7 @@ func StartGateway(ctx *cli.Context, gw Gateway) {
 	}
 
 	// Validate if we have access, secret set through environment.
+	globalGateway = gw
 	globalGatewayName = gw.Name()
 	gatewayName := gw.Name()
 	if ctx.Args().First() == "help" {
@@ -248,6 +258,9 @@ func StartGateway(ctx *cli.Context, gw Gateway) {
 	// Add server metrics router
 	registerMetricsRouter(router)
 
+	// Add lock router of the gateway peers.
+	logger.FatalIf(initGatewayPeers(router), "Unable to initialize gateway peers")
+
 	// Add API router.
 	registerAPIRouter(router)
 
@@ -298,12 +311,22 @@ func StartGateway(ctx *cli.Context, gw Gateway) {
 	globalObjectAPI = newObject
 	globalObjLayerMutex.Unlock()
 
-	if gatewayName == NASBackendGateway {
+	if gatewayKeepsConfig() {
+		logger.FatalIf(initGatewayConfig(GlobalContext, newObject), "Unable to initialize gateway config")
+	}
+
+	if gatewayName == NASBackendGateway || gatewayKeepsBucketMetadata() {
 		buckets, err := newObject.ListBuckets(GlobalContext)
 		if err != nil {
 			logger.Fatal(err, "Unable to list buckets")
 		}
 		logger.FatalIf(globalNotificationSys.Init(GlobalContext, buckets, newObject), "Unable to initialize notification system")
+		if gatewayKeepsBucketMetadata() {
+			logger.FatalIf(globalBucketMetadataSys.Init(GlobalContext, buckets, newObject), "Unable to initialize bucket metadata")
+			if IsGatewayDistributed() {
+				go refreshGatewayBucketMetadata(GlobalContext, newObject)
+			}
+		}
 	}
 
 	go globalIAMSys.Init(GlobalContext, newObject, globalEtcdClient, globalNotificationSys, globalRefreshIAMInterval)
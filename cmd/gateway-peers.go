@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio/internal/config"
+	"github.com/minio/minio/internal/dsync"
+	"github.com/minio/minio/internal/fips"
+	"github.com/minio/minio/internal/logger"
+	"github.com/minio/minio/internal/rest"
+	"github.com/minio/pkg/env"
+)
+
+// gatewayPeersRefreshInterval is how often a gateway sharing its backend
+// reloads the bucket metadata, which may have been changed by its peers.
+const gatewayPeersRefreshInterval = time.Minute
+
+// globalGatewayLockers are the lockers of the gateways listed in
+// MINIO_GATEWAY_PEERS, the namespace locks of the gateway are taken on all of
+// them. It is empty when the gateway is the only one serving its backend.
+var globalGatewayLockers []dsync.NetLocker
+
+// initGatewayPeers serves the lock REST API and connects to the lockers of
+// the gateways listed in MINIO_GATEWAY_PEERS, which must list this gateway
+// too. All peers must be started with the same list and credentials.
+func initGatewayPeers(router *mux.Router) error {
+	peers := env.Get(config.EnvGatewayPeers, "")
+	if peers == "" {
+		return nil
+	}
+
+	var endpoints []Endpoint
+	var local string
+	for _, peer := range strings.Split(peers, config.ValueSeparator) {
+		u, err := url.Parse(strings.TrimSpace(peer))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid gateway peer %q, expected a URL such as http://host:9000", peer)
+		}
+		host, port, err := extractHostPort(u.String())
+		if err != nil {
+			return err
+		}
+		isLocal, err := isLocalHost(host, port, globalMinioPort)
+		if err != nil {
+			return err
+		}
+		if isLocal {
+			if local != "" {
+				return fmt.Errorf("gateway peers %s and %s are both this gateway", local, u.Host)
+			}
+			local = u.Host
+		}
+		endpoints = append(endpoints, Endpoint{URL: u, IsLocal: isLocal})
+	}
+	if local == "" {
+		return errors.New("gateway peers must list this gateway")
+	}
+
+	globalInternodeTransport = newInternodeHTTPTransport(&tls.Config{
+		RootCAs:            globalRootCAs,
+		CipherSuites:       fips.CipherSuitesTLS(),
+		CurvePreferences:   fips.EllipticCurvesTLS(),
+		ClientSessionCache: tls.NewLRUClientSessionCache(tlsClientSessionCacheSize),
+	}, rest.DefaultTimeout)()
+	globalLocalNodeName = local
+
+	// Register the lock REST API first, the local endpoint uses its locker.
+	registerLockRESTHandlers(router)
+	for _, endpoint := range endpoints {
+		globalGatewayLockers = append(globalGatewayLockers, newLockAPI(endpoint))
+	}
+	return nil
+}
+
+func getGatewayLockers() ([]dsync.NetLocker, string) {
+	return globalGatewayLockers, globalLocalNodeName
+}
+
+// IsGatewayDistributed returns true when the gateway shares its backend with
+// the gateways listed in MINIO_GATEWAY_PEERS. Backends should not keep state
+// which another gateway may change without reloading it.
+func IsGatewayDistributed() bool {
+	return len(globalGatewayLockers) > 0
+}
+
+// GatewayLock takes the write lock of paths in volume for the gateway backend,
+// volume is any name the backend chooses such as a bucket. The paths are locked
+// together, on all gateway peers when the gateway is distributed. The returned
+// context is canceled when the lock is lost and unlock releases the lock.
+func GatewayLock(ctx context.Context, volume string, paths ...string) (lkCtx context.Context, unlock func(), err error) {
+	objAPI, ok := newObjectLayerFn().(*GatewayLocker)
+	if !ok {
+		return nil, nil, errServerNotInitialized
+	}
+	lk := objAPI.NewNSLock(volume, paths...)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lkctx.Context(), func() { lk.Unlock(lkctx.Cancel) }, nil
+}
+
+// refreshGatewayBucketMetadata reloads the bucket metadata periodically, its
+// peers may have changed it.
+func refreshGatewayBucketMetadata(ctx context.Context, objAPI ObjectLayer) {
+	t := time.NewTicker(gatewayPeersRefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			buckets, err := objAPI.ListBuckets(ctx)
+			if err != nil {
+				logger.LogIf(ctx, err)
+				continue
+			}
+			globalBucketMetadataSys.load(ctx, buckets, objAPI)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio/internal/config"
+)
+
+// Tests the gateway peers which are rejected before the lock REST API is
+// registered.
+func TestInitGatewayPeersInvalid(t *testing.T) {
+	testCases := []string{
+		"localhost:9000",
+		"ftp://localhost:9000",
+		"http://",
+		"http://198.51.100.1:9000,http://198.51.100.2:9000",
+		"http://localhost:9000,http://127.0.0.1:9000",
+	}
+
+	for i, peers := range testCases {
+		t.Setenv(config.EnvGatewayPeers, peers)
+		if err := initGatewayPeers(mux.NewRouter()); err == nil {
+			t.Errorf("Test %d: expected %q to fail", i+1, peers)
+		}
+		if IsGatewayDistributed() {
+			t.Fatalf("Test %d: expected no gateway lockers", i+1)
+		}
+	}
+}
@@ -144,7 +144,6 @@ func (a GatewayUnsupported) SetBucketVersioning(ctx context.Context, bucket stri
 
 // GetBucketVersioning retrieves versioning configuration of a bucket.
 func (a GatewayUnsupported) GetBucketVersioning(ctx context.Context, bucket string) (*versioning.Versioning, error) {
-	logger.LogIf(ctx, NotImplemented{})
 	return nil, NotImplemented{}
 }
 
@@ -215,6 +214,11 @@ func (a GatewayUnsupported) CopyObject(ctx context.Context, srcBucket string, sr
 	return objInfo, NotImplemented{}
 }
 
+// PutMultipleObjects - Not implemented stub
+func (a GatewayUnsupported) PutMultipleObjects(ctx context.Context, bucket string, objects []string, r []*PutObjReader, opts []ObjectOptions) ([]ObjectInfo, []error) {
+	return putMultipleObjectsNotImplemented(objects)
+}
+
 // GetMetrics - no op
 func (a GatewayUnsupported) GetMetrics(ctx context.Context) (*BackendMetrics, error) {
 	logger.LogIf(ctx, NotImplemented{})
@@ -264,9 +268,9 @@ func (a GatewayUnsupported) IsCompressionSupported() bool {
 	return false
 }
 
-// Health - No Op.
+// Health - gateways are healthy while they serve requests.
 func (a GatewayUnsupported) Health(_ context.Context, _ HealthOptions) HealthResult {
-	return HealthResult{}
+	return HealthResult{Healthy: true}
 }
 
 // ReadHealth - No Op.
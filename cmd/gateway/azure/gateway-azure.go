@@ -913,16 +913,6 @@ func (a *azureObjects) PutObject(ctx context.Context, bucket, object string, r *
 	return a.GetObjectInfo(ctx, bucket, object, opts)
 }
 
-func (a *azureObjects) PutMultipleObjects(
-	ctx context.Context,
-	bucket string,
-	objects []string,
-	r []*minio.PutObjReader,
-	opts []minio.ObjectOptions,
-) (objInfo []minio.ObjectInfo, err error) {
-	return nil, minio.NotImplemented{}
-}
-
 // CopyObject - Copies a blob from source container to destination container.
 // Uses Azure equivalent `BlobURL.StartCopyFromURL`.
 func (a *azureObjects) CopyObject(ctx context.Context, srcBucket, srcObject, destBucket, destObject string, srcInfo minio.ObjectInfo, srcOpts, dstOpts minio.ObjectOptions) (objInfo minio.ObjectInfo, err error) {
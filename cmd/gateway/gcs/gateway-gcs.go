@@ -927,16 +927,6 @@ func (l *gcsGateway) PutObject(ctx context.Context, bucket string, key string, r
 	return fromGCSAttrsToObjectInfo(w.Attrs()), nil
 }
 
-func (l *gcsGateway) PutMultipleObjects(
-	ctx context.Context,
-	bucket string,
-	objects []string,
-	r []*minio.PutObjReader,
-	opts []minio.ObjectOptions,
-) (objInfo []minio.ObjectInfo, err error) {
-	return nil, minio.NotImplemented{}
-}
-
 // CopyObject - Copies a blob from source container to destination container.
 func (l *gcsGateway) CopyObject(ctx context.Context, srcBucket string, srcObject string, destBucket string, destObject string,
 	srcInfo minio.ObjectInfo, srcOpts, dstOpts minio.ObjectOptions) (minio.ObjectInfo, error) {
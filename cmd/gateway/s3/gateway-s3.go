@@ -535,16 +535,6 @@ func (l *s3Objects) PutObject(ctx context.Context, bucket string, object string,
 	return minio.FromMinioClientObjectInfo(bucket, oi), nil
 }
 
-func (l *s3Objects) PutMultipleObjects(
-	ctx context.Context,
-	bucket string,
-	objects []string,
-	r []*minio.PutObjReader,
-	opts []minio.ObjectOptions,
-) (objInfo []minio.ObjectInfo, err error) {
-	return nil, minio.NotImplemented{}
-}
-
 // CopyObject copies an object from source bucket to a destination bucket.
 func (l *s3Objects) CopyObject(ctx context.Context, srcBucket string, srcObject string, dstBucket string, dstObject string, srcInfo minio.ObjectInfo, srcOpts, dstOpts minio.ObjectOptions) (objInfo minio.ObjectInfo, err error) {
 	if srcOpts.CheckPrecondFn != nil && srcOpts.CheckPrecondFn(srcInfo) {
@@ -0,0 +1,41 @@
+package zcn
+
+import (
+	"context"
+	"net/http"
+
+	minio "github.com/minio/minio/cmd"
+)
+
+// GatewayAdminSensitive implements minio.GatewayAdmin, shares are only listed
+// to admins allowed to create them.
+func (zob *zcnObjects) GatewayAdminSensitive(op string) bool {
+	return op == "shares"
+}
+
+// GatewayAdmin serves the admin API of the gateway at <admin prefix>/gateway/{op}.
+func (zob *zcnObjects) GatewayAdmin(ctx context.Context, op string, r *http.Request) (interface{}, error) {
+	switch {
+	case op == "lifecycle/status" && r.Method == http.MethodGet:
+		return zob.lifecycle.status(), nil
+	case op == "health" && r.Method == http.MethodGet:
+		return zob.health.status(), nil
+	case op == "lifecycle/run" && r.Method == http.MethodPost:
+		zob.lifecycle.trigger()
+		return zob.lifecycle.status(), nil
+	case op == "shares" && r.Method == http.MethodGet:
+		q := r.URL.Query()
+		return shares.list(q.Get("bucket"), q.Get("prefix"), q.Get("clientid")), nil
+	case op == "shares" && r.Method == http.MethodPost:
+		return zob.shareObject(r)
+	case op == "shares" && r.Method == http.MethodDelete:
+		return nil, zob.revokeShare(r)
+	case op == "allocations" && r.Method == http.MethodGet:
+		return zob.allocationInfos(ctx), nil
+	case op == "allocations" && r.Method == http.MethodPost:
+		return zob.setAllocation(ctx, r)
+	case op == "allocations" && r.Method == http.MethodDelete:
+		return zob.unmapAllocationBucket(r)
+	}
+	return nil, minio.NotImplemented{}
+}
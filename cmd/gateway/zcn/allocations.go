@@ -0,0 +1,565 @@
+package zcn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+)
+
+// allocations holds the allocations served by the gateway.
+var allocations *allocationRegistry
+
+// systemStoresRefreshInterval is how often a distributed gateway reloads the
+// metadata sidecars, bucket configurations and shares.
+const systemStoresRefreshInterval = time.Minute
+
+// allocationOptions configures an allocation serving some buckets, as listed
+// in the allocations of zs3server.json. Zero batch settings are taken from the
+// server options.
+type allocationOptions struct {
+	AllocationID     string   `json:"allocation_id"`
+	Buckets          []string `json:"buckets"`
+	Encrypt          bool     `json:"encrypt"`
+	Compress         bool     `json:"compress"`
+	CompressionCodec string   `json:"compression_codec,omitempty"`
+	MaxBatchSize     int      `json:"max_batch_size,omitempty"`
+	BatchWaitTime    int      `json:"batch_wait_time,omitempty"`
+	BatchWorkers     int      `json:"batch_workers,omitempty"`
+}
+
+// zcnAllocation is an allocation served by the gateway with the settings
+// objects are uploaded with. It is not modified once registered, new settings
+// register a copy which keeps the sdk allocation and its batch uploader.
+type zcnAllocation struct {
+	id       string
+	alloc    *sdk.Allocation
+	encrypt  bool
+	compress bool
+	codec    string
+	batch    *batchUploader
+	metrics  *minio.BackendMetrics
+	options  allocationOptions
+}
+
+// compressionCodec returns the codec an object should be compressed with or
+// an empty string if it should be stored as is.
+func (za *zcnAllocation) compressionCodec(object, contentType string) string {
+	if !za.compress ||
+		hasStringSuffixInSlice(object, minio.StandardExcludeCompressExtensions) ||
+		hasPattern(minio.StandardExcludeCompressContentTypes, contentType) {
+		return ""
+	}
+	return za.codec
+}
+
+// batchSettings returns the batch wait time, size and workers of the
+// allocation, those opts leaves unset are taken from the server options.
+func (opts allocationOptions) batchSettings() (waitTime, maxBatchSize, workers int) {
+	server := currentOptions()
+	waitTime, maxBatchSize, workers = opts.BatchWaitTime, opts.MaxBatchSize, opts.BatchWorkers
+	if waitTime == 0 {
+		waitTime = server.BatchWaitTime
+	}
+	if maxBatchSize == 0 {
+		maxBatchSize = server.MaxBatchSize
+	}
+	if workers == 0 {
+		workers = server.BatchWorkers
+	}
+	return waitTime, maxBatchSize, workers
+}
+
+// openAllocation gets the allocation of opts from the network and starts its
+// batch uploader, which runs until ctx is canceled.
+func openAllocation(ctx context.Context, opts allocationOptions) (*zcnAllocation, error) {
+	codec, err := validateCompressionCodec(opts.CompressionCodec)
+	if err != nil {
+		return nil, err
+	}
+	waitTime, maxBatchSize, workers := opts.batchSettings()
+
+	alloc, err := sdk.GetAllocation(opts.AllocationID)
+	if err != nil {
+		return nil, err
+	}
+	status, _, _ := alloc.CheckAllocStatus()
+	if status == sdk.Broken {
+		return nil, errors.New("allocation_broken")
+	}
+	alloc.SetCheckStatus(true)
+
+	return &zcnAllocation{
+		id:       opts.AllocationID,
+		alloc:    alloc,
+		encrypt:  opts.Encrypt,
+		compress: opts.Compress,
+		codec:    codec,
+		batch:    startBatchUploader(ctx, alloc, waitTime, maxBatchSize, workers),
+		metrics:  minio.NewMetrics(),
+		options:  opts,
+	}, nil
+}
+
+// allocationRegistry maps buckets to the allocations serving them. Buckets
+// keep the layout they have on a single allocation, the objects of bucket b
+// are below /b of its allocation. The root bucket and the buckets that are not
+// mapped are served by the default allocation.
+type allocationRegistry struct {
+	sync.RWMutex
+	ctx          context.Context
+	defaultAlloc *zcnAllocation
+	allocs       map[string]*zcnAllocation // keyed by allocation id
+	buckets      map[string]string         // bucket -> allocation id
+}
+
+func newAllocationRegistry(ctx context.Context, defaultAlloc *zcnAllocation) *allocationRegistry {
+	return &allocationRegistry{
+		ctx:          ctx,
+		defaultAlloc: defaultAlloc,
+		allocs:       map[string]*zcnAllocation{defaultAlloc.id: defaultAlloc},
+		buckets:      make(map[string]string),
+	}
+}
+
+// forBucket returns the allocation serving bucket.
+func (ar *allocationRegistry) forBucket(bucket string) *zcnAllocation {
+	ar.RLock()
+	defer ar.RUnlock()
+	if id, ok := ar.buckets[bucket]; ok {
+		return ar.allocs[id]
+	}
+	return ar.defaultAlloc
+}
+
+// forPath returns the allocation holding remotePath, which is below the
+// directory of its bucket. Paths of the root bucket which start with the name
+// of a mapped bucket are shadowed by that bucket.
+func (ar *allocationRegistry) forPath(remotePath string) *zcnAllocation {
+	bucket := strings.SplitN(strings.TrimPrefix(remotePath, rootPath), "/", 2)[0]
+	return ar.forBucket(bucket)
+}
+
+// list returns all allocations, the default allocation first.
+func (ar *allocationRegistry) list() []*zcnAllocation {
+	ar.RLock()
+	defer ar.RUnlock()
+	list := make([]*zcnAllocation, 0, len(ar.allocs))
+	for _, za := range ar.allocs {
+		if za != ar.defaultAlloc {
+			list = append(list, za)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return append([]*zcnAllocation{ar.defaultAlloc}, list...)
+}
+
+// mappedBuckets returns the buckets mapped to an allocation other than the
+// default one.
+func (ar *allocationRegistry) mappedBuckets() map[string]*zcnAllocation {
+	ar.RLock()
+	defer ar.RUnlock()
+	mapped := make(map[string]*zcnAllocation, len(ar.buckets))
+	for bucket, id := range ar.buckets {
+		if id != ar.defaultAlloc.id {
+			mapped[bucket] = ar.allocs[id]
+		}
+	}
+	return mapped
+}
+
+func validateAllocationOptions(opts allocationOptions) error {
+	if len(opts.AllocationID) != 64 {
+		return fmt.Errorf("allocation id has length %d, should be 64", len(opts.AllocationID))
+	}
+	for _, bucket := range opts.Buckets {
+		if bucket == rootBucketName || bucket == minioMetaBucket || bucket == "" || strings.Contains(bucket, "/") {
+			return fmt.Errorf("bucket %q cannot be mapped to an allocation", bucket)
+		}
+	}
+	return nil
+}
+
+// set serves the buckets of opts from its allocation with its settings,
+// buckets no longer listed for the allocation are served by the default
+// allocation. The batch uploader of an allocation already served is resized
+// to the new settings.
+func (ar *allocationRegistry) set(opts allocationOptions) (*zcnAllocation, error) {
+	if err := validateAllocationOptions(opts); err != nil {
+		return nil, err
+	}
+	ar.RLock()
+	cur, ok := ar.allocs[opts.AllocationID]
+	ar.RUnlock()
+
+	var za *zcnAllocation
+	if ok {
+		codec, err := validateCompressionCodec(opts.CompressionCodec)
+		if err != nil {
+			return nil, err
+		}
+		copied := *cur
+		za = &copied
+		za.encrypt, za.compress, za.codec = opts.Encrypt, opts.Compress, codec
+		za.options = opts
+		za.batch.resize(opts.batchSettings())
+	} else {
+		var err error
+		if za, err = openAllocation(ar.ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	ar.Lock()
+	defer ar.Unlock()
+	ar.register(za)
+	for bucket, id := range ar.buckets {
+		if id == za.id {
+			delete(ar.buckets, bucket)
+		}
+	}
+	for _, bucket := range opts.Buckets {
+		ar.dropBucket(bucket)
+		ar.buckets[bucket] = za.id
+	}
+	return za, nil
+}
+
+func (ar *allocationRegistry) register(za *zcnAllocation) {
+	if za.id == ar.defaultAlloc.id {
+		ar.defaultAlloc = za
+	}
+	ar.allocs[za.id] = za
+}
+
+// setDefaultUploads sets whether uploads to the default allocation are
+// encrypted and compressed.
+func (ar *allocationRegistry) setDefaultUploads(encrypt, compress bool) {
+	ar.Lock()
+	defer ar.Unlock()
+	za := *ar.defaultAlloc
+	za.encrypt, za.compress = encrypt, compress
+	za.options.Encrypt, za.options.Compress = encrypt, compress
+	ar.register(&za)
+}
+
+// dropBucket removes bucket from the allocation it is mapped to, ar must be
+// locked.
+func (ar *allocationRegistry) dropBucket(bucket string) bool {
+	id, ok := ar.buckets[bucket]
+	if !ok {
+		return false
+	}
+	delete(ar.buckets, bucket)
+	za := *ar.allocs[id]
+	za.options.Buckets = nil
+	for _, b := range ar.allocs[id].options.Buckets {
+		if b != bucket {
+			za.options.Buckets = append(za.options.Buckets, b)
+		}
+	}
+	ar.register(&za)
+	return true
+}
+
+// unmapBucket serves bucket from the default allocation again.
+func (ar *allocationRegistry) unmapBucket(bucket string) bool {
+	ar.Lock()
+	defer ar.Unlock()
+	return ar.dropBucket(bucket)
+}
+
+// options returns the allocations of zs3server.json, those without buckets
+// are left out.
+func (ar *allocationRegistry) options() []allocationOptions {
+	opts := []allocationOptions{}
+	for _, za := range ar.list() {
+		if len(za.options.Buckets) == 0 {
+			continue
+		}
+		opts = append(opts, za.options)
+	}
+	return opts
+}
+
+// saveAllocations writes the allocations to zs3server.json, keeping the other
+// options as they are in the file, in their order, and the mode of the file.
+func saveAllocations(opts []allocationOptions) error {
+	data, err := os.ReadFile(serverConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mode := os.FileMode(0o600)
+	if fi, err := os.Stat(serverConfigFile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	allocs, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	if data, err = setJSONField(data, "allocations", allocs); err != nil {
+		return err
+	}
+	tmp := serverConfigFile + ".tmp"
+	if err = os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, serverConfigFile)
+}
+
+// setJSONField returns the JSON object data, which may be empty, with the
+// value of key set to value. The other fields are kept in order, key is
+// appended when missing.
+func setJSONField(data []byte, key string, value json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	var found bool
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if tok, err := dec.Token(); err != nil {
+			return nil, err
+		} else if tok != json.Delim('{') {
+			return nil, fmt.Errorf("%s is not a JSON object", serverConfigFile)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			k, _ := tok.(string)
+			var v json.RawMessage
+			if err = dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			if k == key {
+				v, found = value, true
+			}
+			writeJSONField(&buf, k, v)
+		}
+	}
+	if !found {
+		writeJSONField(&buf, key, value)
+	}
+	buf.WriteByte('}')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value json.RawMessage) {
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(value)
+}
+
+// allocationInfo is an allocation as reported by the admin API.
+type allocationInfo struct {
+	allocationOptions
+	Default       bool   `json:"default,omitempty"`
+	BytesReceived uint64 `json:"bytesReceived"`
+	BytesSent     uint64 `json:"bytesSent"`
+	GetRequests   uint64 `json:"getRequests"`
+	HeadRequests  uint64 `json:"headRequests"`
+	PutRequests   uint64 `json:"putRequests"`
+	PostRequests  uint64 `json:"postRequests"`
+
+	Stats *allocationStats `json:"stats,omitempty"`
+}
+
+func (zob *zcnObjects) allocationInfos(ctx context.Context) []allocationInfo {
+	var infos []allocationInfo
+	for i, za := range allocations.list() {
+		reqs := za.metrics.GetRequests()
+		info := allocationInfo{
+			allocationOptions: za.options,
+			Default:           i == 0,
+			BytesReceived:     za.metrics.GetBytesReceived(),
+			BytesSent:         za.metrics.GetBytesSent(),
+			GetRequests:       reqs.Get,
+			HeadRequests:      reqs.Head,
+			PutRequests:       reqs.Put,
+			PostRequests:      reqs.Post,
+		}
+		if stats, _ := allocStats.get(ctx, za); !stats.Updated.IsZero() {
+			info.Stats = stats
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func invalidAllocationArg(msg string) error {
+	return minio.AdminError{
+		Code:       "XZcnInvalidAllocation",
+		Message:    msg,
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// setAllocation serves the allocation given as allocationOptions in the body
+// of r and saves it to zs3server.json. The directories of its buckets are
+// created when missing.
+func (zob *zcnObjects) setAllocation(ctx context.Context, r *http.Request) ([]allocationInfo, error) {
+	var opts allocationOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		return nil, invalidAllocationArg("invalid allocation: " + err.Error())
+	}
+	if err := validateAllocationOptions(opts); err != nil {
+		return nil, invalidAllocationArg(err.Error())
+	}
+	if _, err := allocations.set(opts); err != nil {
+		return nil, err
+	}
+	if err := zob.loadSystemStores(); err != nil {
+		return nil, err
+	}
+	if err := zob.makeMissingBuckets(ctx, opts.Buckets...); err != nil {
+		return nil, err
+	}
+	if err := saveAllocations(allocations.options()); err != nil {
+		return nil, err
+	}
+	return zob.allocationInfos(ctx), nil
+}
+
+// makeMissingBuckets creates the directories of the buckets which have none on
+// the allocation serving them.
+func (zob *zcnObjects) makeMissingBuckets(ctx context.Context, buckets ...string) error {
+	for _, bucket := range buckets {
+		if _, err := zob.GetBucketInfo(ctx, bucket); err != nil {
+			if _, ok := err.(minio.BucketNotFound); !ok {
+				return err
+			}
+			if err = zob.MakeBucketWithLocation(ctx, bucket, minio.BucketOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unmapAllocationBucket serves the bucket given in the query of r from the
+// allocation given by its allocation parameter and saves the change to
+// zs3server.json. Without it the bucket is served from the default allocation
+// again, which is refused while the bucket still has objects on the allocation
+// it is mapped to: they would no longer be served.
+func (zob *zcnObjects) unmapAllocationBucket(r *http.Request) ([]allocationInfo, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	bucket, target := q.Get("bucket"), q.Get("allocation")
+	za, ok := allocations.mappedBuckets()[bucket]
+	if !ok {
+		return nil, invalidAllocationArg(fmt.Sprintf("bucket %q is not mapped to an allocation", bucket))
+	}
+	if target == za.id {
+		return nil, invalidAllocationArg(fmt.Sprintf("bucket %q is already mapped to allocation %s", bucket, target))
+	}
+
+	var targetAlloc *zcnAllocation
+	for _, ta := range allocations.list() {
+		if ta.id == target {
+			targetAlloc = ta
+		}
+	}
+	switch {
+	case target == "":
+		empty, err := isBucketEmpty(za, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			return nil, invalidAllocationArg(fmt.Sprintf("bucket %q still has objects on allocation %s, the allocation to serve it from is required", bucket, za.id))
+		}
+		allocations.unmapBucket(bucket)
+	case targetAlloc == nil:
+		return nil, invalidAllocationArg(fmt.Sprintf("allocation %s is not served by the gateway", target))
+	case targetAlloc.id == allocations.list()[0].id:
+		allocations.unmapBucket(bucket)
+	default:
+		opts := targetAlloc.options
+		opts.Buckets = append(append([]string(nil), opts.Buckets...), bucket)
+		if _, err := allocations.set(opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := zob.loadSystemStores(); err != nil {
+		return nil, err
+	}
+	if target != "" {
+		if err := zob.makeMissingBuckets(ctx, bucket); err != nil {
+			return nil, err
+		}
+	}
+	if err := saveAllocations(allocations.options()); err != nil {
+		return nil, err
+	}
+	return zob.allocationInfos(ctx), nil
+}
+
+// isBucketEmpty returns whether bucket has no files on za.
+func isBucketEmpty(za *zcnAllocation, bucket string) (bool, error) {
+	oResult, err := getRegularRefs(za.alloc, filepath.Join(rootPath, bucket), "", fileType, 1)
+	if err != nil {
+		if isPathNoExistError(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return len(oResult.Refs) == 0, nil
+}
+
+// loadSystemStores reads the metadata sidecars, bucket configurations and
+// shares of all allocations.
+func (zob *zcnObjects) loadSystemStores() error {
+	if err := sidecars.load(); err != nil {
+		return fmt.Errorf("error loading metadata sidecars: %w", err)
+	}
+	if err := bucketConfigs.load(); err != nil {
+		return fmt.Errorf("error loading bucket configs: %w", err)
+	}
+	if err := shares.load(); err != nil {
+		return fmt.Errorf("error loading shares: %w", err)
+	}
+	return nil
+}
+
+// refreshSystemStores reloads the system stores periodically while the
+// gateway shares its allocations with other gateways, which may change them.
+func (zob *zcnObjects) refreshSystemStores(ctx context.Context) {
+	t := time.NewTicker(systemStoresRefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := zob.loadSystemStores(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
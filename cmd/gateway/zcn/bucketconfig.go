@@ -0,0 +1,267 @@
+package zcn
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+	"github.com/minio/minio/internal/bucket/lifecycle"
+)
+
+const (
+	bucketConfigDir = systemDir + "/buckets"
+
+	// minioMetaBucket is where the server keeps bucket metadata, such as
+	// buckets/<bucket>/.metadata.bin, which is stored in bucketConfigDir.
+	minioMetaBucket    = ".minio.sys"
+	bucketMetaPrefix   = "buckets"
+	bucketMetadataFile = ".metadata.bin"
+)
+
+// bucketConfigs holds the bucket configurations of the allocation served by the gateway.
+var bucketConfigs *bucketConfigStore
+
+// bucketConfigFile is a bucket configuration, such as versioning.xml, as it
+// is stored on the allocation.
+type bucketConfigFile struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Data   []byte `json:"data"`
+}
+
+// bucketConfigStore keeps one file per bucket configuration under
+// bucketConfigDir. Like the metadata sidecars the configuration is repeated in
+// the CustomMeta of its file, so they are all loaded with a single ref listing.
+// The configurations of a bucket are stored on the allocation of the bucket.
+type bucketConfigStore struct {
+	sync.RWMutex
+	configs map[string]map[string][]byte // bucket -> config file name -> data
+}
+
+func newBucketConfigStore() *bucketConfigStore {
+	return &bucketConfigStore{
+		configs: make(map[string]map[string][]byte),
+	}
+}
+
+func bucketConfigPath(bucket, name string) string {
+	return path.Join(bucketConfigDir, bucket, name)
+}
+
+// load reads the bucket configurations stored on all allocations.
+func (bs *bucketConfigStore) load() error {
+	loaded := make(map[string]map[string][]byte)
+	for _, za := range allocations.list() {
+		refs, err := listFiles(za.alloc, bucketConfigDir)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			cf := &bucketConfigFile{}
+			if err := json.Unmarshal([]byte(ref.CustomMeta), cf); err != nil || cf.Bucket == "" || cf.Name == "" {
+				continue
+			}
+			if allocations.forBucket(cf.Bucket).id != za.id {
+				continue
+			}
+			if loaded[cf.Bucket] == nil {
+				loaded[cf.Bucket] = make(map[string][]byte)
+			}
+			loaded[cf.Bucket][cf.Name] = cf.Data
+		}
+	}
+
+	bs.Lock()
+	bs.configs = loaded
+	bs.Unlock()
+	return nil
+}
+
+// get returns the configuration name of bucket, the returned data must not be modified.
+func (bs *bucketConfigStore) get(bucket, name string) ([]byte, bool) {
+	bs.RLock()
+	defer bs.RUnlock()
+	data, ok := bs.configs[bucket][name]
+	return data, ok
+}
+
+func (bs *bucketConfigStore) put(bucket, name string, data []byte) error {
+	cf, err := json.Marshal(&bucketConfigFile{Bucket: bucket, Name: name, Data: data})
+	if err != nil {
+		return err
+	}
+	_, exists := bs.get(bucket, name)
+	alloc := allocations.forBucket(bucket).alloc
+	if err = putSystemFile(alloc, bucketConfigPath(bucket, name), cf, string(cf), exists); err != nil {
+		return err
+	}
+
+	bs.Lock()
+	if bs.configs[bucket] == nil {
+		bs.configs[bucket] = make(map[string][]byte)
+	}
+	bs.configs[bucket][name] = data
+	bs.Unlock()
+	return nil
+}
+
+func (bs *bucketConfigStore) delete(bucket, name string) error {
+	if _, exists := bs.get(bucket, name); !exists {
+		return nil
+	}
+	err := allocations.forBucket(bucket).alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    bucketConfigPath(bucket, name),
+	}})
+	if err != nil && !isSameRootError(err) && !isPathNoExistError(err) {
+		return err
+	}
+
+	bs.Lock()
+	delete(bs.configs[bucket], name)
+	bs.Unlock()
+	return nil
+}
+
+// deleteBucket drops all configurations of a removed bucket.
+func (bs *bucketConfigStore) deleteBucket(bucket string) error {
+	bs.RLock()
+	_, exists := bs.configs[bucket]
+	bs.RUnlock()
+	if !exists {
+		return nil
+	}
+	err := allocations.forBucket(bucket).alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    path.Join(bucketConfigDir, bucket),
+	}})
+	if err != nil && !isSameRootError(err) && !isPathNoExistError(err) {
+		return err
+	}
+
+	bs.Lock()
+	delete(bs.configs, bucket)
+	bs.Unlock()
+	return nil
+}
+
+// bucketLifecycle returns the lifecycle configuration of bucket, nil if it has none.
+func bucketLifecycle(bucket string) (*lifecycle.Lifecycle, error) {
+	data, ok := bucketConfigs.get(bucket, bucketMetadataFile)
+	if !ok || len(data) <= 4 {
+		return nil, nil
+	}
+	// The first 4 bytes are the format and version of the metadata.
+	var meta minio.BucketMetadata
+	if _, err := meta.UnmarshalMsg(data[4:]); err != nil {
+		return nil, err
+	}
+	if len(meta.LifecycleConfigXML) == 0 {
+		return nil, nil
+	}
+	return lifecycle.ParseLifecycleConfig(bytes.NewReader(meta.LifecycleConfigXML))
+}
+
+// metaBucketConfig returns the bucket and configuration name of object in
+// minioMetaBucket, ok is false when it is not a bucket configuration.
+func metaBucketConfig(object string) (bucket, name string, ok bool) {
+	parts := strings.Split(object, "/")
+	if len(parts) != 3 || parts[0] != bucketMetaPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func metaObjectInfo(object string, data []byte) minio.ObjectInfo {
+	sum := md5.Sum(data)
+	return minio.ObjectInfo{
+		Bucket:      minioMetaBucket,
+		Name:        object,
+		ModTime:     time.Now().UTC(),
+		Size:        int64(len(data)),
+		ContentType: "application/octet-stream",
+		ETag:        hex.EncodeToString(sum[:]),
+	}
+}
+
+// getMetaObjectInfo serves GetObjectInfo for minioMetaBucket from the bucket
+// configurations and the server config.
+func (zob *zcnObjects) getMetaObjectInfo(object string) (minio.ObjectInfo, error) {
+	if isServerConfig(object) {
+		return getServerConfigInfo(object)
+	}
+	bucket, name, ok := metaBucketConfig(object)
+	if !ok {
+		return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	data, ok := bucketConfigs.get(bucket, name)
+	if !ok {
+		return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	return metaObjectInfo(object, data), nil
+}
+
+// getMetaObjectNInfo serves GetObjectNInfo for minioMetaBucket from the bucket
+// configurations and the server config.
+func (zob *zcnObjects) getMetaObjectNInfo(ctx context.Context, object string, opts minio.ObjectOptions) (*minio.GetObjectReader, error) {
+	if isServerConfig(object) {
+		return getServerConfig(ctx, object, opts)
+	}
+	bucket, name, ok := metaBucketConfig(object)
+	if !ok {
+		return nil, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	data, ok := bucketConfigs.get(bucket, name)
+	if !ok {
+		return nil, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	return minio.NewGetObjectReaderFromReader(bytes.NewReader(data), metaObjectInfo(object, data), opts)
+}
+
+// putMetaObject serves PutObject for minioMetaBucket, only bucket
+// configurations and the server config are stored.
+func (zob *zcnObjects) putMetaObject(object string, r *minio.PutObjReader) (minio.ObjectInfo, error) {
+	if isServerConfig(object) {
+		return putServerConfig(object, r)
+	}
+	bucket, name, ok := metaBucketConfig(object)
+	if !ok {
+		return minio.ObjectInfo{}, minio.NotImplemented{}
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if err = bucketConfigs.put(bucket, name, data); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return metaObjectInfo(object, data), nil
+}
+
+// deleteMetaObject serves DeleteObject for minioMetaBucket.
+func (zob *zcnObjects) deleteMetaObject(object string) (minio.ObjectInfo, error) {
+	if isServerConfig(object) {
+		return deleteServerConfig(object)
+	}
+	bucket, name, ok := metaBucketConfig(object)
+	if !ok {
+		return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	if _, ok = bucketConfigs.get(bucket, name); !ok {
+		return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+	}
+	if err := bucketConfigs.delete(bucket, name); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return minio.ObjectInfo{Bucket: minioMetaBucket, Name: object}, nil
+}
@@ -0,0 +1,312 @@
+package zcn
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/0chain/gosdk/core/sys"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	minio "github.com/minio/minio/cmd"
+	"github.com/pierrec/lz4/v4"
+)
+
+const (
+	// Keys stored in the CustomMeta of objects compressed by the gateway. They carry
+	// the internal prefix so they are never sent back to S3 clients as user metadata.
+	zcnCompressionKey  = minio.ReservedMetadataPrefix + "Zcn-Compression"
+	zcnContentTypeKey  = minio.ReservedMetadataPrefix + "Zcn-Content-Type"
+	zcnActualSizeKey   = minio.ReservedMetadataPrefix + "Zcn-Actual-Size"
+	zcnSizeTrailerKey  = minio.ReservedMetadataPrefix + "Zcn-Size-Trailer"
+	compressionLZ4     = "lz4"
+	compressionS2      = "s2"
+	compressionZstd    = "zstd"
+	sizeTrailerMagic   = 0x184D2A50 // lz4 skippable frame magic number
+	sizeTrailerDataLen = 8
+	sizeTrailerLen     = 8 + sizeTrailerDataLen
+)
+
+var errInvalidSizeTrailer = errors.New("invalid size trailer in compressed object")
+
+// codecMimeTypes is the content type a compressed object is stored with on the
+// allocation, so other Züs clients can tell it apart from the original data.
+var codecMimeTypes = map[string]string{
+	compressionLZ4:  lz4MimeType,
+	compressionS2:   "application/x-s2",
+	compressionZstd: "application/zstd",
+}
+
+// validateCompressionCodec returns the codec to use when compression is enabled.
+func validateCompressionCodec(codec string) (string, error) {
+	if codec == "" {
+		return compressionLZ4, nil
+	}
+	if _, ok := codecMimeTypes[codec]; !ok {
+		return "", fmt.Errorf("unsupported compression codec %q, should be one of lz4, s2, zstd", codec)
+	}
+	return codec, nil
+}
+
+// compressedObject describes how an object is laid out on the allocation when
+// it was compressed by the gateway.
+type compressedObject struct {
+	codec          string
+	compressedSize int64
+	// hasTrailer is set when the uncompressed size was unknown at upload time and
+	// was appended to the stream as a skippable frame.
+	hasTrailer bool
+}
+
+// compressionMeta returns a copy of userDefined that records the codec and the
+// original content type of an object about to be compressed. A negative
+// actualSize is not known yet, the object records that its size is appended
+// to the stream instead.
+func compressionMeta(userDefined map[string]string, codec, contentType string, actualSize int64) map[string]string {
+	meta := make(map[string]string, len(userDefined)+3)
+	for k, v := range userDefined {
+		meta[k] = v
+	}
+	meta[zcnCompressionKey] = codec
+	meta[zcnContentTypeKey] = contentType
+	if actualSize >= 0 {
+		meta[zcnActualSizeKey] = strconv.FormatInt(actualSize, 10)
+	} else {
+		meta[zcnSizeTrailerKey] = "true"
+	}
+	return meta
+}
+
+// sizeTrailer encodes the uncompressed size as a skippable frame in the layout
+// shared by lz4 and zstd. It is cut off before the stream reaches any decoder.
+func sizeTrailer(size int64) []byte {
+	b := make([]byte, sizeTrailerLen)
+	binary.LittleEndian.PutUint32(b[0:4], sizeTrailerMagic)
+	binary.LittleEndian.PutUint32(b[4:8], sizeTrailerDataLen)
+	binary.LittleEndian.PutUint64(b[8:], uint64(size))
+	return b
+}
+
+func parseSizeTrailer(b []byte) (int64, error) {
+	if len(b) != sizeTrailerLen ||
+		binary.LittleEndian.Uint32(b[0:4]) != sizeTrailerMagic ||
+		binary.LittleEndian.Uint32(b[4:8]) != sizeTrailerDataLen {
+		return 0, errInvalidSizeTrailer
+	}
+	return int64(binary.LittleEndian.Uint64(b[8:])), nil
+}
+
+// setDecompressedInfo rewrites the content type and size of objInfo to the
+// values the client uploaded. It returns nil when the object is not compressed.
+// Objects whose uncompressed size was not recorded with their metadata only
+// have it in their size trailer, which is read when readTrailer is set. Listings
+// do not read it and report the stored size of those objects.
+func setDecompressedInfo(ctx context.Context, alloc *sdk.Allocation, remotePath string, objInfo *minio.ObjectInfo, isEncrypted, readTrailer bool) (*compressedObject, error) {
+	codec := objInfo.UserDefined[zcnCompressionKey]
+	if codec == "" || objInfo.IsDir {
+		return nil, nil
+	}
+
+	co := &compressedObject{
+		codec:          codec,
+		compressedSize: objInfo.Size,
+		hasTrailer:     objInfo.UserDefined[zcnSizeTrailerKey] != "",
+	}
+	if contentType := objInfo.UserDefined[zcnContentTypeKey]; contentType != "" {
+		objInfo.ContentType = contentType
+	}
+	if actualSize, ok := objInfo.UserDefined[zcnActualSizeKey]; ok {
+		size, err := strconv.ParseInt(actualSize, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		objInfo.Size = size
+		return co, nil
+	}
+
+	co.hasTrailer = true
+	if !readTrailer {
+		return co, nil
+	}
+	size, err := readSizeTrailer(ctx, alloc, remotePath, co.compressedSize, isEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	objInfo.Size = size
+	return co, nil
+}
+
+// readSizeTrailer downloads only the blocks holding the last sizeTrailerLen bytes
+// of the object.
+func readSizeTrailer(ctx context.Context, alloc *sdk.Allocation, remotePath string, compressedSize int64, isEncrypted bool) (int64, error) {
+	if compressedSize < sizeTrailerLen {
+		return 0, errInvalidSizeTrailer
+	}
+	chunkSize := getEffectiveChunkSize(alloc, isEncrypted)
+	trailerStart := compressedSize - sizeTrailerLen
+	startBlock := trailerStart/chunkSize + 1
+	endBlock := (compressedSize-1)/chunkSize + 1
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*2)
+	defer cancel()
+
+	cb := statusCB{
+		doneCh: make(chan struct{}, 1),
+		errCh:  make(chan error, 1),
+	}
+	f := &sys.MemFile{}
+	err := alloc.DownloadByBlocksToFileHandler(f, remotePath, startBlock, endBlock, numBlocks, false, &cb, true)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-cb.doneCh:
+	case err := <-cb.errCh:
+		return 0, err
+	case <-ctx.Done():
+		return 0, errors.New("exceeded timeout")
+	}
+
+	if _, err = f.Seek(trailerStart-(startBlock-1)*chunkSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	b := make([]byte, sizeTrailerLen)
+	if _, err = io.ReadFull(f, b); err != nil {
+		return 0, err
+	}
+	return parseSizeTrailer(b)
+}
+
+func newCompressWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case compressionLZ4:
+		zw := lz4.NewWriter(w)
+		zw.Apply(lz4.CompressionLevelOption(lz4.Level1)) //nolint:errcheck
+		return zw, nil
+	case compressionS2:
+		return s2.NewWriter(w), nil
+	case compressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	default:
+		return nil, fmt.Errorf("unknown compression codec: %s", codec)
+	}
+}
+
+func newDecompressReader(codec string, r io.Reader) (io.Reader, error) {
+	switch codec {
+	case compressionLZ4:
+		return lz4.NewReader(r), nil
+	case compressionS2:
+		return s2.NewReader(r), nil
+	case compressionZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec: %s", codec)
+	}
+}
+
+// compressedUpload is a fully compressed object waiting to be uploaded.
+type compressedUpload struct {
+	io.Reader
+	size       int64
+	actualSize int64
+	cleanup    func()
+}
+
+// compressUpload compresses r ahead of the upload so that its compressed size is
+// known, which single part uploads need. Small objects are kept in memory,
+// anything larger or of unknown size is spooled to a file under tempdir.
+func compressUpload(codec string, r io.Reader, size int64) (*compressedUpload, error) {
+	var (
+		dst     io.ReadWriter
+		cleanup = func() {}
+	)
+	if size >= 0 && size <= maxSizeForMemoryFile {
+		dst = &bytes.Buffer{}
+	} else {
+		f, err := os.Create(filepath.Join(tempdir, uuid.New().String()))
+		if err != nil {
+			return nil, err
+		}
+		cleanup = func() {
+			f.Close()
+			os.Remove(f.Name()) //nolint:errcheck
+		}
+		dst = f
+	}
+
+	cw := &countWriter{w: dst}
+	zw, err := newCompressWriter(codec, cw)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	actualSize, err := io.Copy(zw, r)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if f, ok := dst.(*os.File); ok {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	return &compressedUpload{
+		Reader:     dst,
+		size:       cw.n,
+		actualSize: actualSize,
+		cleanup:    cleanup,
+	}, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// getDecompressedReader streams the whole compressed object and decompresses it
+// on the fly. Compressed streams are not seekable, so the length bytes at
+// offset are served by discarding the decompressed bytes that precede them.
+func getDecompressedReader(ctx context.Context, alloc *sdk.Allocation, remotePath string, co *compressedObject, chunkSize, offset, length int64) (io.Reader, func(), error) {
+	dataSize := co.compressedSize
+	if co.hasTrailer {
+		dataSize -= sizeTrailerLen
+	}
+	r, fCloser := streamBlocks(ctx, alloc, remotePath, co.compressedSize, chunkSize, 0, dataSize, time.Minute*30)
+
+	zr, err := newDecompressReader(co.codec, r)
+	if err != nil {
+		fCloser()
+		return nil, nil, err
+	}
+	if offset > 0 {
+		if _, err = io.CopyN(io.Discard, zr, offset); err != nil {
+			fCloser()
+			return nil, nil, err
+		}
+	}
+	return io.LimitReader(zr, length), fCloser, nil
+}
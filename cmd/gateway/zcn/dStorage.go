@@ -7,17 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	zerror "github.com/0chain/errors"
 	"github.com/0chain/gosdk/constants"
-	"github.com/0chain/gosdk/core/sys"
 	"github.com/0chain/gosdk/zboxcore/sdk"
-	"github.com/google/uuid"
 	minio "github.com/minio/minio/cmd"
 	"github.com/minio/minio/internal/logger"
 )
@@ -132,6 +132,9 @@ func listRegularRefs(alloc *sdk.Allocation, remotePath, marker, fileType string,
 
 			for i := 0; i < len(oResult.Refs); i++ {
 				ref := oResult.Refs[i]
+				if isSystemPath(ref.Path) {
+					continue
+				}
 				trimmedPath := strings.TrimPrefix(ref.Path, currentRemotePath+"/")
 				if ref.Type == dirType {
 					if _, ok := dirMap[ref.Path]; ok {
@@ -184,16 +187,35 @@ func getRegularRefs(alloc *sdk.Allocation, remotePath, offsetPath, objFileType s
 	}
 	remotePath = filepath.Clean(remotePath)
 	oResult, err = alloc.GetRefs(remotePath, offsetPath, "", "", objFileType, "regular", level, pageLimit)
+	if err != nil {
+		return
+	}
+	for i := range oResult.Refs {
+		sidecars.apply(&oResult.Refs[i])
+	}
 	return
 }
 
+// getSingleRegularRef returns the ref of remotePath with the metadata of its
+// sidecar, if any.
 func getSingleRegularRef(alloc *sdk.Allocation, remotePath string) (*sdk.ORef, error) {
+	ref, err := getStoredRef(alloc, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	sidecars.apply(ref)
+	return ref, nil
+}
+
+// getStoredRef returns the ref of remotePath as it is stored on the allocation.
+func getStoredRef(alloc *sdk.Allocation, remotePath string) (*sdk.ORef, error) {
 	level := len(strings.Split(strings.TrimSuffix(remotePath, "/"), "/"))
 	remotePath = filepath.Clean(remotePath)
 	oREsult, err := alloc.GetRefs(remotePath, "", "", "", "", "regular", level, 1)
 	if err != nil {
 		logger.Error("error with GetRefs", err.Error(), " this is the error")
 		if isConsensusFailedError(err) {
+			atomic.AddUint64(&counters.consensusRetries, 1)
 			time.Sleep(retryWaitTime)
 			oREsult, err = alloc.GetRefs(remotePath, "", "", "", "", "regular", level, 1)
 			if err != nil {
@@ -236,7 +258,11 @@ func getObjectRef(alloc *sdk.Allocation, bucket, object, remotePath string) (*mi
 		ref.MimeType = s3DirectoryContentType
 		ref.ActualFileSize = 0
 	}
-	return &minio.ObjectInfo{
+	var userDefined map[string]string
+	if ref.CustomMeta != "" {
+		_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
+	}
+	objInfo := &minio.ObjectInfo{
 		Bucket:      bucket,
 		Name:        ref.Name,
 		ModTime:     ref.UpdatedAt.ToTime(),
@@ -244,140 +270,117 @@ func getObjectRef(alloc *sdk.Allocation, bucket, object, remotePath string) (*mi
 		IsDir:       ref.Type == dirType,
 		ContentType: ref.MimeType,
 		ETag:        ref.ActualFileHash,
-	}, isEncrypted, nil
-}
-
-func getFileReader(ctx context.Context,
-	alloc *sdk.Allocation,
-	bucket, object, remotePath string, rangeStart int64, rangeEnd int64) (io.Reader, *minio.ObjectInfo, func(), string, error) {
-	downloadID := uuid.New().String()
-	localFilePath := filepath.Join(tempdir, downloadID)
-	fileRangeSize := rangeEnd - rangeStart + 1
-
-	cb := statusCB{
-		doneCh: make(chan struct{}, 1),
-		errCh:  make(chan error, 1),
-	}
-
-	objectInfo, isEncrypted, err := getObjectRef(alloc, bucket, object, remotePath)
-	if err != nil {
-		return nil, nil, nil, "", err
-	}
-	if rangeEnd < rangeStart {
-		fileRangeSize = objectInfo.Size
+		UserDefined: userDefined,
 	}
-	var timeout time.Duration
-	if objectInfo.ContentType == lz4MimeType {
-		timeout = time.Minute * 30
-	} else {
-		timeout = getTimeOut(uint64(fileRangeSize))
-	}
-	var ctxCncl context.CancelFunc
-	ctx, ctxCncl = context.WithTimeout(ctx, timeout)
+	setMetaInfo(objInfo)
+	setEncryptionInfo(objInfo, isEncrypted)
+	setVersionInfo(objInfo)
+	return objInfo, isEncrypted, nil
+}
 
-	var startBlock, endBlock int64
-	dataShards := int64(alloc.DataShards)
+func getEffectiveChunkSize(alloc *sdk.Allocation, isEncrypted bool) int64 {
 	effectiveBlockSize := int64(defaultChunkSize)
 	if isEncrypted {
 		effectiveBlockSize -= sdk.EncryptionHeaderSize + sdk.EncryptedDataPaddingSize
 	}
-	effectiveChunkSize := effectiveBlockSize * int64(dataShards)
+	return effectiveBlockSize * int64(alloc.DataShards)
+}
 
-	if rangeEnd >= rangeStart {
-		startBlock = int64(rangeStart / effectiveChunkSize)
-		if startBlock == 0 {
-			startBlock = 1
-		}
-		if rangeEnd < fileRangeSize {
-			endBlock = (fileRangeSize + effectiveChunkSize - 1) / effectiveChunkSize
-		} else {
-			endBlock = int64(rangeEnd+effectiveChunkSize-1) / effectiveChunkSize
-		}
-	} else {
-		startBlock = 1
-		endBlock = 0
+// getFileReader streams the object at remotePath, only the blocks holding the
+// range rs are downloaded when it is set. The returned func stops the download.
+func getFileReader(ctx context.Context, alloc *sdk.Allocation, bucket, object, remotePath string, rs *minio.HTTPRangeSpec) (io.Reader, *minio.ObjectInfo, func(), error) {
+	objectInfo, isEncrypted, err := getObjectRef(alloc, bucket, object, remotePath)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-
-	if rangeEnd == -1 {
-		endBlock = 0
-		startBlock = int64(rangeStart / effectiveChunkSize)
-		if startBlock == 0 {
-			startBlock = 1
+	co, err := setDecompressedInfo(ctx, alloc, remotePath, objectInfo, isEncrypted, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	offset, length := int64(0), objectInfo.Size
+	if rs != nil {
+		if offset, length, err = rs.GetOffsetLength(objectInfo.Size); err != nil {
+			return nil, nil, nil, err
 		}
-		fileRangeSize = objectInfo.Size - rangeStart
 	}
-
-	var r sys.File
-	if startBlock == 1 && endBlock == 0 {
-		pr, pw := io.Pipe()
-		r = &pipeFile{w: pw}
-		go func() {
-			defer ctxCncl()
-			err = alloc.DownloadByBlocksToFileHandler(r, remotePath, startBlock, endBlock, numBlocks, false, &cb, true)
-			if err != nil {
-				pw.CloseWithError(err)
-				return
-			}
-			select {
-			case <-cb.doneCh:
-				pw.Close()
-			case err := <-cb.errCh:
-				pw.CloseWithError(err)
-				return
-			case <-ctx.Done():
-				pw.CloseWithError(errors.New("exceeded timeout"))
-				return
-			}
-		}()
-		return pr, objectInfo, func() { pr.Close() }, localFilePath, nil
-	} else {
-		defer ctxCncl()
-		if fileRangeSize > maxSizeForMemoryFile {
-			r, err = os.Create(localFilePath)
-			if err != nil {
-				return nil, nil, nil, "", err
-			}
-		} else {
-			localFilePath = ""
-			r = &sys.MemFile{}
+	chunkSize := getEffectiveChunkSize(alloc, isEncrypted)
+	if co != nil {
+		r, fCloser, err := getDecompressedReader(ctx, alloc, remotePath, co, chunkSize, offset, length)
+		if err != nil {
+			return nil, nil, nil, err
 		}
+		return r, objectInfo, fCloser, nil
 	}
-	err = alloc.DownloadByBlocksToFileHandler(r, remotePath, startBlock, endBlock, numBlocks, false, &cb, true)
-	if err != nil {
-		return nil, nil, nil, "", err
+	if length == 0 {
+		return strings.NewReader(""), objectInfo, func() {}, nil
 	}
 
-	select {
-	case <-cb.doneCh:
-	case err := <-cb.errCh:
-		return nil, nil, nil, "", err
-	case <-ctx.Done():
-		return nil, nil, nil, "", errors.New("exceeded timeout")
+	timeout := getTimeOut(uint64(length))
+	if objectInfo.ContentType == lz4MimeType {
+		timeout = time.Minute * 30
 	}
+	r, fCloser := streamBlocks(ctx, alloc, remotePath, objectInfo.Size, chunkSize, offset, length, timeout)
+	return r, objectInfo, fCloser, nil
+}
 
-	startOffset := rangeStart - (startBlock-1)*effectiveChunkSize
-	if startOffset < 0 {
-		startOffset = 0
-	}
-	_, err = r.Seek(startOffset, io.SeekStart)
-	if err != nil {
-		return nil, nil, nil, "", err
+// streamBlocks downloads the blocks of a file of size bytes holding length
+// bytes at offset and streams those bytes as the blocks arrive, the sdk reads
+// ahead numBlocks blocks at a time. The download fails after timeout and stops
+// when ctx is canceled or the returned func is called.
+func streamBlocks(ctx context.Context, alloc *sdk.Allocation, remotePath string, size, chunkSize, offset, length int64, timeout time.Duration) (io.Reader, func()) {
+	startBlock := offset/chunkSize + 1
+	endBlock := (offset+length-1)/chunkSize + 1
+	if endBlock >= (size+chunkSize-1)/chunkSize {
+		endBlock = 0 // up to the last block
 	}
 
-	// create a new limited reader
-	f := io.LimitReader(r, fileRangeSize)
-	fCloser := func() {
-		r.Close() //nolint:errcheck
-		if localFilePath != "" {
-			os.Remove(localFilePath) // nolint:errcheck
+	cb := statusCB{
+		doneCh: make(chan struct{}, 1),
+		errCh:  make(chan error, 1),
+	}
+	ctx, ctxCncl := context.WithTimeout(ctx, timeout)
+	pr, pw := io.Pipe()
+	go func() {
+		defer ctxCncl()
+		pf := newPipeFile(pw, offset-(startBlock-1)*chunkSize, length)
+		err := alloc.DownloadByBlocksToFileHandler(pf, remotePath, startBlock, endBlock, numBlocks, false, &cb, true)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		select {
+		case <-cb.doneCh:
+			pw.Close()
+		case err := <-cb.errCh:
+			pw.CloseWithError(err)
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				pw.CloseWithError(errors.New("exceeded timeout"))
+			} else {
+				pw.CloseWithError(ctx.Err())
+			}
 		}
+	}()
+	return pr, func() {
+		ctxCncl()
+		pr.Close()
 	}
-	return f, objectInfo, fCloser, localFilePath, nil
-
 }
 
-func putFile(ctx context.Context, alloc *sdk.Allocation, remotePath, contentType string, r io.Reader, size int64, isUpdate bool, userDefined map[string]string) (err error) {
+func putFile(ctx context.Context, za *zcnAllocation, remotePath, contentType string, r io.Reader, size int64, isUpdate bool, userDefined map[string]string) (err error) {
+	za.incRequests(http.MethodPut)
 	fileName := filepath.Base(remotePath)
+	if codec := za.compressionCodec(fileName, contentType); codec != "" {
+		var cu *compressedUpload
+		cu, err = compressUpload(codec, r, size)
+		if err != nil {
+			return
+		}
+		defer cu.cleanup()
+		userDefined = compressionMeta(userDefined, codec, contentType, cu.actualSize)
+		contentType = codecMimeTypes[codec]
+		r, size = cu, cu.size
+	}
 	var customMeta string
 	if len(userDefined) > 0 {
 		meta, _ := json.Marshal(userDefined)
@@ -405,7 +408,7 @@ func putFile(ctx context.Context, alloc *sdk.Allocation, remotePath, contentType
 		FileMeta:      fileMeta,
 		Opts: []sdk.ChunkedUploadOption{
 			sdk.WithChunkNumber(120),
-			sdk.WithEncrypt(encrypt),
+			sdk.WithEncrypt(isEncryptedUpload(userDefined)),
 		},
 		StreamUpload: isStreamUpload,
 	}
@@ -413,7 +416,7 @@ func putFile(ctx context.Context, alloc *sdk.Allocation, remotePath, contentType
 		opRequest.OperationType = constants.FileOperationUpdate
 	}
 	if isStreamUpload {
-		err = alloc.DoMultiOperation([]sdk.OperationRequest{opRequest})
+		err = za.alloc.DoMultiOperation([]sdk.OperationRequest{opRequest})
 		if err != nil && !isSameRootError(err) {
 			logger.Error(err.Error())
 			return
@@ -422,13 +425,17 @@ func putFile(ctx context.Context, alloc *sdk.Allocation, remotePath, contentType
 	} else {
 		opCtx, opCancelCause := context.WithCancelCause(ctx)
 		opRequest.CancelCauseFunc = opCancelCause
-		batchUploadChan <- opRequest
+		za.batch.uploadChan <- opRequest
 
 		<-opCtx.Done()
 		if context.Cause(opCtx) != context.Canceled {
 			err = context.Cause(opCtx)
 		}
 	}
+	if err == nil {
+		atomic.AddUint64(&counters.uploads, 1)
+		za.incBytesSent(size)
+	}
 	return
 }
 
@@ -480,5 +487,9 @@ func isSameRootError(err error) bool {
 	if err == nil {
 		return false
 	}
-	return strings.Contains(err.Error(), "previous allocation root are same")
+	if !strings.Contains(err.Error(), "previous allocation root are same") {
+		return false
+	}
+	atomic.AddUint64(&counters.sameRootErrors, 1)
+	return true
 }
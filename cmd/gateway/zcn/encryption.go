@@ -0,0 +1,64 @@
+package zcn
+
+import (
+	minio "github.com/minio/minio/cmd"
+	xhttp "github.com/minio/minio/internal/http"
+)
+
+// zcnEncryptionKey is stored in the CustomMeta of objects the gateway uploaded
+// with Züs client-side encryption, it records the server side encryption the
+// object was given to S3 clients.
+const zcnEncryptionKey = minio.ReservedMetadataPrefix + "Zcn-Encryption"
+
+// BackendEncryption implements minio.GatewayEncryption, objects requesting
+// server side encryption are encrypted by Züs.
+func (zob *zcnObjects) BackendEncryption() bool {
+	return true
+}
+
+// encryptUpload reports whether an object uploaded to za with opts is
+// encrypted. Objects requesting server side encryption, by header or through
+// the default encryption of their bucket, are always encrypted, the others
+// follow the encrypt setting of the allocation.
+func encryptUpload(za *zcnAllocation, opts minio.ObjectOptions) bool {
+	return opts.ServerSideEncryption != nil || za.encrypt
+}
+
+// encryptionMeta returns a copy of userDefined that records whether the object
+// about to be uploaded is encrypted.
+func encryptionMeta(userDefined map[string]string, encrypt bool) map[string]string {
+	meta := make(map[string]string, len(userDefined)+1)
+	for k, v := range userDefined {
+		meta[k] = v
+	}
+	delete(meta, xhttp.AmzServerSideEncryption)
+	delete(meta, zcnEncryptionKey)
+	if encrypt {
+		meta[zcnEncryptionKey] = xhttp.AmzEncryptionAES
+	}
+	return meta
+}
+
+// isEncryptedUpload reports whether the upload described by userDefined was
+// chosen to be encrypted by encryptionMeta.
+func isEncryptedUpload(userDefined map[string]string) bool {
+	_, ok := userDefined[zcnEncryptionKey]
+	return ok
+}
+
+// setEncryptionInfo reports the encryption of an object to S3 clients, objects
+// encrypted by other Züs clients are reported like the ones of the gateway.
+func setEncryptionInfo(objInfo *minio.ObjectInfo, isEncrypted bool) {
+	if !isEncrypted {
+		delete(objInfo.UserDefined, xhttp.AmzServerSideEncryption)
+		return
+	}
+	if objInfo.UserDefined == nil {
+		objInfo.UserDefined = make(map[string]string, 1)
+	}
+	algorithm := objInfo.UserDefined[zcnEncryptionKey]
+	if algorithm == "" {
+		algorithm = xhttp.AmzEncryptionAES
+	}
+	objInfo.UserDefined[xhttp.AmzServerSideEncryption] = algorithm
+}
@@ -5,21 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0chain/gosdk/constants"
 	"github.com/minio/minio/internal/logger"
 	"github.com/minio/pkg/mimedb"
 	"github.com/mitchellh/go-homedir"
-	"golang.org/x/sync/semaphore"
 
 	"github.com/0chain/gosdk/zboxcore/sdk"
 	"github.com/minio/cli"
@@ -32,14 +34,13 @@ const (
 	rootBucketName         = "root"
 	s3DirectoryContentType = "application/x-directory; charset=UTF-8"
 	s3ContentHash          = "d41d8cd98f00b204e9800998ecf8427e"
+	nullVersionID          = "null"
 )
 
 var (
 	configDir     string
 	allocationID  string
 	nonce         int64
-	encrypt       bool
-	compress      bool
 	workDir       string
 	serverConfig  serverOptions
 	walletDetails string
@@ -129,10 +130,17 @@ func (z *ZCN) Name() string {
 	return minio.ZCNBAckendGateway
 }
 
-var (
-	contentMap  map[string]*semaphore.Weighted
-	contentLock sync.Mutex
-)
+// KeepsBucketMetadata implements minio.GatewayMetadata, bucket metadata is
+// stored on the allocation.
+func (z *ZCN) KeepsBucketMetadata() bool {
+	return true
+}
+
+// KeepsConfig implements minio.GatewayMetadata, the server config is stored on
+// the allocation.
+func (z *ZCN) KeepsConfig() bool {
+	return true
+}
 
 // NewGatewayLayer initializes 0chain gosdk and return zcnObjects
 func (z *ZCN) NewGatewayLayer(creds madmin.Credentials) (minio.ObjectLayer, error) {
@@ -140,58 +148,80 @@ func (z *ZCN) NewGatewayLayer(creds madmin.Credentials) (minio.ObjectLayer, erro
 	if err != nil {
 		return nil, err
 	}
-	log.Println("0chain gosdk initialized: ", allocationID, "compress: ", compress, "encrypt: ", encrypt)
-	if serverConfig.UploadWorkers > 0 {
-		sdk.SetHighModeWorkers(serverConfig.UploadWorkers)
-	}
-	if serverConfig.DownloadWorkers > 0 {
-		sdk.SetDownloadWorkerCount(serverConfig.DownloadWorkers)
-	}
-	allocation, err := sdk.GetAllocation(allocationID)
-	if err != nil {
-		return nil, err
-	}
-	status, _, _ := allocation.CheckAllocStatus()
-	if status == sdk.Broken {
-		return nil, errors.New("allocation_broken")
-	}
-	if allocation.StorageVersion == sdk.StorageV2 && status == sdk.Broken {
-		return nil, errors.New("repair_allocation")
-	}
+	log.Println("0chain gosdk initialized: ", allocationID, "compress: ", serverConfig.Compress, "codec: ", serverConfig.CompressionCodec, "encrypt: ", serverConfig.Encrypt)
+	applySDKOptions(serverConfig)
 	sdk.CurrentMode = sdk.UploadModeHigh
-	sdk.SetSingleClietnMode(true)
+	// Other gateways write to the allocation too when it is distributed.
+	sdk.SetSingleClietnMode(!minio.IsGatewayDistributed())
 	sdk.SetShouldVerifyHash(false)
 	sdk.SetSaveProgress(false)
-	allocation.SetCheckStatus(true)
-	zob := &zcnObjects{
-		alloc:   allocation,
-		metrics: minio.NewMetrics(),
-	}
 	debug.SetGCPercent(50)
 	workDir, err = homedir.Dir()
 	if err != nil {
 		return nil, err
 	}
-	contentMap = make(map[string]*semaphore.Weighted)
 	ctx, cancel := context.WithCancel(context.Background())
-	zob.ctxCancel = cancel
-	IntiBatchUploadWorkers(ctx, allocation, serverConfig.BatchWaitTime, serverConfig.MaxBatchSize, serverConfig.BatchWorkers)
-	sdk.BatchSize = serverConfig.MaxConcurrentRequests
-	sdk.SetMultiOpBatchSize(serverConfig.MaxBatchSize)
+	defaultAlloc, err := openAllocation(ctx, allocationOptions{
+		AllocationID:     allocationID,
+		Encrypt:          serverConfig.Encrypt,
+		Compress:         serverConfig.Compress,
+		CompressionCodec: serverConfig.CompressionCodec,
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	allocations = newAllocationRegistry(ctx, defaultAlloc)
+	for _, opts := range serverConfig.Allocations {
+		za, err := allocations.set(opts)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("allocation %s: %w", opts.AllocationID, err)
+		}
+		log.Println("serving buckets", opts.Buckets, "from allocation", za.id, "compress: ", za.compress, "codec: ", za.codec, "encrypt: ", za.encrypt)
+	}
+	zob := &zcnObjects{
+		ctxCancel: cancel,
+	}
+	bucketConfigs = newBucketConfigStore()
+	shares = newShareStore()
+	if err := zob.loadSystemStores(); err != nil {
+		log.Println(err)
+	}
+	if minio.IsGatewayDistributed() {
+		go zob.refreshSystemStores(ctx)
+	}
+	if serverConfig.RefIndex && minio.IsGatewayDistributed() {
+		// The other gateways write to the same allocations, the index would
+		// miss their changes.
+		log.Println("ref index is not used by distributed gateways")
+	} else if serverConfig.RefIndex {
+		refIndexes = newRefIndexRegistry(ctx, filepath.Join(filepath.Dir(serverConfigFile), refIndexDir),
+			time.Duration(serverConfig.RefIndexInterval)*time.Minute)
+		for _, za := range allocations.list() {
+			refIndexes.get(za)
+		}
+	}
+	zob.recoverMultipartUploads(localStorageDir)
+	zob.lifecycle = newLifecycleSweeper(zob, time.Duration(serverConfig.LifecycleInterval)*time.Minute)
+	go zob.lifecycle.run(ctx)
+	zob.health = newHealthMonitor(time.Duration(serverConfig.HealthCheckInterval)*time.Second, serverConfig.AutoRepair)
+	go zob.health.run(ctx)
 	return zob, nil
 }
 
 type zcnObjects struct {
 	minio.GatewayUnsupported
-	alloc     *sdk.Allocation
-	metrics   *minio.BackendMetrics
 	ctxCancel context.CancelFunc
+	lifecycle *lifecycleSweeper
+	health    *healthMonitor
 }
 
 // Shutdown Remove temporary directory
 func (zob *zcnObjects) Shutdown(ctx context.Context) error {
 	os.RemoveAll(tempdir)
 	zob.ctxCancel()
+	refIndexes.save()
 	return nil
 }
 
@@ -204,7 +234,7 @@ func (zob *zcnObjects) Production() bool {
 }
 
 func (zob *zcnObjects) GetMetrics(ctx context.Context) (*minio.BackendMetrics, error) {
-	return zob.metrics, nil
+	return gatewayMetrics, nil
 }
 
 // DeleteBucket Delete only empty bucket unless forced
@@ -212,10 +242,14 @@ func (zob *zcnObjects) DeleteBucket(ctx context.Context, bucketName string, opts
 	if bucketName == rootBucketName {
 		return errors.New("cannot remove root path")
 	}
+	if err := zob.health.writable(bucketName); err != nil {
+		return err
+	}
+	alloc := allocations.forBucket(bucketName).alloc
 
 	remotePath := filepath.Join(rootPath, bucketName)
 
-	ref, err := getSingleRegularRef(zob.alloc, remotePath)
+	ref, err := getSingleRegularRef(alloc, remotePath)
 	if err != nil {
 		return err
 	}
@@ -224,39 +258,89 @@ func (zob *zcnObjects) DeleteBucket(ctx context.Context, bucketName string, opts
 		return fmt.Errorf("%v is object not bucket", bucketName)
 	}
 
-	if opts.Force || ref.Size == 0 {
-		op := sdk.OperationRequest{
-			OperationType: constants.FileOperationDelete,
-			RemotePath:    remotePath,
+	if !opts.Force && ref.Size != 0 {
+		return minio.BucketNotEmpty{Bucket: bucketName}
+	}
+
+	ops := []sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    remotePath,
+	}}
+	// Noncurrent versions keep a bucket from being deleted, as on S3.
+	versionsPath := path.Join(versionsDir, remotePath)
+	oResult, err := getRegularRefs(alloc, versionsPath, "", fileType, 1)
+	if err != nil && !isPathNoExistError(err) {
+		return err
+	}
+	if err == nil && len(oResult.Refs) > 0 {
+		if !opts.Force {
+			return minio.BucketNotEmpty{Bucket: bucketName}
 		}
-		return zob.alloc.DoMultiOperation([]sdk.OperationRequest{op})
+		ops = append(ops, sdk.OperationRequest{
+			OperationType: constants.FileOperationDelete,
+			RemotePath:    versionsPath,
+		})
+	}
+	if err = alloc.DoMultiOperation(ops); err != nil {
+		return err
 	}
-	return minio.BucketNotEmpty{Bucket: bucketName}
+	indexRefresh(allocations.forBucket(bucketName), remotePath)
+	return bucketConfigs.deleteBucket(bucketName)
 }
 
 func (zob *zcnObjects) DeleteObject(ctx context.Context, bucket, object string, opts minio.ObjectOptions) (oInfo minio.ObjectInfo, err error) {
+	if bucket == minioMetaBucket {
+		return zob.deleteMetaObject(object)
+	}
+	if err = zob.health.writable(bucket); err != nil {
+		return
+	}
+	za := allocations.forBucket(bucket)
+	alloc := za.alloc
+
 	var remotePath string
 	if bucket == rootBucketName {
 		remotePath = filepath.Join(rootPath, object)
 	} else {
 		remotePath = filepath.Join(rootPath, bucket, object)
 	}
+	unlock, err := lockPath(ctx, za, remotePath)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	defer func() {
+		if err == nil {
+			indexRefresh(za, remotePath)
+		}
+	}()
+
+	if opts.VersionID != "" {
+		return zob.deleteObjectVersion(bucket, object, remotePath, opts.VersionID)
+	}
 
 	var ref *sdk.ORef
-	ref, err = getSingleRegularRef(zob.alloc, remotePath)
+	ref, err = getSingleRegularRef(alloc, remotePath)
 	if err != nil {
+		if (opts.Versioned || opts.VersionSuspended) && isPathNoExistError(err) {
+			return zob.putDeleteMarker(bucket, object, remotePath, nil, opts.Versioned)
+		}
 		return
 	}
+	if (opts.Versioned || opts.VersionSuspended) && ref.Type == fileType {
+		return zob.putDeleteMarker(bucket, object, remotePath, ref, opts.Versioned)
+	}
 
 	op := sdk.OperationRequest{
 		OperationType: constants.FileOperationDelete,
 		RemotePath:    remotePath,
 	}
 
-	err = zob.alloc.DoMultiOperation([]sdk.OperationRequest{op})
+	err = alloc.DoMultiOperation([]sdk.OperationRequest{op})
 	if err != nil {
 		return
 	}
+	sidecars.remove(remotePath)
 	return minio.ObjectInfo{
 		Bucket:  bucket,
 		Name:    ref.Name,
@@ -267,15 +351,47 @@ func (zob *zcnObjects) DeleteObject(ctx context.Context, bucket, object string,
 }
 
 func (zob *zcnObjects) DeleteObjects(ctx context.Context, bucket string, objects []minio.ObjectToDelete, opts minio.ObjectOptions) (delObs []minio.DeletedObject, errs []error) {
+	if err := zob.health.writable(bucket); err != nil {
+		errs = make([]error, len(objects))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]minio.DeletedObject, len(objects)), errs
+	}
+	za := allocations.forBucket(bucket)
 	var basePath string
 	if bucket == rootBucketName {
 		basePath = rootPath
 	} else {
 		basePath = filepath.Join(rootPath, bucket)
 	}
+
+	versioned := opts.Versioned || opts.VersionSuspended
+	for _, object := range objects {
+		versioned = versioned || object.VersionID != ""
+	}
+	if versioned {
+		// Versions are archived or restored one object at a time.
+		for _, object := range objects {
+			objOpts := opts
+			objOpts.VersionID = object.VersionID
+			objInfo, err := zob.DeleteObject(ctx, bucket, object.ObjectName, objOpts)
+			delObj := minio.DeletedObject{ObjectName: object.ObjectName, VersionID: object.VersionID}
+			if objInfo.DeleteMarker {
+				delObj.DeleteMarker = true
+				delObj.DeleteMarkerVersionID = objInfo.VersionID
+			}
+			delObs = append(delObs, delObj)
+			errs = append(errs, err)
+		}
+		return
+	}
+
 	ops := make([]sdk.OperationRequest, 0, len(objects))
+	remotePaths := make([]string, 0, len(objects))
 	for _, object := range objects {
 		remotePath := filepath.Join(basePath, object.ObjectName)
+		remotePaths = append(remotePaths, remotePath)
 		ops = append(ops, sdk.OperationRequest{
 			OperationType: constants.FileOperationDelete,
 			RemotePath:    remotePath,
@@ -283,7 +399,14 @@ func (zob *zcnObjects) DeleteObjects(ctx context.Context, bucket string, objects
 		delObs = append(delObs, minio.DeletedObject{})
 		errs = append(errs, nil)
 	}
-	err := zob.alloc.DoMultiOperation(ops)
+	unlock, err := lockPath(ctx, za, remotePaths...)
+	if err == nil {
+		err = za.alloc.DoMultiOperation(ops)
+		if err == nil {
+			sidecars.remove(remotePaths...)
+		}
+		unlock()
+	}
 	if err != nil {
 		for i := 0; i < len(errs); i++ {
 			errs[i] = err
@@ -292,6 +415,7 @@ func (zob *zcnObjects) DeleteObjects(ctx context.Context, bucket string, objects
 		for i := 0; i < len(delObs); i++ {
 			delObs[i].ObjectName = objects[i].ObjectName
 		}
+		indexRefresh(za, remotePaths...)
 	}
 	log.Println("DeletedObjects", len(delObs), len(errs))
 	return
@@ -299,6 +423,7 @@ func (zob *zcnObjects) DeleteObjects(ctx context.Context, bucket string, objects
 
 // GetBucketInfo Get directory's metadata and present it as minio.BucketInfo
 func (zob *zcnObjects) GetBucketInfo(ctx context.Context, bucket string) (bi minio.BucketInfo, err error) {
+	alloc := allocations.forBucket(bucket).alloc
 	var remotePath string
 	if bucket == rootBucketName {
 		remotePath = rootPath
@@ -307,7 +432,7 @@ func (zob *zcnObjects) GetBucketInfo(ctx context.Context, bucket string) (bi min
 	}
 
 	var ref *sdk.ORef
-	ref, err = getSingleRegularRef(zob.alloc, remotePath)
+	ref, err = getSingleRegularRef(alloc, remotePath)
 	if err != nil {
 		if isPathNoExistError(err) {
 			if remotePath == rootPath {
@@ -327,6 +452,13 @@ func (zob *zcnObjects) GetBucketInfo(ctx context.Context, bucket string) (bi min
 
 // GetObjectInfo Get file meta data and respond it as minio.ObjectInfo
 func (zob *zcnObjects) GetObjectInfo(ctx context.Context, bucket, object string, opts minio.ObjectOptions) (objInfo minio.ObjectInfo, err error) {
+	if bucket == minioMetaBucket {
+		return zob.getMetaObjectInfo(object)
+	}
+	za := allocations.forBucket(bucket)
+	za.incRequests(http.MethodHead)
+	alloc := za.alloc
+
 	var remotePath string
 	if bucket == rootBucketName {
 		remotePath = filepath.Join(rootPath, object)
@@ -334,13 +466,24 @@ func (zob *zcnObjects) GetObjectInfo(ctx context.Context, bucket, object string,
 		remotePath = filepath.Join(rootPath, bucket, object)
 	}
 
+	if opts.VersionID != "" {
+		return zob.getObjectVersionInfo(ctx, bucket, object, filepath.Clean(remotePath), opts.VersionID)
+	}
+
 	var ref *sdk.ORef
-	ref, err = getSingleRegularRef(zob.alloc, filepath.Clean(remotePath))
-	if err != nil {
-		if isPathNoExistError(err) {
-			return objInfo, minio.ObjectNotFound{Bucket: bucket, Object: object}
+	if tree := refIndexes.ready(za); tree != nil {
+		ref, _ = lookupRef(tree, remotePath)
+	}
+	if ref == nil {
+		// Files written by other Züs clients are missing from the index until
+		// it is rebuilt.
+		ref, err = getSingleRegularRef(alloc, filepath.Clean(remotePath))
+		if err != nil {
+			if isPathNoExistError(err) {
+				return zob.objectNotFound(bucket, object, filepath.Clean(remotePath))
+			}
+			return
 		}
-		return
 	}
 
 	if ref.Type == dirType && object != "" && object[len(object)-1] != '/' {
@@ -357,7 +500,7 @@ func (zob *zcnObjects) GetObjectInfo(ctx context.Context, bucket, object string,
 		_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
 	}
 
-	return minio.ObjectInfo{
+	objInfo = minio.ObjectInfo{
 		Bucket:      bucket,
 		Name:        getRelativePathOfObj(ref.Path, bucket),
 		ModTime:     ref.UpdatedAt.ToTime(),
@@ -367,11 +510,25 @@ func (zob *zcnObjects) GetObjectInfo(ctx context.Context, bucket, object string,
 		ContentType: ref.MimeType,
 		ETag:        ref.ActualFileHash,
 		UserDefined: userDefined,
-	}, nil
+	}
+	setMetaInfo(&objInfo)
+	setEncryptionInfo(&objInfo, ref.EncryptedKey != "")
+	setVersionInfo(&objInfo)
+	if _, err = setDecompressedInfo(ctx, alloc, remotePath, &objInfo, ref.EncryptedKey != "", true); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return objInfo, nil
 }
 
 // GetObjectNInfo Provides reader with read cursor placed at offset upto some length
 func (zob *zcnObjects) GetObjectNInfo(ctx context.Context, bucket, object string, rs *minio.HTTPRangeSpec, h http.Header, lockType minio.LockType, opts minio.ObjectOptions) (gr *minio.GetObjectReader, err error) {
+	if bucket == minioMetaBucket {
+		return zob.getMetaObjectNInfo(ctx, object, opts)
+	}
+	za := allocations.forBucket(bucket)
+	za.incRequests(http.MethodGet)
+	alloc := za.alloc
+
 	var remotePath string
 	if bucket == rootBucketName {
 		remotePath = filepath.Join(rootPath, object)
@@ -379,65 +536,98 @@ func (zob *zcnObjects) GetObjectNInfo(ctx context.Context, bucket, object string
 		remotePath = filepath.Join(rootPath, bucket, object)
 	}
 
-	var rangeStart int64 = 1
-	var rangeEnd int64 = 0
-	if rs != nil {
-		if rs.IsSuffixLength {
-			rangeStart = -rs.Start
-			// take absolute value of difference between start and end
-			rangeEnd = rangeStart
-			if rs.End-rs.Start > 0 {
-				rangeEnd += rs.End - rs.Start
-			} else {
-				rangeEnd += rs.Start - rs.End
-			}
-		} else {
-			rangeStart = rs.Start
-			rangeEnd = rs.End
+	var (
+		version         *objectVersion
+		versionIsLatest bool
+	)
+	if opts.VersionID != "" {
+		v, isLatest, err := zob.getObjectVersion(bucket, object, remotePath, opts.VersionID)
+		if err != nil {
+			return nil, err
+		}
+		if v.deleteMarker {
+			return nil, minio.MethodNotAllowed{Bucket: bucket, Object: object}
+		}
+		if !v.isCurrent() {
+			version, versionIsLatest = &v, isLatest
+			remotePath = v.refPath
 		}
 	}
 
-	f, objectInfo, fCloser, _, err := getFileReader(ctx, zob.alloc, bucket, object, remotePath, rangeStart, rangeEnd)
+	f, objectInfo, fCloser, err := getFileReader(ctx, alloc, bucket, object, remotePath, rs)
 	if err != nil {
 		return nil, err
 	}
+	if version != nil {
+		setEncryptionInfo(objectInfo, version.ref.EncryptedKey != "")
+		objectInfo.VersionID = version.versionID
+		objectInfo.ModTime = version.modTime
+		objectInfo.IsLatest = versionIsLatest
+	}
 
-	gr, err = minio.NewGetObjectReaderFromReader(f, *objectInfo, opts, fCloser)
+	atomic.AddUint64(&counters.downloads, 1)
+	gr, err = minio.NewGetObjectReaderFromReader(&receivedBytesReader{Reader: f, za: za}, *objectInfo, opts, fCloser)
 	return
 }
 
 // ListBuckets Lists directories of root path(/) and root path itself as buckets.
+// Buckets mapped to other allocations are the directories of the same name there.
 func (zob *zcnObjects) ListBuckets(ctx context.Context) (buckets []minio.BucketInfo, err error) {
-	rootRef, err := getSingleRegularRef(zob.alloc, rootPath)
+	alloc := allocations.forBucket(rootBucketName).alloc
+	mapped := allocations.mappedBuckets()
+	rootRef, err := getSingleRegularRef(alloc, rootPath)
 	if err != nil {
-		if isPathNoExistError(err) {
+		if !isPathNoExistError(err) {
+			return nil, err
+		}
+		buckets = append(buckets, minio.BucketInfo{
+			Name:    rootBucketName,
+			Created: time.Now().Add(-time.Hour * 30),
+		})
+	} else {
+		dirRefs, err := listRootDir(alloc, "d")
+		if err != nil {
+			return nil, err
+		}
+
+		// Consider root path as bucket as well.
+		buckets = append(buckets, minio.BucketInfo{
+			Name:    rootBucketName,
+			Created: rootRef.CreatedAt.ToTime(),
+		})
+
+		for _, dirRef := range dirRefs {
+			if isSystemPath(dirRef.Path) {
+				continue
+			}
+			if _, ok := mapped[dirRef.Name]; ok {
+				continue
+			}
 			buckets = append(buckets, minio.BucketInfo{
-				Name:    rootBucketName,
-				Created: time.Now().Add(-time.Hour * 30),
+				Name:    dirRef.Name,
+				Created: dirRef.CreatedAt.ToTime(),
 			})
-			return buckets, nil
 		}
-		return nil, err
 	}
 
-	dirRefs, err := listRootDir(zob.alloc, "d")
-	if err != nil {
-		return nil, err
-	}
-
-	// Consider root path as bucket as well.
-	buckets = append(buckets, minio.BucketInfo{
-		Name:    rootBucketName,
-		Created: rootRef.CreatedAt.ToTime(),
-	})
-
-	for _, dirRef := range dirRefs {
+	for bucket, za := range mapped {
+		ref, err := getSingleRegularRef(za.alloc, filepath.Join(rootPath, bucket))
+		if err != nil {
+			if isPathNoExistError(err) {
+				continue
+			}
+			return nil, err
+		}
+		if ref.Type != dirType {
+			continue
+		}
 		buckets = append(buckets, minio.BucketInfo{
-			Name:    dirRef.Name,
-			Created: dirRef.CreatedAt.ToTime(),
+			Name:    bucket,
+			Created: ref.CreatedAt.ToTime(),
 		})
 	}
-	return
+	sort.Slice(buckets[1:], func(i, j int) bool { return buckets[i+1].Name < buckets[j+1].Name })
+	return buckets, nil
 }
 
 func (zob *zcnObjects) ListObjectsV2(ctx context.Context, bucket, prefix, continuationToken, delimiter string, maxKeys int, fetchOwner bool, startAfter string) (result minio.ListObjectsV2Info, err error) {
@@ -462,6 +652,13 @@ func (zob *zcnObjects) ListObjectsV2(ctx context.Context, bucket, prefix, contin
 
 // ListObjects Lists files of directories as objects
 func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker, delimiter string, maxKeys int) (result minio.ListObjectsInfo, err error) {
+	za := allocations.forBucket(bucket)
+	alloc := za.alloc
+	// The directories below the root path are buckets, the root bucket is
+	// always listed from the allocation.
+	if tree := refIndexes.ready(za); tree != nil && bucket != rootBucketName {
+		return zob.listIndexedObjects(ctx, tree, za, bucket, prefix, marker, delimiter, maxKeys)
+	}
 	// objFileType For root path list objects should only provide file and not dirs.
 	// Dirs under root path are presented as buckets as well
 	var remotePath, objFileType string
@@ -473,7 +670,7 @@ func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker,
 	}
 
 	var ref *sdk.ORef
-	ref, err = getSingleRegularRef(zob.alloc, remotePath)
+	ref, err = getSingleRegularRef(alloc, remotePath)
 	if err != nil {
 		if isPathNoExistError(err) {
 			return result, nil
@@ -490,22 +687,31 @@ func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker,
 				},
 				nil
 		}
+		userDefined := make(map[string]string)
+		if ref.CustomMeta != "" {
+			_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
+		}
+		objInfo := minio.ObjectInfo{
+			Bucket:       bucket,
+			Name:         getRelativePathOfObj(ref.Path, bucket),
+			Size:         ref.ActualFileSize,
+			IsDir:        false,
+			ModTime:      ref.UpdatedAt.ToTime(),
+			ETag:         ref.ActualFileHash,
+			ContentType:  ref.MimeType,
+			AccTime:      time.Now(),
+			StorageClass: "STANDARD",
+			UserDefined:  userDefined,
+		}
+		setMetaInfo(&objInfo)
+		setVersionInfo(&objInfo)
+		if _, err = setDecompressedInfo(ctx, alloc, ref.Path, &objInfo, ref.EncryptedKey != "", false); err != nil {
+			return minio.ListObjectsInfo{}, err
+		}
 		return minio.ListObjectsInfo{
 				IsTruncated: false,
-				Objects: []minio.ObjectInfo{
-					{
-						Bucket:       bucket,
-						Name:         getRelativePathOfObj(ref.Path, bucket),
-						Size:         ref.ActualFileSize,
-						IsDir:        false,
-						ModTime:      ref.UpdatedAt.ToTime(),
-						ETag:         ref.ActualFileHash,
-						ContentType:  ref.MimeType,
-						AccTime:      time.Now(),
-						StorageClass: "STANDARD",
-					},
-				},
-				Prefixes: []string{},
+				Objects:     []minio.ObjectInfo{objInfo},
+				Prefixes:    []string{},
 			},
 			nil
 	}
@@ -543,7 +749,7 @@ func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker,
 	} else {
 		objFileType = fileType
 	}
-	refs, isTruncated, nextMarker, prefixes, err := listRegularRefs(zob.alloc, remotePath, marker, objFileType, maxKeys, isDelimited)
+	refs, isTruncated, nextMarker, prefixes, err := listRegularRefs(alloc, remotePath, marker, objFileType, maxKeys, isDelimited)
 	if err != nil {
 		if remotePath == rootPath && isPathNoExistError(err) {
 			return minio.ListObjectsInfo{}, nil
@@ -559,7 +765,7 @@ func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker,
 		if ref.CustomMeta != "" {
 			_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
 		}
-		objects = append(objects, minio.ObjectInfo{
+		objInfo := minio.ObjectInfo{
 			Bucket:       bucket,
 			Name:         getRelativePathOfObj(ref.Path, bucket),
 			ModTime:      ref.UpdatedAt.ToTime(),
@@ -569,7 +775,13 @@ func (zob *zcnObjects) ListObjects(ctx context.Context, bucket, prefix, marker,
 			ETag:         ref.ActualFileHash,
 			StorageClass: "STANDARD",
 			UserDefined:  userDefined,
-		})
+		}
+		setMetaInfo(&objInfo)
+		setVersionInfo(&objInfo)
+		if _, err = setDecompressedInfo(ctx, alloc, ref.Path, &objInfo, ref.EncryptedKey != "", false); err != nil {
+			return minio.ListObjectsInfo{}, err
+		}
+		objects = append(objects, objInfo)
 	}
 
 	result.IsTruncated = isTruncated
@@ -598,17 +810,33 @@ func (zob *zcnObjects) MakeBucketWithLocation(ctx context.Context, bucket string
 	if bucket == rootBucketName {
 		return nil
 	}
+	if err := zob.health.writable(bucket); err != nil {
+		return err
+	}
+	alloc := allocations.forBucket(bucket).alloc
 	remotePath := filepath.Join(rootPath, bucket)
 	createDirOp := sdk.OperationRequest{
 		OperationType: constants.FileOperationCreateDir,
 		RemotePath:    remotePath,
 	}
-	return zob.alloc.DoMultiOperation([]sdk.OperationRequest{
+	err := alloc.DoMultiOperation([]sdk.OperationRequest{
 		createDirOp,
 	})
+	if err == nil {
+		indexRefresh(allocations.forBucket(bucket), remotePath)
+	}
+	return err
 }
 
 func (zob *zcnObjects) PutObject(ctx context.Context, bucket, object string, r *minio.PutObjReader, opts minio.ObjectOptions) (objInfo minio.ObjectInfo, err error) {
+	if bucket == minioMetaBucket {
+		return zob.putMetaObject(object, r)
+	}
+	if err = zob.health.writable(bucket); err != nil {
+		return
+	}
+	za := allocations.forBucket(bucket)
+
 	var remotePath string
 	if bucket == rootBucketName {
 		remotePath = filepath.Join(rootPath, object)
@@ -618,24 +846,36 @@ func (zob *zcnObjects) PutObject(ctx context.Context, bucket, object string, r *
 
 	var ref *sdk.ORef
 	var isUpdate bool
-	err = lockPath(ctx, remotePath)
+	unlock, err := lockPath(ctx, za, remotePath)
 	if err != nil {
 		return
 	}
-	ref, err = getSingleRegularRef(zob.alloc, remotePath)
+	defer unlock()
+	defer func() {
+		if err == nil {
+			indexRefresh(za, remotePath)
+		}
+	}()
+	ref, err = getSingleRegularRef(za.alloc, remotePath)
 	if err != nil {
 		if !isPathNoExistError(err) {
-			unlockPath(remotePath)
 			return
 		}
 	}
 
+	modTime := time.Now()
+	userDefined := opts.UserDefined
+	var versionID string
+	if (opts.Versioned || opts.VersionSuspended) && object[len(object)-1] != '/' {
+		if err = zob.archiveCurrent(remotePath, ref, opts.Versioned); err != nil {
+			return
+		}
+		userDefined, versionID = versionMeta(userDefined, opts.Versioned, modTime)
+	}
+
 	if ref != nil {
 		logger.Info("updateFile: ", remotePath)
 		isUpdate = true
-		unlockPath(remotePath)
-	} else {
-		defer unlockPath(remotePath)
 	}
 
 	contentType := opts.UserDefined["content-type"]
@@ -650,7 +890,7 @@ func (zob *zcnObjects) PutObject(ctx context.Context, bucket, object string, r *
 		}
 		customMeta, _ := json.Marshal(opts.UserDefined)
 		createDirOp.FileMeta.CustomMeta = string(customMeta)
-		err = zob.alloc.DoMultiOperation([]sdk.OperationRequest{
+		err = za.alloc.DoMultiOperation([]sdk.OperationRequest{
 			createDirOp,
 		})
 		if err != nil {
@@ -669,37 +909,59 @@ func (zob *zcnObjects) PutObject(ctx context.Context, bucket, object string, r *
 		}
 	}
 
-	err = putFile(ctx, zob.alloc, remotePath, contentType, r, r.Size(), isUpdate, opts.UserDefined)
+	userDefined = encryptionMeta(userDefined, encryptUpload(za, opts))
+	err = putFile(ctx, za, remotePath, contentType, r, r.Size(), isUpdate, userDefined)
 	if err != nil {
 		return
 	}
+	if isUpdate {
+		sidecars.remove(remotePath)
+	}
 
 	objInfo = minio.ObjectInfo{
 		Bucket:      bucket,
 		Name:        object,
 		Size:        r.Size(),
-		ModTime:     time.Now(),
+		ModTime:     modTime,
+		ETag:        r.MD5CurrentHexString(),
+		VersionID:   versionID,
 		UserDefined: opts.UserDefined,
 	}
 	return
 }
 
+// PutMultipleObjects uploads the objects in one batch. An object which cannot
+// be prepared fails alone, the others are committed together and fail
+// together when the commit does.
 func (zob *zcnObjects) PutMultipleObjects(
 	ctx context.Context,
 	bucket string,
 	objects []string,
 	r []*minio.PutObjReader,
 	opts []minio.ObjectOptions,
-) ([]minio.ObjectInfo, error) {
+) ([]minio.ObjectInfo, []error) {
 	total := len(objects)
-	if total <= 0 {
-		return nil, fmt.Errorf("no files to upload")
+	objectInfo := make([]minio.ObjectInfo, total)
+	errs := make([]error, total)
+	failAll := func(err error) ([]minio.ObjectInfo, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return objectInfo, errs
 	}
 
 	if total != len(r) || total != len(opts) {
-		return nil, fmt.Errorf("length mismatch of objects with file readers or with options")
+		return failAll(fmt.Errorf("length mismatch of objects with file readers or with options"))
+	}
+	if total == 0 {
+		return objectInfo, errs
 	}
 
+	if err := zob.health.writable(bucket); err != nil {
+		return failAll(err)
+	}
+	za := allocations.forBucket(bucket)
+	za.incRequests(http.MethodPost)
 	remotePaths := make([]string, total)
 	for i, object := range objects {
 		if bucket == rootBucketName {
@@ -708,19 +970,31 @@ func (zob *zcnObjects) PutMultipleObjects(
 			remotePaths[i] = filepath.Join(rootPath, bucket, object)
 		}
 	}
+	unlock, err := lockPath(ctx, za, remotePaths...)
+	if err != nil {
+		return failAll(err)
+	}
+	defer unlock()
 	operationRequests := make([]sdk.OperationRequest, total)
-	objectInfo := make([]minio.ObjectInfo, total)
+	updated := make([]bool, total)
+	compressed := make([]*compressedUpload, total)
+	defer func() {
+		for _, cu := range compressed {
+			if cu != nil {
+				cu.cleanup()
+			}
+		}
+	}()
 	var wg sync.WaitGroup
-	errCh := make(chan error)
 	for i := 0; i < total; i++ {
 		wg.Add(1)
 		go func(idx int) {
 			defer wg.Done()
 			var ref *sdk.ORef
-			ref, err := getSingleRegularRef(zob.alloc, remotePaths[idx])
+			ref, err := getSingleRegularRef(za.alloc, remotePaths[idx])
 			if err != nil {
 				if !isPathNoExistError(err) {
-					errCh <- err
+					errs[idx] = err
 					return
 				}
 			}
@@ -728,14 +1002,53 @@ func (zob *zcnObjects) PutMultipleObjects(
 			var isUpdate bool
 			if ref != nil {
 				isUpdate = true
+				updated[idx] = true
+			}
+
+			modTime := time.Now()
+			userDefined := opts[idx].UserDefined
+			var versionID string
+			if opts[idx].Versioned || opts[idx].VersionSuspended {
+				if err = zob.archiveCurrent(remotePaths[idx], ref, opts[idx].Versioned); err != nil {
+					errs[idx] = err
+					return
+				}
+				userDefined, versionID = versionMeta(userDefined, opts[idx].Versioned, modTime)
 			}
+			encrypt := encryptUpload(za, opts[idx])
+			userDefined = encryptionMeta(userDefined, encrypt)
 
 			_, fileName := filepath.Split(remotePaths[idx])
+			contentType := opts[idx].UserDefined["content-type"]
+			if contentType == "" {
+				contentType = mimedb.TypeByExtension(path.Ext(fileName))
+			}
+			var fileReader io.Reader = r[idx]
+			size := r[idx].Size()
+			var customMeta string
+			if len(userDefined) > 0 {
+				meta, _ := json.Marshal(userDefined)
+				customMeta = string(meta)
+			}
+			if codec := za.compressionCodec(fileName, contentType); codec != "" {
+				cu, err := compressUpload(codec, r[idx], size)
+				if err != nil {
+					errs[idx] = err
+					return
+				}
+				compressed[idx] = cu
+				meta, _ := json.Marshal(compressionMeta(userDefined, codec, contentType, cu.actualSize))
+				customMeta = string(meta)
+				contentType = codecMimeTypes[codec]
+				fileReader, size = cu, cu.size
+			}
 			fileMeta := sdk.FileMeta{
 				Path:       "",
 				RemotePath: remotePaths[idx],
-				ActualSize: r[idx].Size(),
+				ActualSize: size,
+				MimeType:   contentType,
 				RemoteName: fileName,
+				CustomMeta: customMeta,
 			}
 
 			options := []sdk.ChunkedUploadOption{
@@ -744,7 +1057,7 @@ func (zob *zcnObjects) PutMultipleObjects(
 			}
 			operationRequests[idx] = sdk.OperationRequest{
 				FileMeta:      fileMeta,
-				FileReader:    newMinioReader(r[idx]),
+				FileReader:    newMinioReader(fileReader),
 				OperationType: constants.FileOperationInsert,
 				Opts:          options,
 			}
@@ -752,31 +1065,65 @@ func (zob *zcnObjects) PutMultipleObjects(
 				operationRequests[idx].OperationType = constants.FileOperationUpdate
 			}
 			objectInfo[idx] = minio.ObjectInfo{
-				Bucket:  bucket,
-				Name:    objects[idx],
-				Size:    r[idx].Size(),
-				ModTime: time.Now(),
+				Bucket:      bucket,
+				Name:        objects[idx],
+				Size:        r[idx].Size(),
+				ModTime:     modTime,
+				VersionID:   versionID,
+				UserDefined: opts[idx].UserDefined,
 			}
 		}(i)
+	}
+	wg.Wait()
 
-		select {
-		case err := <-errCh:
-			logger.Error("error while getting file ref and creating operationRequests.")
-			return nil, err
-		default:
+	var ops []sdk.OperationRequest
+	var committed []int
+	var updatedPaths []string
+	for i, err := range errs {
+		if err != nil {
+			logger.Error("error while getting file ref and creating operationRequests: ", err)
+			objectInfo[i] = minio.ObjectInfo{}
+			continue
+		}
+		ops = append(ops, operationRequests[i])
+		committed = append(committed, i)
+		if updated[i] {
+			updatedPaths = append(updatedPaths, remotePaths[i])
 		}
 	}
-	wg.Wait()
+	if len(ops) == 0 {
+		return objectInfo, errs
+	}
 
-	errn := zob.alloc.DoMultiOperation(operationRequests)
-	if errn != nil {
-		logger.Error("error in sending multioperation to gosdk: %v", errn)
-		return nil, errn
+	countBatch(len(ops))
+	if err := za.alloc.DoMultiOperation(ops); err != nil && !isSameRootError(err) {
+		logger.Error("error in sending multioperation to gosdk: ", err)
+		for _, i := range committed {
+			objectInfo[i] = minio.ObjectInfo{}
+			errs[i] = err
+		}
+		return objectInfo, errs
+	}
+	sidecars.remove(updatedPaths...)
+	atomic.AddUint64(&counters.uploads, uint64(len(ops)))
+	for _, op := range ops {
+		za.incBytesSent(op.FileMeta.ActualSize)
 	}
+	committedPaths := make([]string, len(committed))
+	for i, idx := range committed {
+		committedPaths[i] = remotePaths[idx]
+		// The readers were consumed by the commit, their MD5 is now known.
+		objectInfo[idx].ETag = r[idx].MD5CurrentHexString()
+	}
+	indexRefresh(za, committedPaths...)
 
-	return objectInfo, nil
+	return objectInfo, errs
 }
+
 func (zob *zcnObjects) CopyObject(ctx context.Context, srcBucket, srcObject, destBucket, destObject string, srcInfo minio.ObjectInfo, srcOpts, dstOpts minio.ObjectOptions) (objInfo minio.ObjectInfo, err error) {
+	if err = zob.health.writable(destBucket); err != nil {
+		return
+	}
 	var srcRemotePath, dstRemotePath string
 	if srcBucket == rootBucketName {
 		srcRemotePath = filepath.Join(rootPath, srcObject)
@@ -790,12 +1137,49 @@ func (zob *zcnObjects) CopyObject(ctx context.Context, srcBucket, srcObject, des
 		dstRemotePath = filepath.Join(rootPath, destBucket, destObject)
 	}
 
+	za := allocations.forBucket(destBucket)
+	alloc := za.alloc
+	reupload := allocations.forBucket(srcBucket).alloc != alloc
+	srcPath := srcRemotePath
+	if !reupload && srcOpts.VersionID != "" {
+		var v objectVersion
+		if v, _, err = zob.getObjectVersion(srcBucket, srcObject, srcRemotePath, srcOpts.VersionID); err != nil {
+			return
+		}
+		if v.deleteMarker {
+			return objInfo, minio.MethodNotAllowed{Bucket: srcBucket, Object: srcObject}
+		}
+		srcPath = v.refPath
+	}
+	if !reupload && srcPath != dstRemotePath {
+		// Copies within an allocation keep the encryption of their source.
+		var srcRef *sdk.ORef
+		if srcRef, err = getSingleRegularRef(alloc, srcPath); err != nil {
+			return
+		}
+		reupload = srcRef.Type == fileType && (srcRef.EncryptedKey != "") != encryptUpload(za, dstOpts)
+	}
+	if reupload {
+		// Files are only copied within an allocation, the object is uploaded
+		// again to another one or when the copy is encrypted differently.
+		dstOpts.UserDefined = srcInfo.UserDefined
+		return zob.PutObject(ctx, destBucket, destObject, srcInfo.PutObjReader, dstOpts)
+	}
+
+	versioned := dstOpts.Versioned || dstOpts.VersionSuspended
 	var ref *sdk.ORef
-	if srcRemotePath == dstRemotePath {
-		ref, err = getSingleRegularRef(zob.alloc, dstRemotePath)
+	if srcPath == dstRemotePath {
+		ref, err = getSingleRegularRef(alloc, dstRemotePath)
 		if err != nil {
 			return
 		}
+		if ref.Type == fileType {
+			// Copying an object onto itself is how clients replace its
+			// metadata, the data is left as is.
+			opts := dstOpts
+			opts.VersionID = srcOpts.VersionID
+			return zob.replaceMetadata(ctx, destBucket, destObject, srcInfo.UserDefined, opts, versioned)
+		}
 		if ref.Type == dirType {
 			ref.MimeType = s3DirectoryContentType
 			ref.ActualFileSize = 0
@@ -811,112 +1195,93 @@ func (zob *zcnObjects) CopyObject(ctx context.Context, srcBucket, srcObject, des
 			ETag:        ref.ActualFileHash,
 		}, nil
 	}
+	unlock, err := lockPath(ctx, za, dstRemotePath)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if versioned && destObject[len(destObject)-1] != '/' {
+		if ref, err = zob.getCurrentRef(dstRemotePath); err != nil {
+			return
+		}
+		if err = zob.archiveCurrent(dstRemotePath, ref, dstOpts.Versioned); err != nil {
+			return
+		}
+	}
 	copyOp := sdk.OperationRequest{
 		OperationType: constants.FileOperationCopy,
-		RemotePath:    srcRemotePath,
+		RemotePath:    srcPath,
 		DestPath:      dstRemotePath,
 	}
-	err = zob.alloc.DoMultiOperation([]sdk.OperationRequest{
+	err = alloc.DoMultiOperation([]sdk.OperationRequest{
 		copyOp,
 	})
 	if err != nil {
 		return
 	}
-
-	ref, err = getSingleRegularRef(zob.alloc, dstRemotePath)
-	if err != nil {
-		return
+	err = sidecars.copy(srcPath, dstRemotePath)
+	var stored *sdk.ORef
+	if err == nil {
+		stored, err = getStoredRef(alloc, dstRemotePath)
 	}
-	if ref.Type == dirType {
-		ref.MimeType = s3DirectoryContentType
-		ref.ActualFileSize = 0
-		ref.ActualFileHash = s3ContentHash
+	if err == nil && stored.Type == fileType {
+		err = zob.setCopyVersion(stored, dstOpts)
 	}
-
-	return minio.ObjectInfo{
-		Bucket:      destBucket,
-		Name:        destObject,
-		ModTime:     ref.UpdatedAt.ToTime(),
-		Size:        ref.ActualFileSize,
-		IsDir:       ref.Type == dirType,
-		ContentType: ref.MimeType,
-		ETag:        ref.ActualFileHash,
-	}, nil
-}
-
-func (zob *zcnObjects) StorageInfo(ctx context.Context) (si minio.StorageInfo, _ []error) {
-	si.Backend.Type = madmin.Gateway
-	si.Backend.GatewayOnline = true
-	return
-}
-
-func lockPath(ctx context.Context, path string) error {
-	contentLock.Lock()
-	defer contentLock.Unlock()
-	if _, ok := contentMap[path]; !ok {
-		contentMap[path] = semaphore.NewWeighted(1)
+	indexRefresh(za, dstRemotePath)
+	if err != nil {
+		return
 	}
-	return contentMap[path].Acquire(ctx, 1)
-}
-
-func unlockPath(path string) {
-	contentLock.Lock()
-	defer contentLock.Unlock()
-	if sem, ok := contentMap[path]; ok {
-		sem.Release(1)
-		delete(contentMap, path)
+	if stored.Type == dirType {
+		return minio.ObjectInfo{
+			Bucket:      destBucket,
+			Name:        destObject,
+			ModTime:     stored.UpdatedAt.ToTime(),
+			IsDir:       true,
+			ContentType: s3DirectoryContentType,
+			ETag:        s3ContentHash,
+		}, nil
 	}
+	return zob.GetObjectInfo(ctx, destBucket, destObject, minio.ObjectOptions{})
 }
 
-/*
-//Unfortunately share file is done by minio client which does't need to communicate with server. It generates share url with access key id and
-//secret key
-func (zob *zcnObjects) ShareFile(ctx context.Context, bucket, object, clientID, pubEncryp string, expires, availableAfter time.Duration) (string, error) {
-	var remotePath string
-	if bucket == "" || (bucket == rootBucketName && object == "") {
-		//share entire allocation i.e. rootpath
-	} else if bucket == rootBucketName {
-		remotePath = filepath.Join(rootPath, object)
-	} else {
-		remotePath = filepath.Join(rootPath, bucket, object)
-	}
-
-	var ref *sdk.ORef
-	ref, err := getSingleRegularRef(zob.alloc, remotePath)
-	if err != nil {
-		return "", err
+// setCopyVersion gives the object just copied into stored, as read from the
+// allocation, a version of its own. The copy carries the version of its source,
+// which is replaced by a new one in the sidecar of the copy. Copies of objects
+// without a version that are not made into a versioned bucket are left as is.
+func (zob *zcnObjects) setCopyVersion(stored *sdk.ORef, opts minio.ObjectOptions) error {
+	ref := *stored
+	sidecars.apply(&ref)
+	userDefined := make(map[string]string)
+	if ref.CustomMeta != "" {
+		if err := json.Unmarshal([]byte(ref.CustomMeta), &userDefined); err != nil {
+			return err
+		}
 	}
-
-	_, fileName := filepath.Split(remotePath)
-
-	authTicket, err := zob.alloc.GetAuthTicket(remotePath, fileName, ref.Type, clientID, pubEncryp, int64(expires.Seconds()), int64(availableAfter.Seconds()))
-	if err != nil {
-		return "", err
+	_, hasVersion := userDefined[zcnVersionIDKey]
+	_, hasModTime := userDefined[zcnModTimeKey]
+	if !opts.Versioned && !opts.VersionSuspended && !hasVersion && !hasModTime {
+		return nil
 	}
-
-	_ = authTicket
-	//get public url from 0NFT
-	return "", nil
+	delete(userDefined, zcnVersionIDKey)
+	userDefined, _ = versionMeta(userDefined, opts.Versioned, time.Now())
+	return sidecars.put(stored, ref.MimeType, userDefined)
 }
 
-func (zob *zcnObjects) RevokeShareCredential(ctx context.Context, bucket, object, clientID string) (err error) {
-	var remotePath string
-	if bucket == "" || (bucket == rootBucketName && object == "") {
-		//share entire allocation i.e. rootpath
-	} else if bucket == rootBucketName {
-		remotePath = filepath.Join(rootPath, object)
-	} else {
-		remotePath = filepath.Join(rootPath, bucket, object)
-	}
-
-	_, err = getSingleRegularRef(zob.alloc, remotePath)
-	if err != nil {
-		return
+// lockPath locks remotePaths of the allocation for a write, on all gateways
+// sharing the allocation when the gateway is distributed. Writes hold the lock
+// until they are committed. The returned func unlocks the paths.
+func lockPath(ctx context.Context, za *zcnAllocation, remotePaths ...string) (func(), error) {
+	paths := make([]string, 0, len(remotePaths))
+	seen := make(map[string]bool, len(remotePaths))
+	for _, remotePath := range remotePaths {
+		if !seen[remotePath] {
+			seen[remotePath] = true
+			paths = append(paths, remotePath)
+		}
 	}
-
-	return zob.alloc.RevokeShare(remotePath, clientID)
+	_, unlock, err := minio.GatewayLock(ctx, za.id, paths...)
+	return unlock, err
 }
-*/
 
 // ListMultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker, delimiter string, maxUploads int) (result ListMultipartsInfo, err error)
 // CopyObjectPart(ctx context.Context, srcBucket, srcObject, destBucket, destObject string, uploadID string, partID int,
@@ -0,0 +1,555 @@
+package zcn
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/google/uuid"
+	"github.com/minio/madmin-go"
+	minio "github.com/minio/minio/cmd"
+)
+
+const (
+	defaultHealthCheckInterval = 30 // seconds
+
+	// repairTaskRetention is how long the progress of a finished repair is
+	// kept for the heal admin API.
+	repairTaskRetention = 10 * time.Minute
+
+	// repairTimeout is how long the repair of one allocation may take before
+	// it is cancelled, the sdk may never report the end of a repair.
+	repairTimeout = 12 * time.Hour
+)
+
+// Health states of an allocation.
+const (
+	healthOK     = "ok"
+	healthRepair = "repair" // blobbers out of sync, writes still reach consensus
+	healthBroken = "broken" // writes cannot reach consensus, served read-only
+)
+
+// allocationHealth is the state of an allocation at its last check.
+type allocationHealth struct {
+	ID      string    `json:"id"`
+	Status  string    `json:"status"`
+	Checked time.Time `json:"checked"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// healthStatus is reported by the health admin API.
+type healthStatus struct {
+	Interval    string             `json:"interval"`
+	AutoRepair  bool               `json:"autoRepair"`
+	Allocations []allocationHealth `json:"allocations"`
+	Repairs     []repairStatus     `json:"repairs,omitempty"`
+}
+
+// healthMonitor checks the allocations every interval. Broken allocations
+// are served read-only until a check finds them writable again, those out of
+// sync are repaired when autoRepair is set. Repairs are run as heal tasks
+// which the heal admin API starts, stops and reports.
+type healthMonitor struct {
+	interval   time.Duration
+	autoRepair bool
+
+	mu      sync.Mutex
+	ctx     context.Context
+	health  map[string]allocationHealth // keyed by allocation id
+	tasks   map[string]*repairTask      // keyed by client token
+	running map[string]*repairTask      // keyed by allocation id
+}
+
+func newHealthMonitor(interval time.Duration, autoRepair bool) *healthMonitor {
+	return &healthMonitor{
+		interval:   interval,
+		autoRepair: autoRepair,
+		health:     make(map[string]allocationHealth),
+		tasks:      make(map[string]*repairTask),
+		running:    make(map[string]*repairTask),
+	}
+}
+
+// run checks the allocations until ctx is canceled.
+func (hm *healthMonitor) run(ctx context.Context) {
+	hm.mu.Lock()
+	hm.ctx = ctx
+	hm.mu.Unlock()
+
+	hm.check(ctx)
+	ticker := time.NewTicker(hm.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hm.check(ctx)
+		}
+	}
+}
+
+func (hm *healthMonitor) check(ctx context.Context) {
+	for _, za := range allocations.list() {
+		h := allocationHealth{ID: za.id, Status: healthOK, Checked: time.Now().UTC()}
+		status, _, err := za.alloc.CheckAllocStatus()
+		if err != nil {
+			h.Error = err.Error()
+		}
+		switch status {
+		case sdk.Broken:
+			h.Status = healthBroken
+		case sdk.Repair:
+			h.Status = healthRepair
+		}
+		if _, err := allocStats.refresh(ctx, za); err != nil {
+			log.Println("allocation", za.id, "stats:", err)
+		}
+
+		hm.mu.Lock()
+		if prev, ok := hm.health[za.id]; !ok || prev.Status != h.Status {
+			log.Println("allocation", za.id, "health:", h.Status, h.Error)
+		}
+		hm.health[za.id] = h
+		_, repairing := hm.running[za.id]
+		hm.mu.Unlock()
+
+		if h.Status == healthRepair && hm.autoRepair && !repairing {
+			if _, err := hm.startRepair([]repairTarget{{za: za, remotePath: rootPath}}, "", "", madmin.HealOpts{}, false, "health-monitor"); err != nil {
+				log.Println("allocation", za.id, "repair:", err)
+			}
+		}
+	}
+}
+
+func (hm *healthMonitor) allocationHealth(id string) (allocationHealth, bool) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	h, ok := hm.health[id]
+	return h, ok
+}
+
+// writable fails when the allocation of bucket cannot reach write consensus.
+func (hm *healthMonitor) writable(bucket string) error {
+	za := allocations.forBucket(bucket)
+	if h, ok := hm.allocationHealth(za.id); ok && h.Status == healthBroken {
+		return minio.BackendDown{Err: fmt.Sprintf("allocation %s cannot reach write consensus and is read-only", za.id)}
+	}
+	return nil
+}
+
+func (hm *healthMonitor) status() healthStatus {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	st := healthStatus{
+		Interval:    hm.interval.String(),
+		AutoRepair:  hm.autoRepair,
+		Allocations: []allocationHealth{},
+	}
+	for _, za := range allocations.list() {
+		if h, ok := hm.health[za.id]; ok {
+			st.Allocations = append(st.Allocations, h)
+		}
+	}
+	for _, task := range hm.tasks {
+		st.Repairs = append(st.Repairs, task.status())
+	}
+	sort.Slice(st.Repairs, func(i, j int) bool { return st.Repairs[i].Started.Before(st.Repairs[j].Started) })
+	return st
+}
+
+// repairTarget is a directory of an allocation repaired by a repair task.
+type repairTarget struct {
+	za         *zcnAllocation
+	remotePath string
+}
+
+// repairTask repairs its targets one after the other. It receives the sdk
+// callbacks of the repair in progress, the files repaired are reported as heal
+// result items.
+type repairTask struct {
+	token, bucket, prefix, clientAddr string
+	opts                              madmin.HealOpts
+	targets                           []repairTarget
+	doneC                             chan int
+	stopC                             chan struct{}
+	stopOnce                          sync.Once
+
+	mu            sync.Mutex
+	current       *zcnAllocation // being repaired
+	started       time.Time
+	ended         time.Time
+	stopped       bool
+	filesRepaired int
+	failures      int
+	failure       string
+	nextIndex     int64
+	items         []madmin.HealResultItem // not yet reported
+}
+
+// repairStatus is a repair task as reported by the health admin API.
+type repairStatus struct {
+	Token         string    `json:"clientToken"`
+	Bucket        string    `json:"bucket,omitempty"`
+	Prefix        string    `json:"prefix,omitempty"`
+	Allocations   []string  `json:"allocations"`
+	Started       time.Time `json:"started"`
+	Ended         time.Time `json:"ended,omitempty"`
+	Stopped       bool      `json:"stopped,omitempty"`
+	FilesRepaired int       `json:"filesRepaired"`
+	Failures      int       `json:"failures"`
+}
+
+func (task *repairTask) status() repairStatus {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	st := repairStatus{
+		Token:         task.token,
+		Bucket:        task.bucket,
+		Prefix:        task.prefix,
+		Started:       task.started,
+		Ended:         task.ended,
+		Stopped:       task.stopped,
+		FilesRepaired: task.filesRepaired,
+		Failures:      task.failures,
+	}
+	for _, t := range task.targets {
+		st.Allocations = append(st.Allocations, t.za.id)
+	}
+	return st
+}
+
+func (task *repairTask) addItem(item madmin.HealResultItem) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	task.nextIndex++
+	item.ResultIndex = task.nextIndex
+	task.items = append(task.items, item)
+}
+
+// objectItem is the heal result item of a file of the allocation.
+func objectItem(remotePath, detail string) madmin.HealResultItem {
+	bucket, object := rootBucketName, strings.TrimPrefix(remotePath, rootPath)
+	if i := strings.Index(object, "/"); i > 0 {
+		bucket, object = object[:i], object[i+1:]
+	}
+	return madmin.HealResultItem{
+		Type:   madmin.HealItemObject,
+		Bucket: bucket,
+		Object: object,
+		Detail: detail,
+	}
+}
+
+func (task *repairTask) Started(allocationID, remotePath string, op int, totalBytes int) {}
+
+func (task *repairTask) InProgress(allocationID, remotePath string, op int, completedBytes int, data []byte) {
+}
+
+func (task *repairTask) Error(allocationID string, filePath string, op int, err error) {
+	task.mu.Lock()
+	task.failures++
+	task.failure = err.Error()
+	task.mu.Unlock()
+	task.addItem(objectItem(filePath, "repair failed: "+err.Error()))
+}
+
+func (task *repairTask) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	item := objectItem(filePath, "repaired")
+	item.ObjectSize = int64(size)
+	task.addItem(item)
+}
+
+func (task *repairTask) RepairCompleted(filesRepaired int) {
+	select {
+	case task.doneC <- filesRepaired:
+	default:
+	}
+}
+
+// stop cancels the repair in progress, a repair of its allocation may be
+// started as soon as stop returns.
+func (task *repairTask) stop() {
+	task.stopOnce.Do(func() {
+		close(task.stopC)
+		task.mu.Lock()
+		defer task.mu.Unlock()
+		task.stopped = true
+		if task.current != nil {
+			if err := task.current.alloc.CancelRepair(); err != nil {
+				log.Println("allocation", task.current.id, "cancel repair:", err)
+			}
+			task.current = nil
+		}
+	})
+}
+
+// run repairs the targets of the task, a dry run only reports the targets
+// which need a repair.
+func (task *repairTask) run(ctx context.Context, hm *healthMonitor) {
+	defer func() {
+		task.mu.Lock()
+		task.ended = time.Now().UTC()
+		task.mu.Unlock()
+		hm.mu.Lock()
+		for _, t := range task.targets {
+			if hm.running[t.za.id] == task {
+				delete(hm.running, t.za.id)
+			}
+		}
+		hm.mu.Unlock()
+		// the repair changes the state of the allocations
+		go hm.check(ctx)
+	}()
+
+	for _, t := range task.targets {
+		if task.opts.DryRun {
+			status, _, err := t.za.alloc.CheckAllocStatus()
+			detail := "allocation " + t.za.id + " is in sync"
+			switch {
+			case err != nil:
+				detail = "allocation " + t.za.id + ": " + err.Error()
+			case status == sdk.Repair:
+				detail = "allocation " + t.za.id + " needs a repair"
+			case status == sdk.Broken:
+				detail = "allocation " + t.za.id + " is broken"
+			}
+			task.addItem(madmin.HealResultItem{Type: madmin.HealItemMetadata, Bucket: task.bucket, Object: task.prefix, Detail: detail})
+			continue
+		}
+
+		task.mu.Lock()
+		if task.stopped {
+			task.mu.Unlock()
+			return
+		}
+		task.current = t.za
+		task.mu.Unlock()
+		if err := t.za.alloc.StartRepair(tempdir, t.remotePath, task); err != nil {
+			task.mu.Lock()
+			task.current = nil
+			task.failures++
+			task.failure = err.Error()
+			task.mu.Unlock()
+			continue
+		}
+
+		timer := time.NewTimer(repairTimeout)
+		select {
+		case n := <-task.doneC:
+			timer.Stop()
+			task.mu.Lock()
+			task.current = nil
+			task.filesRepaired += n
+			task.mu.Unlock()
+		case <-timer.C:
+			task.timeout(t.za)
+		case <-task.stopC:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			t.za.alloc.CancelRepair() //nolint:errcheck
+			return
+		}
+	}
+}
+
+// timeout cancels the repair of za which did not end within repairTimeout
+// and records it as failed.
+func (task *repairTask) timeout(za *zcnAllocation) {
+	failure := fmt.Sprintf("repair of allocation %s did not end within %s", za.id, repairTimeout)
+	task.mu.Lock()
+	task.current = nil
+	task.failures++
+	task.failure = failure
+	task.mu.Unlock()
+
+	if err := za.alloc.CancelRepair(); err != nil {
+		log.Println("allocation", za.id, "cancel repair:", err)
+	}
+	// drop a completion reported while cancelling
+	select {
+	case <-task.doneC:
+	default:
+	}
+	task.addItem(madmin.HealResultItem{Type: madmin.HealItemMetadata, Bucket: task.bucket, Object: task.prefix, Detail: failure})
+}
+
+// startRepair starts a repair task of targets, which fails when one of them
+// is being repaired unless forceStart stops those repairs first.
+func (hm *healthMonitor) startRepair(targets []repairTarget, bucket, prefix string, opts madmin.HealOpts, forceStart bool, clientAddr string) (*repairTask, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if hm.ctx == nil {
+		return nil, minio.BackendDown{Err: "allocation health monitor is not running"}
+	}
+	for _, t := range targets {
+		if running, ok := hm.running[t.za.id]; ok {
+			if !forceStart {
+				return nil, minio.AdminError{
+					Code:       "XMinioHealAlreadyRunning",
+					Message:    fmt.Sprintf("allocation %s is being repaired by %s (use force-start option to stop and start afresh)", t.za.id, running.token),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			running.stop()
+			delete(hm.running, t.za.id)
+		}
+	}
+	for token, task := range hm.tasks {
+		if ended := task.status().Ended; !ended.IsZero() && time.Since(ended) > repairTaskRetention {
+			delete(hm.tasks, token)
+		}
+	}
+
+	task := &repairTask{
+		token:      uuid.New().String(),
+		bucket:     bucket,
+		prefix:     prefix,
+		clientAddr: clientAddr,
+		opts:       opts,
+		targets:    targets,
+		doneC:      make(chan int, 1),
+		stopC:      make(chan struct{}),
+		started:    time.Now().UTC(),
+	}
+	hm.tasks[task.token] = task
+	if !opts.DryRun {
+		for _, t := range targets {
+			hm.running[t.za.id] = task
+		}
+	}
+	go task.run(hm.ctx, hm)
+	return task, nil
+}
+
+// repairTargets returns the directories repaired for bucket and prefix, all
+// allocations when bucket is empty.
+func repairTargets(bucket, prefix string) []repairTarget {
+	if bucket == "" {
+		var targets []repairTarget
+		for _, za := range allocations.list() {
+			targets = append(targets, repairTarget{za: za, remotePath: rootPath})
+		}
+		return targets
+	}
+	return []repairTarget{{za: allocations.forBucket(bucket), remotePath: shareRemotePath(bucket, prefix)}}
+}
+
+// StartHeal repairs the allocations of bucket below prefix.
+func (zob *zcnObjects) StartHeal(ctx context.Context, bucket, prefix string, opts madmin.HealOpts, forceStart bool, clientAddr string) (madmin.HealStartSuccess, error) {
+	task, err := zob.health.startRepair(repairTargets(bucket, prefix), bucket, prefix, opts, forceStart, clientAddr)
+	if err != nil {
+		return madmin.HealStartSuccess{}, err
+	}
+	return madmin.HealStartSuccess{
+		ClientToken:   task.token,
+		ClientAddress: task.clientAddr,
+		StartTime:     task.started,
+	}, nil
+}
+
+// StopHeal stops the repairs of the allocations of bucket.
+func (zob *zcnObjects) StopHeal(ctx context.Context, bucket, prefix string) (madmin.HealStopSuccess, error) {
+	hm := zob.health
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for _, t := range repairTargets(bucket, prefix) {
+		if task, ok := hm.running[t.za.id]; ok {
+			task.stop()
+			return madmin.HealStopSuccess{
+				ClientToken:   task.token,
+				ClientAddress: task.clientAddr,
+				StartTime:     task.started,
+			}, nil
+		}
+	}
+	return madmin.HealStopSuccess{}, noSuchRepair("no repair of " + bucket + "/" + prefix + " is in progress")
+}
+
+// HealStatus returns the progress of a repair with the files repaired since
+// the last call.
+func (zob *zcnObjects) HealStatus(ctx context.Context, clientToken string) (madmin.HealTaskStatus, error) {
+	zob.health.mu.Lock()
+	task, ok := zob.health.tasks[clientToken]
+	zob.health.mu.Unlock()
+	if !ok {
+		return madmin.HealTaskStatus{}, noSuchRepair("no repair with client token " + clientToken)
+	}
+
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	st := madmin.HealTaskStatus{
+		Summary:       "running",
+		FailureDetail: task.failure,
+		StartTime:     task.started,
+		HealSettings:  task.opts,
+		Items:         task.items,
+	}
+	task.items = nil
+	switch {
+	case task.stopped:
+		st.Summary = "stopped"
+	case !task.ended.IsZero():
+		// Summaries are those of the heal sequences of the server, failures
+		// are only reported in the detail.
+		st.Summary = "finished"
+	}
+	if task.failures > 0 {
+		st.FailureDetail = fmt.Sprintf("%d files could not be repaired, last error: %s", task.failures, task.failure)
+	}
+	return st, nil
+}
+
+func noSuchRepair(msg string) error {
+	return minio.AdminError{
+		Code:       "XMinioHealNoSuchProcess",
+		Message:    msg,
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+// Health is unhealthy while an allocation cannot be written or read.
+func (zob *zcnObjects) Health(ctx context.Context, opts minio.HealthOptions) minio.HealthResult {
+	zob.health.mu.Lock()
+	healing := len(zob.health.running)
+	healthy := true
+	for _, h := range zob.health.health {
+		if h.Status == healthBroken {
+			healthy = false
+		}
+	}
+	zob.health.mu.Unlock()
+	return minio.HealthResult{
+		Healthy:       healthy && zob.ReadHealth(ctx),
+		HealingDrives: healing,
+	}
+}
+
+// ReadHealth fails when fewer blobbers than the data shards of an allocation
+// answered its last probe.
+func (zob *zcnObjects) ReadHealth(ctx context.Context) bool {
+	for _, za := range allocations.list() {
+		stats, ok := allocStats.cached(za.id)
+		if !ok {
+			continue
+		}
+		online := 0
+		for _, b := range stats.Blobbers {
+			if b.Online {
+				online++
+			}
+		}
+		if online < stats.DataShards {
+			return false
+		}
+	}
+	return true
+}
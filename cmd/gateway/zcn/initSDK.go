@@ -18,16 +18,27 @@ import (
 )
 
 type serverOptions struct {
-	Encrypt               bool `json:"encrypt"`
-	Compress              bool `json:"compress"`
-	MaxBatchSize          int  `json:"max_batch_size"`
-	BatchWaitTime         int  `json:"batch_wait_time"`
-	BatchWorkers          int  `json:"batch_workers"`
-	UploadWorkers         int  `json:"upload_workers"`
-	DownloadWorkers       int  `json:"download_workers"`
-	MaxConcurrentRequests int  `json:"max_concurrent_requests"`
+	Encrypt               bool   `json:"encrypt"`
+	Compress              bool   `json:"compress"`
+	CompressionCodec      string `json:"compression_codec"`
+	MaxBatchSize          int    `json:"max_batch_size"`
+	BatchWaitTime         int    `json:"batch_wait_time"`
+	BatchWorkers          int    `json:"batch_workers"`
+	UploadWorkers         int    `json:"upload_workers"`
+	DownloadWorkers       int    `json:"download_workers"`
+	MaxConcurrentRequests int    `json:"max_concurrent_requests"`
+	LifecycleInterval     int    `json:"lifecycle_interval"`    // minutes between lifecycle sweeps
+	HealthCheckInterval   int    `json:"health_check_interval"` // seconds between allocation health checks
+	AutoRepair            bool   `json:"auto_repair"`           // repair allocations found out of sync
+	RefIndex              bool   `json:"ref_index"`             // answer listings and HEAD from a local index of the refs
+	RefIndexInterval      int    `json:"ref_index_interval"`    // minutes between rebuilds of the ref index
+	// Allocations serve some buckets from other allocations than the default one.
+	Allocations []allocationOptions `json:"allocations"`
 }
 
+// serverConfigFile is the zs3server.json serverConfig was read from.
+var serverConfigFile string
+
 func initializeSDK(configDir, allocid string, nonce int64, walletDetails string) error {
 	if configDir == "" {
 		var err error
@@ -56,16 +67,23 @@ func initializeSDK(configDir, allocid string, nonce int64, walletDetails string)
 		}
 	}
 
-	optionFile := filepath.Join(configDir, "zs3server.json")
-	optionBytes, err := os.ReadFile(optionFile)
+	serverConfigFile = filepath.Join(configDir, "zs3server.json")
+	optionBytes, err := os.ReadFile(serverConfigFile)
 	if err == nil {
 		err = json.Unmarshal(optionBytes, &serverConfig)
 		if err != nil {
 			return err
 		}
 	}
-	encrypt = serverConfig.Encrypt
-	compress = serverConfig.Compress
+	serverConfig.CompressionCodec, err = validateCompressionCodec(serverConfig.CompressionCodec)
+	if err != nil {
+		return err
+	}
+	for _, opts := range serverConfig.Allocations {
+		if err = validateAllocationOptions(opts); err != nil {
+			return err
+		}
+	}
 	if serverConfig.MaxBatchSize == 0 {
 		serverConfig.MaxBatchSize = 25
 		serverConfig.BatchWorkers = 5
@@ -78,6 +96,15 @@ func initializeSDK(configDir, allocid string, nonce int64, walletDetails string)
 	if serverConfig.MaxConcurrentRequests == 0 {
 		serverConfig.MaxConcurrentRequests = serverConfig.MaxBatchSize
 	}
+	if serverConfig.LifecycleInterval <= 0 {
+		serverConfig.LifecycleInterval = defaultLifecycleInterval
+	}
+	if serverConfig.HealthCheckInterval <= 0 {
+		serverConfig.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	if serverConfig.RefIndexInterval <= 0 {
+		serverConfig.RefIndexInterval = defaultRefIndexInterval
+	}
 
 	cfg, err := conf.LoadConfigFile(filepath.Join(configDir, "config.yaml"))
 	if err != nil {
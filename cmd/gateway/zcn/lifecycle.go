@@ -0,0 +1,268 @@
+package zcn
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	minio "github.com/minio/minio/cmd"
+	"github.com/minio/minio/internal/bucket/lifecycle"
+)
+
+const defaultLifecycleInterval = 60 // minutes
+
+// lifecycleRun is the progress of a lifecycle sweep over all buckets.
+type lifecycleRun struct {
+	Started        time.Time `json:"started"`
+	Finished       time.Time `json:"finished,omitempty"`
+	Bucket         string    `json:"bucket,omitempty"` // being swept
+	Buckets        int       `json:"buckets"`          // with lifecycle rules
+	ObjectsScanned int64     `json:"objectsScanned"`
+	ObjectsExpired int64     `json:"objectsExpired"`
+	UploadsAborted int64     `json:"uploadsAborted"`
+	Errors         int64     `json:"errors"`
+	LastError      string    `json:"lastError,omitempty"`
+}
+
+// lifecycleStatus is reported by the lifecycle admin API.
+type lifecycleStatus struct {
+	Interval string        `json:"interval"`
+	NextRun  time.Time     `json:"nextRun"`
+	Current  *lifecycleRun `json:"current,omitempty"`
+	LastRun  *lifecycleRun `json:"lastRun,omitempty"`
+}
+
+// lifecycleSweeper applies the bucket lifecycle rules, there is no scanner in
+// gateway mode to do so. It walks the buckets with lifecycle rules every
+// interval, expires the objects the rules select and aborts stale uploads.
+type lifecycleSweeper struct {
+	zob      *zcnObjects
+	interval time.Duration
+	triggerC chan struct{}
+
+	mu      sync.Mutex
+	nextRun time.Time
+	current *lifecycleRun
+	last    *lifecycleRun
+}
+
+// AbortsIncompleteUploads implements minio.GatewayLifecycle, stale uploads are
+// aborted by the lifecycle sweeper.
+func (zob *zcnObjects) AbortsIncompleteUploads() bool {
+	return true
+}
+
+func newLifecycleSweeper(zob *zcnObjects, interval time.Duration) *lifecycleSweeper {
+	return &lifecycleSweeper{
+		zob:      zob,
+		interval: interval,
+		triggerC: make(chan struct{}, 1),
+	}
+}
+
+func (ls *lifecycleSweeper) run(ctx context.Context) {
+	timer := time.NewTimer(ls.interval)
+	defer timer.Stop()
+	for {
+		ls.mu.Lock()
+		ls.nextRun = time.Now().Add(ls.interval).UTC()
+		ls.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-ls.triggerC:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		ls.sweep(ctx)
+		timer.Reset(ls.interval)
+	}
+}
+
+// trigger starts a sweep now unless one is already due.
+func (ls *lifecycleSweeper) trigger() {
+	select {
+	case ls.triggerC <- struct{}{}:
+	default:
+	}
+}
+
+func (ls *lifecycleSweeper) status() lifecycleStatus {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	st := lifecycleStatus{
+		Interval: ls.interval.String(),
+		NextRun:  ls.nextRun,
+	}
+	if ls.current != nil {
+		current := *ls.current
+		st.Current = &current
+		st.NextRun = time.Time{}
+	}
+	if ls.last != nil {
+		last := *ls.last
+		st.LastRun = &last
+	}
+	return st
+}
+
+// record updates the running sweep, it is read concurrently by status.
+func (ls *lifecycleSweeper) record(fn func(run *lifecycleRun)) {
+	ls.mu.Lock()
+	fn(ls.current)
+	ls.mu.Unlock()
+}
+
+func (ls *lifecycleSweeper) recordError(err error) {
+	ls.record(func(run *lifecycleRun) {
+		run.Errors++
+		run.LastError = err.Error()
+	})
+}
+
+func (ls *lifecycleSweeper) sweep(ctx context.Context) {
+	ls.mu.Lock()
+	ls.current = &lifecycleRun{Started: time.Now().UTC()}
+	ls.mu.Unlock()
+
+	buckets, err := ls.zob.ListBuckets(ctx)
+	if err != nil {
+		ls.recordError(err)
+	}
+	for _, bucket := range buckets {
+		if ctx.Err() != nil {
+			break
+		}
+		lc, err := bucketLifecycle(bucket.Name)
+		if err != nil {
+			ls.recordError(err)
+			continue
+		}
+		if lc == nil {
+			continue
+		}
+		ls.record(func(run *lifecycleRun) {
+			run.Bucket = bucket.Name
+			run.Buckets++
+		})
+		ls.abortUploads(ctx, bucket.Name, lc)
+		ls.expireObjects(ctx, bucket.Name, lc)
+	}
+
+	ls.mu.Lock()
+	run := ls.current
+	run.Bucket = ""
+	run.Finished = time.Now().UTC()
+	ls.last, ls.current = run, nil
+	ls.mu.Unlock()
+	log.Printf("lifecycle sweep done: %d objects expired, %d uploads aborted, %d errors\n",
+		run.ObjectsExpired, run.UploadsAborted, run.Errors)
+}
+
+func (ls *lifecycleSweeper) abortUploads(ctx context.Context, bucket string, lc *lifecycle.Lifecycle) {
+	result, err := ls.zob.ListMultipartUploads(ctx, bucket, "", "", "", "", math.MaxInt32)
+	if err != nil {
+		ls.recordError(err)
+		return
+	}
+	for _, upload := range result.Uploads {
+		if !lc.AbortIncompleteUpload(lifecycle.ObjectOpts{Name: upload.Object, ModTime: upload.Initiated}) {
+			continue
+		}
+		err := ls.zob.AbortMultipartUpload(ctx, bucket, upload.Object, upload.UploadID, minio.ObjectOptions{})
+		if err != nil {
+			ls.recordError(err)
+			continue
+		}
+		ls.record(func(run *lifecycleRun) { run.UploadsAborted++ })
+	}
+}
+
+// expireObjects removes the objects of bucket that are expired by lc, in
+// batches of up to max_batch_size. In a versioned bucket the objects get a
+// delete marker instead.
+func (ls *lifecycleSweeper) expireObjects(ctx context.Context, bucket string, lc *lifecycle.Lifecycle) {
+	var bucketPath string
+	if bucket == rootBucketName {
+		bucketPath = rootPath
+	} else {
+		bucketPath = filepath.Join(rootPath, bucket)
+	}
+
+	var opts minio.ObjectOptions
+	if v, err := ls.zob.GetBucketVersioning(ctx, bucket); err == nil {
+		opts.Versioned = v.Enabled()
+		opts.VersionSuspended = v.Suspended()
+	}
+
+	var expired []minio.ObjectToDelete
+	flush := func() {
+		if len(expired) == 0 {
+			return
+		}
+		_, errs := ls.zob.DeleteObjects(ctx, bucket, expired, opts)
+		for _, err := range errs {
+			if err != nil {
+				ls.recordError(err)
+				continue
+			}
+			ls.record(func(run *lifecycleRun) { run.ObjectsExpired++ })
+		}
+		expired = expired[:0]
+	}
+
+	marker := ""
+	for ctx.Err() == nil {
+		refs, isTruncated, nextMarker, _, err := listRegularRefs(allocations.forBucket(bucket).alloc, bucketPath, marker, fileType, pageLimit, false)
+		if err != nil {
+			if !isPathNoExistError(err) {
+				ls.recordError(err)
+			}
+			break
+		}
+		for i := range refs {
+			ref := &refs[i]
+			if ref.Type != fileType {
+				continue
+			}
+			userDefined := make(map[string]string)
+			if ref.CustomMeta != "" {
+				_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
+			}
+			objInfo := minio.ObjectInfo{UserDefined: userDefined}
+			setMetaInfo(&objInfo)
+			v := currentVersion(ref.Path, ref)
+
+			obj := lifecycle.ObjectOpts{
+				Name:        getRelativePathOfObj(ref.Path, bucket),
+				UserTags:    objInfo.UserTags,
+				ModTime:     v.modTime,
+				IsLatest:    true,
+				NumVersions: 1,
+			}
+			if opts.Versioned || opts.VersionSuspended {
+				obj.VersionID = v.versionID
+			}
+			ls.record(func(run *lifecycleRun) { run.ObjectsScanned++ })
+			if lc.ComputeAction(obj) != lifecycle.DeleteAction {
+				continue
+			}
+			expired = append(expired, minio.ObjectToDelete{ObjectV: minio.ObjectV{ObjectName: obj.Name}})
+			if len(expired) >= currentOptions().MaxBatchSize {
+				flush()
+			}
+		}
+		if !isTruncated {
+			break
+		}
+		marker = nextMarker
+	}
+	flush()
+}
@@ -0,0 +1,85 @@
+package zcn
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	manifestFile    = "manifest.json"
+	manifestVersion = 1
+)
+
+// multipartManifest is the on-disk state of a multipart upload. It is stored
+// next to the part files so an upload survives a gateway restart.
+type multipartManifest struct {
+	Version     int               `json:"version"`
+	UploadID    string            `json:"uploadId"`
+	Bucket      string            `json:"bucket"`
+	Object      string            `json:"object"`
+	ContentType string            `json:"contentType"`
+	Codec       string            `json:"codec,omitempty"`
+	UserDefined map[string]string `json:"userDefined,omitempty"`
+	Initiated   time.Time         `json:"initiated"`
+	Parts       []manifestPart    `json:"parts"`
+}
+
+type manifestPart struct {
+	Number  int       `json:"number"`
+	ETag    string    `json:"etag"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func uploadDirPath(localStorageDir, bucket, uploadID string) string {
+	return filepath.Join(localStorageDir, bucket, uploadID)
+}
+
+func partFilePath(localStorageDir, bucket, uploadID, object string, partNumber int) string {
+	return filepath.Join(localStorageDir, bucket, uploadID, object, fmt.Sprintf("part%d", partNumber))
+}
+
+// addPart records a received part, replacing an earlier upload of the same part number.
+func (m *multipartManifest) addPart(part manifestPart) {
+	i := sort.Search(len(m.Parts), func(i int) bool { return m.Parts[i].Number >= part.Number })
+	if i < len(m.Parts) && m.Parts[i].Number == part.Number {
+		m.Parts[i] = part
+		return
+	}
+	m.Parts = append(m.Parts, manifestPart{})
+	copy(m.Parts[i+1:], m.Parts[i:])
+	m.Parts[i] = part
+}
+
+// save writes the manifest atomically so a crash never leaves a torn file behind.
+func (m *multipartManifest) save(localStorageDir string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dir := uploadDirPath(localStorageDir, m.Bucket, m.UploadID)
+	tmpFile := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(dir, manifestFile))
+}
+
+func loadManifest(manifestPath string) (*multipartManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	m := &multipartManifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return m, nil
+}
@@ -34,12 +34,48 @@ func (mf *memFile) Read(p []byte) (int, error) {
 	}
 }
 
+// pipeFile is a sys.File streaming the blocks the sdk downloads into a pipe.
+// The first skip bytes are dropped and only limit bytes are passed on, the
+// pipe is closed once they are written and the rest of the blocks is dropped.
 type pipeFile struct {
-	w *io.PipeWriter
+	w     *io.PipeWriter
+	skip  int64
+	limit int64 // all bytes when negative
+}
+
+func newPipeFile(w *io.PipeWriter, skip, limit int64) *pipeFile {
+	return &pipeFile{w: w, skip: skip, limit: limit}
 }
 
 func (pf *pipeFile) Write(p []byte) (int, error) {
-	return pf.w.Write(p)
+	n := len(p)
+	if pf.skip > 0 {
+		if int64(len(p)) <= pf.skip {
+			pf.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[pf.skip:]
+		pf.skip = 0
+	}
+	if pf.limit == 0 {
+		return n, nil
+	}
+	if pf.limit > 0 && int64(len(p)) >= pf.limit {
+		p = p[:pf.limit]
+		pf.limit = 0
+		if _, err := pf.w.Write(p); err != nil {
+			return 0, err
+		}
+		pf.w.Close()
+		return n, nil
+	}
+	if pf.limit > 0 {
+		pf.limit -= int64(len(p))
+	}
+	if _, err := pf.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
 func (pf *pipeFile) Close() error {
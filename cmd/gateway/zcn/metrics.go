@@ -0,0 +1,284 @@
+package zcn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/minio/madmin-go"
+	minio "github.com/minio/minio/cmd"
+)
+
+const (
+	// allocationStatsInterval is how long allocation stats and blobber probes
+	// are reused before they are fetched again, the health monitor refreshes
+	// them more often by default.
+	allocationStatsInterval = time.Minute
+	blobberProbeTimeout     = 5 * time.Second
+)
+
+// gatewayMetrics counts the traffic of the gateway to all allocations, the
+// metrics of each allocation are kept by zcnAllocation.
+var gatewayMetrics = minio.NewMetrics()
+
+// counters counts the operations of the gateway on the network.
+var counters backendCounters
+
+type backendCounters struct {
+	uploads          uint64
+	downloads        uint64
+	batches          uint64
+	batchedOps       uint64
+	consensusRetries uint64
+	sameRootErrors   uint64
+}
+
+func (za *zcnAllocation) incRequests(method string) {
+	za.metrics.IncRequests(method)
+	gatewayMetrics.IncRequests(method)
+}
+
+func (za *zcnAllocation) incBytesReceived(n int64) {
+	if n > 0 {
+		za.metrics.IncBytesReceived(uint64(n))
+		gatewayMetrics.IncBytesReceived(uint64(n))
+	}
+}
+
+func (za *zcnAllocation) incBytesSent(n int64) {
+	if n > 0 {
+		za.metrics.IncBytesSent(uint64(n))
+		gatewayMetrics.IncBytesSent(uint64(n))
+	}
+}
+
+// countBatch counts a batch of ops committed with DoMultiOperation.
+func countBatch(ops int) {
+	atomic.AddUint64(&counters.batches, 1)
+	atomic.AddUint64(&counters.batchedOps, uint64(ops))
+}
+
+// receivedBytesReader counts the bytes of an object downloaded from an
+// allocation as they are read by the client.
+type receivedBytesReader struct {
+	io.Reader
+	za *zcnAllocation
+}
+
+func (r *receivedBytesReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.za.incBytesReceived(int64(n))
+	return
+}
+
+// blobberStatus is the state of a blobber of an allocation as last probed.
+type blobberStatus struct {
+	ID      string        `json:"id"`
+	URL     string        `json:"url"`
+	Online  bool          `json:"online"`
+	Latency time.Duration `json:"latency"`
+}
+
+// allocationStats is the capacity of an allocation and the state of its
+// blobbers. Sizes are those of the data, the blobbers together store
+// (data+parity)/data times as much.
+type allocationStats struct {
+	ID           string          `json:"id"`
+	Size         int64           `json:"size"`
+	UsedSize     int64           `json:"usedSize"`
+	DataShards   int             `json:"dataShards"`
+	ParityShards int             `json:"parityShards"`
+	Expiration   time.Time       `json:"expiration"`
+	Blobbers     []blobberStatus `json:"blobbers"`
+	Updated      time.Time       `json:"updated"`
+}
+
+// allocStats caches the stats of the allocations served by the gateway.
+var allocStats = &allocationStatsCache{stats: make(map[string]*allocationStats)}
+
+type allocationStatsCache struct {
+	sync.Mutex
+	stats map[string]*allocationStats
+}
+
+// get returns the stats of za, which are fetched from the network when they
+// are older than allocationStatsInterval.
+func (sc *allocationStatsCache) get(ctx context.Context, za *zcnAllocation) (*allocationStats, error) {
+	if cur, ok := sc.cached(za.id); ok && time.Since(cur.Updated) < allocationStatsInterval {
+		return cur, nil
+	}
+	return sc.refresh(ctx, za)
+}
+
+// cached returns the last stats fetched for the allocation.
+func (sc *allocationStatsCache) cached(id string) (*allocationStats, bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	stats, ok := sc.stats[id]
+	return stats, ok
+}
+
+// refresh fetches the stats of za, the previous stats are returned with the
+// error when they cannot be fetched.
+func (sc *allocationStatsCache) refresh(ctx context.Context, za *zcnAllocation) (*allocationStats, error) {
+	stats, err := fetchAllocationStats(ctx, za.id)
+	sc.Lock()
+	defer sc.Unlock()
+	if err != nil {
+		if cur, ok := sc.stats[za.id]; ok {
+			return cur, err
+		}
+		return &allocationStats{ID: za.id}, err
+	}
+	sc.stats[za.id] = stats
+	return stats, nil
+}
+
+// fetchAllocationStats gets the allocation from the network, the allocation
+// used for uploads is left as is, and probes its blobbers.
+func fetchAllocationStats(ctx context.Context, id string) (*allocationStats, error) {
+	alloc, err := sdk.GetAllocation(id)
+	if err != nil {
+		return nil, err
+	}
+	stats := &allocationStats{
+		ID:           id,
+		Size:         alloc.Size,
+		DataShards:   alloc.DataShards,
+		ParityShards: alloc.ParityShards,
+		Expiration:   time.Unix(alloc.Expiration, 0).UTC(),
+		Blobbers:     make([]blobberStatus, len(alloc.Blobbers)),
+		Updated:      time.Now(),
+	}
+	if alloc.Stats != nil {
+		stats.UsedSize = alloc.Stats.UsedSize
+	}
+
+	var wg sync.WaitGroup
+	for i, b := range alloc.Blobbers {
+		wg.Add(1)
+		go func(i int, id, url string) {
+			defer wg.Done()
+			stats.Blobbers[i] = probeBlobber(ctx, id, url)
+		}(i, b.ID, b.Baseurl)
+	}
+	wg.Wait()
+	return stats, nil
+}
+
+// probeBlobber measures the latency of a request to the blobber, which is
+// online when it answers at all.
+func probeBlobber(ctx context.Context, id, url string) blobberStatus {
+	status := blobberStatus{ID: id, URL: url}
+	ctx, cancel := context.WithTimeout(ctx, blobberProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/_healthcheck", nil)
+	if err != nil {
+		return status
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return status
+	}
+	resp.Body.Close()
+	status.Online = true
+	status.Latency = time.Since(start)
+	return status
+}
+
+// StorageInfo reports every blobber of every allocation as a disk, the
+// allocations are the pools. The capacity of a blobber is its share of the
+// allocation size.
+func (zob *zcnObjects) StorageInfo(ctx context.Context) (si minio.StorageInfo, errs []error) {
+	si.Backend.Type = madmin.Gateway
+	si.Backend.OnlineDisks = madmin.BackendDisks{}
+	si.Backend.OfflineDisks = madmin.BackendDisks{}
+	for i, za := range allocations.list() {
+		stats, err := allocStats.get(ctx, za)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("allocation %s: %w", za.id, err))
+		}
+		if i == 0 {
+			si.Backend.StandardSCParity = stats.ParityShards
+		}
+		si.Backend.StandardSCData = append(si.Backend.StandardSCData, stats.DataShards)
+
+		var total, used uint64
+		if stats.DataShards > 0 {
+			total = uint64(stats.Size / int64(stats.DataShards))
+			used = uint64(stats.UsedSize / int64(stats.DataShards))
+		}
+		for j, b := range stats.Blobbers {
+			disk := madmin.Disk{
+				Endpoint:     b.URL,
+				DrivePath:    za.id,
+				UUID:         b.ID,
+				State:        madmin.DriveStateOffline,
+				TotalSpace:   total,
+				UsedSpace:    used,
+				PoolIndex:    i,
+				DiskIndex:    j,
+				ReadLatency:  b.Latency.Seconds(),
+				WriteLatency: b.Latency.Seconds(),
+			}
+			if total > used {
+				disk.AvailableSpace = total - used
+			}
+			if b.Online {
+				disk.State = madmin.DriveStateOk
+				si.Backend.OnlineDisks[za.id]++
+				si.Backend.GatewayOnline = true
+			} else {
+				si.Backend.OfflineDisks[za.id]++
+			}
+			si.Disks = append(si.Disks, disk)
+		}
+	}
+	return si, errs
+}
+
+// GatewayMetrics exports the capacity and blobbers of the allocations and the
+// counters of the gateway.
+func (zob *zcnObjects) GatewayMetrics(ctx context.Context) []minio.GatewayMetric {
+	metrics := []minio.GatewayMetric{
+		{Name: "uploads_total", Help: "Total number of objects uploaded", Counter: true, Value: float64(atomic.LoadUint64(&counters.uploads))},
+		{Name: "downloads_total", Help: "Total number of objects downloaded", Counter: true, Value: float64(atomic.LoadUint64(&counters.downloads))},
+		{Name: "batches_total", Help: "Total number of batches of operations committed", Counter: true, Value: float64(atomic.LoadUint64(&counters.batches))},
+		{Name: "batched_operations_total", Help: "Total number of operations committed in batches", Counter: true, Value: float64(atomic.LoadUint64(&counters.batchedOps))},
+		{Name: "consensus_retries_total", Help: "Total number of requests retried for lack of consensus of the blobbers", Counter: true, Value: float64(atomic.LoadUint64(&counters.consensusRetries))},
+		{Name: "same_root_errors_total", Help: "Total number of commits answered with the previous allocation root", Counter: true, Value: float64(atomic.LoadUint64(&counters.sameRootErrors))},
+	}
+	for _, za := range allocations.list() {
+		stats, _ := allocStats.get(ctx, za)
+		if stats.Updated.IsZero() {
+			continue
+		}
+		labels := map[string]string{"allocation": za.id}
+		metrics = append(metrics,
+			minio.GatewayMetric{Name: "allocation_size_bytes", Help: "Size of the allocation", Value: float64(stats.Size), Labels: labels},
+			minio.GatewayMetric{Name: "allocation_used_bytes", Help: "Bytes used in the allocation", Value: float64(stats.UsedSize), Labels: labels},
+			minio.GatewayMetric{Name: "allocation_data_shards", Help: "Number of data shards of the allocation", Value: float64(stats.DataShards), Labels: labels},
+			minio.GatewayMetric{Name: "allocation_parity_shards", Help: "Number of parity shards of the allocation", Value: float64(stats.ParityShards), Labels: labels},
+			minio.GatewayMetric{Name: "allocation_expiration_timestamp_seconds", Help: "Expiration of the allocation as unix time", Value: float64(stats.Expiration.Unix()), Labels: labels},
+		)
+		for _, b := range stats.Blobbers {
+			labels := map[string]string{"allocation": za.id, "blobber": b.ID, "url": b.URL}
+			var online float64
+			if b.Online {
+				online = 1
+			}
+			metrics = append(metrics,
+				minio.GatewayMetric{Name: "blobber_online", Help: "Whether the blobber answered the last probe", Value: online, Labels: labels},
+				minio.GatewayMetric{Name: "blobber_latency_seconds", Help: "Latency of the last probe of the blobber", Value: b.Latency.Seconds(), Labels: labels},
+			)
+		}
+	}
+	return metrics
+}
@@ -3,7 +3,6 @@ package zcn
 import (
 	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,17 +10,20 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0chain/gosdk/constants"
 	"github.com/0chain/gosdk/zboxcore/sdk"
 	"github.com/google/uuid"
-	"github.com/pierrec/lz4/v4"
 
 	minio "github.com/minio/minio/cmd"
 	"github.com/minio/minio/cmd/gateway/zcn/seqpriorityqueue"
+	"github.com/minio/minio/internal/hash"
 	"github.com/minio/pkg/mimedb"
 )
 
@@ -36,9 +38,13 @@ const lz4MimeType = "application/x-lz4"
 
 const PartSize = 1024 * 128
 
+// minPartSize is the S3 minimum size of every part but the last one.
+const minPartSize = 5 * oneMB
+
 type MultiPartFile struct {
 	memFile         *memFile
 	lock            sync.Mutex
+	manifest        *multipartManifest
 	fileSize        int64
 	lastPartSize    int64
 	lastPartID      int
@@ -49,6 +55,35 @@ type MultiPartFile struct {
 	dataC           chan []byte   // data to be uploaded
 }
 
+// addPart records a received part in the upload manifest.
+func (mpf *MultiPartFile) addPart(part manifestPart) error {
+	mpf.lock.Lock()
+	defer mpf.lock.Unlock()
+	mpf.manifest.addPart(part)
+	return mpf.manifest.save(localStorageDir)
+}
+
+// multipartInfo returns a snapshot of the upload described by the manifest.
+func (mpf *MultiPartFile) multipartInfo() (minio.MultipartInfo, []manifestPart) {
+	mpf.lock.Lock()
+	defer mpf.lock.Unlock()
+	m := mpf.manifest
+	return minio.MultipartInfo{
+		Bucket:      m.Bucket,
+		Object:      m.Object,
+		UploadID:    m.UploadID,
+		Initiated:   m.Initiated,
+		UserDefined: m.UserDefined,
+	}, append([]manifestPart(nil), m.Parts...)
+}
+
+func getMultipartFile(uploadID string) (*MultiPartFile, bool) {
+	mapLock.Lock()
+	defer mapLock.Unlock()
+	mpf, ok := FileMap[uploadID]
+	return mpf, ok
+}
+
 func (mpf *MultiPartFile) UpdateFileSize(partID int, size int64) {
 	mpf.lock.Lock()
 	defer mpf.lock.Unlock()
@@ -83,24 +118,90 @@ func (mpf *MultiPartFile) UpdateFileSize(partID int, size int64) {
 }
 
 func (zob *zcnObjects) NewMultipartUpload(ctx context.Context, bucket string, object string, opts minio.ObjectOptions) (uploadID string, err error) {
+	if err = zob.health.writable(bucket); err != nil {
+		return
+	}
 	log.Println("initial multipart upload, partNumber:", opts.PartNumber)
 	contentType := opts.UserDefined["content-type"]
 	if contentType == "" {
 		contentType = mimedb.TypeByExtension(path.Ext(object))
 	}
 
-	var toCompress bool
-
-	if compress && !hasStringSuffixInSlice(object, minio.StandardExcludeCompressExtensions) && !hasPattern(minio.StandardExcludeCompressContentTypes, contentType) {
-		toCompress = true
-		contentType = lz4MimeType
+	userDefined := opts.UserDefined
+	if opts.Versioned || opts.VersionSuspended {
+		var remotePath string
+		if bucket == rootBucketName {
+			remotePath = filepath.Join(rootPath, object)
+		} else {
+			remotePath = filepath.Join(rootPath, bucket, object)
+		}
+		unlock, err := lockPath(ctx, allocations.forBucket(bucket), remotePath)
+		if err != nil {
+			return "", err
+		}
+		ref, err := zob.getCurrentRef(remotePath)
+		if err != nil {
+			unlock()
+			return "", err
+		}
+		// The object is replaced as the upload streams, so the version it
+		// replaces is kept right away. Should the upload be aborted the copy
+		// is ignored while the version is still current.
+		err = zob.archiveCurrent(remotePath, ref, opts.Versioned)
+		unlock()
+		if err != nil {
+			return "", err
+		}
+		userDefined, _ = versionMeta(userDefined, opts.Versioned, time.Now())
+	}
+	za := allocations.forBucket(bucket)
+	userDefined = encryptionMeta(userDefined, encryptUpload(za, opts))
+	codec := za.compressionCodec(object, contentType)
+	if codec != "" {
+		// The final size is unknown until the upload completes, it is
+		// appended to the compressed stream instead.
+		userDefined = compressionMeta(userDefined, codec, contentType, -1)
+		contentType = codecMimeTypes[codec]
 	}
 
-	return zob.newMultiPartUpload(localStorageDir, bucket, object, contentType, toCompress, opts.UserDefined)
+	return zob.newMultiPartUpload(localStorageDir, bucket, object, contentType, codec, userDefined)
 }
 
-func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, contentType string, toCompress bool, userDefined map[string]string) (string, error) {
+func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, contentType, codec string, userDefined map[string]string) (string, error) {
 	// Generate a unique upload ID
+	uploadID := uuid.New().String()
+	manifest := &multipartManifest{
+		Version:     manifestVersion,
+		UploadID:    uploadID,
+		Bucket:      bucket,
+		Object:      object,
+		ContentType: contentType,
+		Codec:       codec,
+		UserDefined: userDefined,
+		Initiated:   time.Now().UTC(),
+	}
+	// Create the bucket directory if it doesn't exist
+	bucketPath := filepath.Join(localStorageDir, bucket, uploadID, object)
+	if err := os.MkdirAll(bucketPath, os.ModePerm); err != nil {
+		log.Println(err)
+		return "", fmt.Errorf("error creating bucket: %v", err)
+	}
+	if err := manifest.save(localStorageDir); err != nil {
+		cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir)
+		return "", fmt.Errorf("error saving upload manifest: %v", err)
+	}
+	if _, err := zob.startMultipartUpload(localStorageDir, manifest); err != nil {
+		cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir)
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// startMultipartUpload registers the upload described by manifest and streams
+// its parts to the allocation in order as they become available.
+func (zob *zcnObjects) startMultipartUpload(localStorageDir string, manifest *multipartManifest) (*MultiPartFile, error) {
+	bucket, object, uploadID := manifest.Bucket, manifest.Object, manifest.UploadID
+	contentType, codec, userDefined := manifest.ContentType, manifest.Codec, manifest.UserDefined
 	var isUpdate bool
 	var remotePath string
 	if bucket == rootBucketName {
@@ -108,49 +209,51 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 	} else {
 		remotePath = filepath.Join(rootPath, bucket, object)
 	}
-	ref, err := getSingleRegularRef(zob.alloc, remotePath)
+	za := allocations.forBucket(bucket)
+	ref, err := getSingleRegularRef(za.alloc, remotePath)
 	if err != nil {
 		if !isPathNoExistError(err) {
-			return "", err
+			return nil, err
 		}
 	}
 
 	if ref != nil {
 		isUpdate = true
 	}
-	uploadID := uuid.New().String()
 	mapLock.Lock()
 	memFile := &memFile{
 		memFileDataChan: make(chan memFileData, 240),
 		errChan:         make(chan error),
 	}
-	chunkWriteSize := int(zob.alloc.GetChunkReadSize(encrypt))
+	encrypt := isEncryptedUpload(userDefined)
+	chunkWriteSize := int(za.alloc.GetChunkReadSize(encrypt))
 	multiPartFile := &MultiPartFile{
-		memFile: memFile,
-		seqPQ:   seqpriorityqueue.NewSeqPriorityQueue(),
-		errorC:  make(chan error, 1),
-		dataC:   make(chan []byte, 20),
-		cancelC: make(chan struct{}, 1),
+		memFile:  memFile,
+		manifest: manifest,
+		seqPQ:    seqpriorityqueue.NewSeqPriorityQueue(),
+		errorC:   make(chan error, 1),
+		dataC:    make(chan []byte, 20),
+		cancelC:  make(chan struct{}, 1),
 	}
 	FileMap[uploadID] = multiPartFile
 	mapLock.Unlock()
-	// Create the bucket directory if it doesn't exist
-	bucketPath := filepath.Join(localStorageDir, bucket, uploadID, object)
-	if err := os.MkdirAll(bucketPath, os.ModePerm); err != nil {
-		log.Println(err)
-		return "", fmt.Errorf("erro creating bucket: %v", err)
-	}
 
 	go func() {
 		buf := &bytes.Buffer{}
 		var (
-			zw    *lz4.Writer
-			total int64
-			err   error
+			zw       io.WriteCloser
+			total    int64
+			rawTotal int64
+			err      error
 		)
+		toCompress := codec != ""
 		if toCompress {
-			zw = lz4.NewWriter(buf)
-			zw.Apply(lz4.CompressionLevelOption(lz4.Level1)) //nolint:errcheck
+			zw, err = newCompressWriter(codec, buf)
+			if err != nil {
+				memFile.errChan <- err
+				cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir)
+				return
+			}
 		}
 		st := time.Now()
 		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Minute)
@@ -169,6 +272,7 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 				return
 			case data, ok := <-multiPartFile.dataC:
 				if ok {
+					rawTotal += int64(len(data))
 					if toCompress {
 						_, err = zw.Write(data)
 					} else {
@@ -213,6 +317,7 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 							multiPartFile.cancelC <- struct{}{}
 							break
 						}
+						buf.Write(sizeTrailer(rawTotal))
 					}
 					bbuf := make([]byte, buf.Len())
 					_, err := buf.Read(bbuf)
@@ -235,9 +340,6 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 					close(multiPartFile.memFile.memFileDataChan)
 					total += int64(cn)
 					log.Println("uploaded:", total, " duration:", time.Since(st))
-					if toCompress {
-						multiPartFile.fileSize = total
-					}
 					return
 				}
 			}
@@ -277,7 +379,7 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 
 		go func() {
 			// run this in background, will block until the data is written to memFile
-			uploadErr := zob.alloc.DoMultiOperation([]sdk.OperationRequest{operationRequest})
+			uploadErr := za.alloc.DoMultiOperation([]sdk.OperationRequest{operationRequest})
 			if uploadErr != nil {
 				cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir)
 			}
@@ -300,7 +402,7 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 					return
 				}
 
-				partFilename := filepath.Join(localStorageDir, bucket, uploadID, object, fmt.Sprintf("part%d", partNumber))
+				partFilename := partFilePath(localStorageDir, bucket, uploadID, object, partNumber)
 
 				func() {
 					// Open the part file for reading
@@ -310,10 +412,9 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 						multiPartFile.cancelC <- struct{}{}
 						return
 					}
-					defer func() {
-						partFile.Close()
-						_ = os.Remove(partFilename)
-					}()
+					// The part is kept until the upload completes so the upload
+					// can be replayed after a restart.
+					defer partFile.Close()
 					stat, err := partFile.Stat()
 					if err != nil {
 						log.Println("stat error: ", err)
@@ -333,14 +434,66 @@ func (zob *zcnObjects) newMultiPartUpload(localStorageDir, bucket, object, conte
 			}
 		}
 	}()
-	return uploadID, nil
+	return multiPartFile, nil
+}
 
+// recoverMultipartUploads restarts the uploads that were in flight when the
+// gateway stopped. The allocation upload is replayed from the parts kept on
+// disk, uploads whose manifest cannot be replayed are aborted. Directories
+// without a valid manifest are left alone, they may hold uploads of an older
+// gateway or data that is not ours.
+func (zob *zcnObjects) recoverMultipartUploads(localStorageDir string) {
+	uploadDirs, err := filepath.Glob(filepath.Join(localStorageDir, "*", "*"))
+	if err != nil {
+		log.Println("error listing multipart uploads:", err)
+		return
+	}
+	for _, uploadDir := range uploadDirs {
+		manifest, err := loadManifest(filepath.Join(uploadDir, manifestFile))
+		if err != nil {
+			log.Printf("skipping %v, no valid multipart upload manifest: %v\n", uploadDir, err)
+			continue
+		}
+		if uploadDirPath(localStorageDir, manifest.Bucket, manifest.UploadID) != filepath.Clean(uploadDir) {
+			log.Printf("skipping %v, its manifest belongs to upload %v of %v\n", uploadDir, manifest.UploadID, manifest.Bucket)
+			continue
+		}
+		if err = zob.resumeMultipartUpload(localStorageDir, manifest); err != nil {
+			log.Printf("aborting multipart upload at %v: %v\n", uploadDir, err)
+			os.RemoveAll(uploadDir) //nolint:errcheck
+			continue
+		}
+		log.Printf("resumed multipart upload %v of %v/%v with %d parts\n", manifest.UploadID, manifest.Bucket, manifest.Object, len(manifest.Parts))
+	}
+}
+
+func (zob *zcnObjects) resumeMultipartUpload(localStorageDir string, manifest *multipartManifest) error {
+	for _, part := range manifest.Parts {
+		partFilename := partFilePath(localStorageDir, manifest.Bucket, manifest.UploadID, manifest.Object, part.Number)
+		if _, err := os.Stat(partFilename); err != nil {
+			return err
+		}
+	}
+	// The allocation upload starts over from the first part.
+	multiPartFile, err := zob.startMultipartUpload(localStorageDir, manifest)
+	if err != nil {
+		return err
+	}
+	for _, part := range manifest.Parts {
+		multiPartFile.UpdateFileSize(part.Number, part.Size)
+		multiPartFile.seqPQ.Push(part.Number)
+	}
+	return nil
 }
 
 func (zob *zcnObjects) PutObjectPart(ctx context.Context, bucket, object, uploadID string, partID int, data *minio.PutObjReader, opts minio.ObjectOptions) (pi minio.PartInfo, err error) {
-	partFilename := filepath.Join(localStorageDir, bucket, uploadID, object, fmt.Sprintf("part%d", partID))
-	partETagFilename := partFilename + ".etag"
+	multiPartFile, ok := getMultipartFile(uploadID)
+	if !ok {
+		log.Printf("uploadID: %v not found\n", uploadID)
+		return minio.PartInfo{}, minio.InvalidUploadID{Bucket: bucket, Object: object, UploadID: uploadID}
+	}
 
+	partFilename := partFilePath(localStorageDir, bucket, uploadID, object, partID)
 	partFile, err := os.Create(partFilename)
 	if err != nil {
 		log.Println(err)
@@ -348,16 +501,7 @@ func (zob *zcnObjects) PutObjectPart(ctx context.Context, bucket, object, upload
 	}
 	defer partFile.Close()
 
-	mapLock.Lock()
-	multiPartFile, ok := FileMap[uploadID]
-	mapLock.Unlock()
-	if !ok {
-		log.Printf("uploadID: %v not found\n", uploadID)
-		return minio.PartInfo{}, fmt.Errorf("uploadID: %v not found", uploadID)
-	}
 	seqPQ := multiPartFile.seqPQ
-	// Create an MD5 hash to calculate ETag
-	// hash := md5.New()
 
 	buf := make([]byte, PartSize)
 	size, err := io.CopyBuffer(partFile, data.Reader, buf)
@@ -366,38 +510,105 @@ func (zob *zcnObjects) PutObjectPart(ctx context.Context, bucket, object, upload
 		return minio.PartInfo{}, fmt.Errorf("error writing part data: %v", err)
 	}
 
-	seqPQ.Push(partID)
-
 	// Calculate ETag for the part
-	// eTag := hex.EncodeToString(hash.Sum(nil))
 	eTag := data.MD5CurrentHexString()
+	modTime := time.Now().UTC()
 
-	// Save the ETag to a separate file
-	if err := os.WriteFile(partETagFilename, []byte(eTag), 0644); err != nil {
-		log.Println("error saving ETag file:", err)
-		return minio.PartInfo{}, fmt.Errorf("error saving ETag file: %v", err)
+	// Record the part before it is streamed so the manifest never lags behind the upload
+	if err := multiPartFile.addPart(manifestPart{
+		Number:  partID,
+		ETag:    eTag,
+		Size:    size,
+		ModTime: modTime,
+	}); err != nil {
+		log.Println("error saving upload manifest:", err)
+		return minio.PartInfo{}, fmt.Errorf("error saving upload manifest: %v", err)
 	}
 
+	seqPQ.Push(partID)
+
 	multiPartFile.UpdateFileSize(partID, int64(size))
 
 	return minio.PartInfo{
-		PartNumber: partID,
-		ETag:       eTag,
-		Size:       int64(size),
-		ActualSize: int64(size),
+		PartNumber:   partID,
+		LastModified: modTime,
+		ETag:         eTag,
+		Size:         int64(size),
+		ActualSize:   int64(size),
 	}, nil
 }
 
-func (zob *zcnObjects) CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, uploadedParts []minio.CompletePart, opts minio.ObjectOptions) (oi minio.ObjectInfo, err error) {
+// CopyObjectPart copies a range of an existing object into a part of an
+// in-progress upload. The part is fed into the same sequential pipeline as
+// uploaded parts.
+func (zob *zcnObjects) CopyObjectPart(ctx context.Context, srcBucket, srcObject, destBucket, destObject, uploadID string, partID int, startOffset, length int64, srcInfo minio.ObjectInfo, srcOpts, dstOpts minio.ObjectOptions) (pi minio.PartInfo, err error) {
+	if _, ok := getMultipartFile(uploadID); !ok {
+		return pi, minio.InvalidUploadID{Bucket: destBucket, Object: destObject, UploadID: uploadID}
+	}
 
-	mapLock.Lock()
-	multiPartFile, ok := FileMap[uploadID]
-	mapLock.Unlock()
+	// The copy handler already opens the source range and version through
+	// GetObjectNInfo, only direct callers need it to be read here.
+	data := srcInfo.PutObjReader
+	if data == nil {
+		var srcRemotePath string
+		if srcBucket == rootBucketName {
+			srcRemotePath = filepath.Join(rootPath, srcObject)
+		} else {
+			srcRemotePath = filepath.Join(rootPath, srcBucket, srcObject)
+		}
+		if srcOpts.VersionID != "" {
+			v, _, err := zob.getObjectVersion(srcBucket, srcObject, srcRemotePath, srcOpts.VersionID)
+			if err != nil {
+				return pi, err
+			}
+			if v.deleteMarker {
+				return pi, minio.MethodNotAllowed{Bucket: srcBucket, Object: srcObject}
+			}
+			srcRemotePath = v.refPath
+		}
+		rs := &minio.HTTPRangeSpec{Start: startOffset, End: startOffset + length - 1}
+		r, _, fCloser, err := getFileReader(ctx, allocations.forBucket(srcBucket).alloc, srcBucket, srcObject, srcRemotePath, rs)
+		if err != nil {
+			return pi, err
+		}
+		defer fCloser()
+		hashReader, err := hash.NewReader(r, length, "", "", length)
+		if err != nil {
+			return pi, err
+		}
+		data = minio.NewPutObjReader(hashReader)
+	}
+
+	return zob.PutObjectPart(ctx, destBucket, destObject, uploadID, partID, data, dstOpts)
+}
+
+func (zob *zcnObjects) CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, uploadedParts []minio.CompletePart, opts minio.ObjectOptions) (oi minio.ObjectInfo, err error) {
+	multiPartFile, ok := getMultipartFile(uploadID)
 	if !ok {
 		log.Printf("uploadID: %v not found\n", uploadID)
-		return minio.ObjectInfo{}, fmt.Errorf("uploadID: %v not found", uploadID)
+		return minio.ObjectInfo{}, minio.InvalidUploadID{Bucket: bucket, Object: object, UploadID: uploadID}
+	}
+
+	// Validate before the upload is finalized so a rejected request leaves it
+	// in progress for the client to retry or abort.
+	if err = validateCompleteParts(multiPartFile, uploadedParts); err != nil {
+		return minio.ObjectInfo{}, err
 	}
 
+	var remotePath string
+	if bucket == rootBucketName {
+		remotePath = filepath.Join(rootPath, object)
+	} else {
+		remotePath = filepath.Join(rootPath, bucket, object)
+	}
+	// The parts were streamed ahead, the upload is committed once the last
+	// part is in. The object is locked from then until its metadata is stored.
+	unlock, err := lockPath(ctx, allocations.forBucket(bucket), remotePath)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	defer unlock()
+
 	// wait for upload to finish
 	multiPartFile.seqPQ.Done()
 	err = <-multiPartFile.errorC
@@ -405,6 +616,8 @@ func (zob *zcnObjects) CompleteMultipartUpload(ctx context.Context, bucket, obje
 		log.Println("Error uploading to Zus storage:", err)
 		return minio.ObjectInfo{}, fmt.Errorf("error uploading to Zus storage: %v", err)
 	}
+	atomic.AddUint64(&counters.uploads, 1)
+	allocations.forBucket(bucket).incBytesSent(multiPartFile.fileSize)
 
 	eTag, err := zob.constructCompleteObject(bucket, uploadID, object, localStorageDir)
 	if err != nil {
@@ -412,54 +625,119 @@ func (zob *zcnObjects) CompleteMultipartUpload(ctx context.Context, bucket, obje
 		return minio.ObjectInfo{}, fmt.Errorf("error constructing complete object: %v", err)
 	}
 
-	if err = cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir); err != nil {
-		log.Println("Error cleaning up part files and directories:", err)
-		// http.Error(w, "Error cleaning up part files and directories", http.StatusInternalServerError)
-		return minio.ObjectInfo{}, fmt.Errorf("error cleaning up part files and directories: %v", err)
+	meta := make(map[string]string, len(multiPartFile.manifest.UserDefined)+2)
+	for k, v := range multiPartFile.manifest.UserDefined {
+		meta[k] = v
+	}
+	meta[zcnETagKey] = eTag
+	if multiPartFile.manifest.Codec != "" {
+		// The uncompressed size was appended to the stream, it is stored
+		// along with the ETag so listings do not need to read it.
+		var size int64
+		_, parts := multiPartFile.multipartInfo()
+		for _, part := range parts {
+			size += part.Size
+		}
+		meta[zcnActualSizeKey] = strconv.FormatInt(size, 10)
+	}
+	err = zob.saveMultipartMeta(bucket, remotePath, meta)
+	if cleanupErr := cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir); cleanupErr != nil {
+		log.Println("Error cleaning up part files and directories:", cleanupErr)
+		if err == nil {
+			err = fmt.Errorf("error cleaning up part files and directories: %v", cleanupErr)
+		}
+	}
+	if err != nil {
+		return minio.ObjectInfo{}, err
 	}
 	log.Println("finish uploading: ", multiPartFile.fileSize, " name: ", object)
 	return minio.ObjectInfo{
-		Bucket:  bucket,
-		Name:    object,
-		ETag:    eTag,
-		Size:    multiPartFile.fileSize,
-		ModTime: time.Now(),
+		Bucket:    bucket,
+		Name:      object,
+		ETag:      eTag,
+		Size:      multiPartFile.fileSize,
+		ModTime:   time.Now(),
+		VersionID: multiPartFile.manifest.UserDefined[zcnVersionIDKey],
 	}, nil
 }
 
+// saveMultipartMeta stores userDefined as the metadata of the object at
+// remotePath. The object was streamed before its ETag and size were known, they
+// are kept in its sidecar rather than uploading it again. The object must be
+// locked with lockPath.
+func (zob *zcnObjects) saveMultipartMeta(bucket, remotePath string, userDefined map[string]string) error {
+	za := allocations.forBucket(bucket)
+	stored, err := getStoredRef(za.alloc, remotePath)
+	if err != nil {
+		return fmt.Errorf("error saving multipart metadata: %v", err)
+	}
+	if err = sidecars.put(stored, stored.MimeType, userDefined); err != nil {
+		return fmt.Errorf("error saving multipart metadata: %v", err)
+	}
+	indexRefresh(za, remotePath)
+	return nil
+}
+
 // Function to construct the complete object file
 func (zob *zcnObjects) constructCompleteObject(bucket, uploadID, object, localStorageDir string) (string, error) {
-	// Create a slice to store individual part ETags
-	var partETags []string
-	for partNumber := 1; ; partNumber++ {
-		partFilename := filepath.Join(localStorageDir, bucket, uploadID, object, fmt.Sprintf("part%d", partNumber))
-		partETagFilename := partFilename + ".etag"
-
-		// Break the loop when there are no more parts
-		if _, err := os.Stat(partETagFilename); os.IsNotExist(err) {
-			break
-		}
-
-		// Read the ETag of the part
-		partETagBytes, err := os.ReadFile(partETagFilename)
-		if err != nil {
-			return "", err
-		}
+	manifest, err := loadManifest(filepath.Join(uploadDirPath(localStorageDir, bucket, uploadID), manifestFile))
+	if err != nil {
+		return "", err
+	}
 
-		// Append the part ETag to the slice
-		partETags = append(partETags, string(partETagBytes))
+	parts := make([]minio.CompletePart, 0, len(manifest.Parts))
+	for _, part := range manifest.Parts {
+		parts = append(parts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
 	}
 
-	// Get the concatenated ETag value
-	eTag := strings.Join(partETags, "")
+	// S3 compatible ETag, the MD5 of the part MD5s suffixed with the part count
+	return minio.ComputeCompleteMultipartMD5(parts), nil
+}
+
+// validateCompleteParts checks the part list of a complete request against the
+// parts received. Parts are streamed to the allocation in order as they
+// arrive, so unlike S3 the list must name every received part.
+func validateCompleteParts(multiPartFile *MultiPartFile, uploadedParts []minio.CompletePart) error {
+	_, parts := multiPartFile.multipartInfo()
+	for i, uploadedPart := range uploadedParts {
+		if i > 0 && uploadedPart.PartNumber <= uploadedParts[i-1].PartNumber {
+			return minio.InvalidPartOrder{PartNumber: uploadedPart.PartNumber}
+		}
+		if i >= len(parts) || parts[i].Number != uploadedPart.PartNumber {
+			return minio.InvalidPart{PartNumber: uploadedPart.PartNumber, GotETag: uploadedPart.ETag}
+		}
+		part := parts[i]
+		if canonicalizeETag(uploadedPart.ETag) != canonicalizeETag(part.ETag) {
+			return minio.InvalidPart{PartNumber: part.Number, ExpETag: part.ETag, GotETag: uploadedPart.ETag}
+		}
+		if i < len(uploadedParts)-1 && part.Size < minPartSize {
+			return minio.PartTooSmall{PartNumber: part.Number, PartSize: part.Size, PartETag: uploadedPart.ETag}
+		}
+	}
+	if len(uploadedParts) == 0 {
+		return minio.InvalidPart{}
+	}
+	for i, part := range parts {
+		if part.Number != i+1 || i >= len(uploadedParts) {
+			return minio.InvalidPart{PartNumber: part.Number, ExpETag: part.ETag}
+		}
+	}
+	return nil
+}
 
-	return eTag, nil
+func canonicalizeETag(etag string) string {
+	return strings.Trim(etag, "\"")
 }
 
-// Function to clean up temporary part files and directories
+// Function to clean up temporary part files and directories, the upload is
+// forgotten along with them.
 func cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir string) error {
+	mapLock.Lock()
+	delete(FileMap, uploadID)
+	mapLock.Unlock()
+
 	// Remove the upload directory
-	uploadDir := filepath.Join(localStorageDir, bucket, uploadID)
+	uploadDir := uploadDirPath(localStorageDir, bucket, uploadID)
 	if err := os.RemoveAll(uploadDir); err != nil {
 		return err
 	}
@@ -469,69 +747,135 @@ func cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir string) error {
 
 // GetMultipartInfo returns multipart info of the uploadId of the object
 func (zob *zcnObjects) GetMultipartInfo(ctx context.Context, bucket, object, uploadID string, opts minio.ObjectOptions) (result minio.MultipartInfo, err error) {
-	result.Bucket = bucket
-	result.Object = object
-	result.UploadID = uploadID
+	multiPartFile, ok := getMultipartFile(uploadID)
+	if !ok {
+		return result, minio.InvalidUploadID{Bucket: bucket, Object: object, UploadID: uploadID}
+	}
+	result, _ = multiPartFile.multipartInfo()
 	return result, nil
 }
 
 func (zob *zcnObjects) ListObjectParts(ctx context.Context, bucket string, object string, uploadID string, partNumberMarker int, maxParts int, opts minio.ObjectOptions) (lpi minio.ListPartsInfo, err error) {
-	// Generate the path for the parts information file
-	partsInfoPath := filepath.Join(localStorageDir, bucket, uploadID, object)
-
-	// Check if the parts information file exists
-	_, err = os.Stat(partsInfoPath)
-	if err != nil {
-		return minio.ListPartsInfo{}, fmt.Errorf("Unable to list object parts: %w", err)
+	multiPartFile, ok := getMultipartFile(uploadID)
+	if !ok {
+		return lpi, minio.InvalidUploadID{Bucket: bucket, Object: object, UploadID: uploadID}
 	}
 
-	// Read the parts information from the file (you may use your preferred method to read and parse the information)
-	// For simplicity, we assume a simple JSON file here
+	info, parts := multiPartFile.multipartInfo()
 	partsInfo := minio.ListPartsInfo{
-		Object:   object,
-		Bucket:   bucket,
-		UploadID: uploadID,
+		Object:           object,
+		Bucket:           bucket,
+		UploadID:         uploadID,
+		PartNumberMarker: partNumberMarker,
+		MaxParts:         maxParts,
+		UserDefined:      info.UserDefined,
 	}
 
-	for i := partNumberMarker; i <= maxParts; i++ {
-		partFilename := filepath.Join(localStorageDir, bucket, uploadID, object, fmt.Sprintf("part%d", i))
-		// Read the ETag of the part
-		partETagFilename := partFilename + ".etag"
-		// Check if the part file exists
-		fs, err := os.Stat(partETagFilename)
-		if err != nil {
-			// If the part file does not exist, we have reached the end of the parts list
+	for _, p := range parts {
+		if p.Number <= partNumberMarker {
+			continue
+		}
+		if len(partsInfo.Parts) == maxParts {
+			partsInfo.IsTruncated = true
 			break
 		}
+		partsInfo.Parts = append(partsInfo.Parts, minio.PartInfo{
+			PartNumber:   p.Number,
+			LastModified: p.ModTime,
+			ETag:         p.ETag,
+			Size:         p.Size,
+			ActualSize:   p.Size,
+		})
+		partsInfo.NextPartNumberMarker = p.Number
+	}
 
-		partETagBytes, err := os.ReadFile(partETagFilename)
-		if err != nil {
-			return minio.ListPartsInfo{}, fmt.Errorf("Unable to read part ETag: %w", err)
+	return partsInfo, nil
+}
+
+// ListMultipartUploads lists the in-progress uploads of the bucket, including
+// the ones recovered from disk after a restart.
+func (zob *zcnObjects) ListMultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker, delimiter string, maxUploads int) (result minio.ListMultipartsInfo, err error) {
+	result = minio.ListMultipartsInfo{
+		KeyMarker:      keyMarker,
+		UploadIDMarker: uploadIDMarker,
+		MaxUploads:     maxUploads,
+		Prefix:         prefix,
+		Delimiter:      delimiter,
+	}
+
+	mapLock.Lock()
+	multiPartFiles := make([]*MultiPartFile, 0, len(FileMap))
+	for _, multiPartFile := range FileMap {
+		multiPartFiles = append(multiPartFiles, multiPartFile)
+	}
+	mapLock.Unlock()
+
+	var uploads []minio.MultipartInfo
+	for _, multiPartFile := range multiPartFiles {
+		info, _ := multiPartFile.multipartInfo()
+		if info.Bucket == bucket && strings.HasPrefix(info.Object, prefix) {
+			uploads = append(uploads, info)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Object == uploads[j].Object {
+			return uploads[i].UploadID < uploads[j].UploadID
+		}
+		return uploads[i].Object < uploads[j].Object
+	})
+
+	seenPrefixes := make(map[string]struct{})
+	for _, upload := range uploads {
+		if keyMarker != "" {
+			if upload.Object < keyMarker {
+				continue
+			}
+			if upload.Object == keyMarker && (uploadIDMarker == "" || upload.UploadID <= uploadIDMarker) {
+				continue
+			}
+			if delimiter != "" && strings.HasSuffix(keyMarker, delimiter) && strings.HasPrefix(upload.Object, keyMarker) {
+				continue
+			}
 		}
 
-		// Append the part information to the parts list
-		part := minio.PartInfo{
-			PartNumber:   i,
-			LastModified: fs.ModTime(),
-			ETag:         hex.EncodeToString(partETagBytes),
-			Size:         fs.Size(),
-			ActualSize:   fs.Size(),
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(upload.Object[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = upload.Object[:len(prefix)+i+len(delimiter)]
+				if _, ok := seenPrefixes[commonPrefix]; ok {
+					continue
+				}
+			}
 		}
 
-		partsInfo.Parts = append(partsInfo.Parts, part)
+		if len(result.Uploads)+len(result.CommonPrefixes) >= maxUploads {
+			result.IsTruncated = true
+			break
+		}
+		if commonPrefix != "" {
+			seenPrefixes[commonPrefix] = struct{}{}
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix)
+			result.NextKeyMarker = commonPrefix
+			result.NextUploadIDMarker = ""
+			continue
+		}
+		result.Uploads = append(result.Uploads, upload)
+		result.NextKeyMarker = upload.Object
+		result.NextUploadIDMarker = upload.UploadID
 	}
-
-	return partsInfo, nil
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextUploadIDMarker = ""
+	}
+	return result, nil
 }
 
 func (zob *zcnObjects) AbortMultipartUpload(ctx context.Context, bucket string, object string, uploadID string, opts minio.ObjectOptions) error {
 	log.Println("abort multipart upload, clean up temp dirs")
-	mapLock.Lock()
-	multiPartFile, ok := FileMap[uploadID]
-	mapLock.Unlock()
+	multiPartFile, ok := getMultipartFile(uploadID)
 	if !ok {
 		log.Printf("uploadID: %v not found\n", uploadID)
-		return fmt.Errorf("abort - uploadID: %v not found", uploadID)
+		return minio.InvalidUploadID{Bucket: bucket, Object: object, UploadID: uploadID}
 	}
 	close(multiPartFile.cancelC)
 	return cleanupPartFilesAndDirs(bucket, uploadID, localStorageDir)
@@ -0,0 +1,457 @@
+package zcn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+	xhttp "github.com/minio/minio/internal/http"
+	"github.com/minio/minio/internal/logger"
+)
+
+const (
+	// systemDir is reserved for gateway data on the allocation and is hidden
+	// from bucket and object listings.
+	systemDir = "/.minio.sys"
+	// sidecarDir holds the metadata sidecars of objects.
+	sidecarDir = systemDir + "/objmeta"
+	// zcnETagKey is stored in the CustomMeta of objects whose ETag is not the
+	// hash of their content, like the ones of multipart uploads.
+	zcnETagKey = minio.ReservedMetadataPrefix + "Zcn-Etag"
+)
+
+// sidecars holds the metadata sidecars of the objects served by the gateway.
+var sidecars = newSidecarStore()
+
+// metaSidecar holds the metadata of an object changed after its upload. gosdk
+// can only set the mime type and CustomMeta of a ref by uploading its data
+// again, so they are written to a small file of their own instead and take the
+// place of the ones of the ref whenever refs are read from the allocation.
+//
+// A sidecar belongs to one upload of its object, identified by the content
+// hash and the mod time the gateway recorded in the CustomMeta of the ref. Once
+// the object is uploaded again it no longer applies, the gateway removes it
+// when it replaces or deletes the object. Other Züs clients only see the
+// metadata the object was uploaded with.
+type metaSidecar struct {
+	RemotePath    string `json:"path"`
+	ObjectHash    string `json:"objectHash"`
+	ObjectModTime string `json:"objectModTime,omitempty"`
+	MimeType      string `json:"mimeType"`
+	CustomMeta    string `json:"customMeta"`
+}
+
+// uploadModTime returns the mod time the gateway recorded in the CustomMeta
+// of ref when it was uploaded, empty for files written by other clients.
+func uploadModTime(ref *sdk.ORef) string {
+	var meta map[string]string
+	if ref.CustomMeta != "" {
+		_ = json.Unmarshal([]byte(ref.CustomMeta), &meta)
+	}
+	return meta[zcnModTimeKey]
+}
+
+func (s *metaSidecar) appliesTo(ref *sdk.ORef) bool {
+	return s.ObjectHash == ref.ActualFileHash && s.ObjectModTime == uploadModTime(ref)
+}
+
+// sidecarStore stores one small file per sidecar under sidecarDir. The sidecar
+// is kept in the CustomMeta of that file so a single ref listing loads all of
+// them, and they are cached in memory. The sidecar of an object is stored on
+// the allocation of the object. While the gateway shares its allocations with
+// other gateways it sees their changes once the store is reloaded.
+type sidecarStore struct {
+	sync.RWMutex
+	sidecars map[string]*metaSidecar // keyed by remote path of the object
+}
+
+func newSidecarStore() *sidecarStore {
+	return &sidecarStore{
+		sidecars: make(map[string]*metaSidecar),
+	}
+}
+
+func isSystemPath(remotePath string) bool {
+	return remotePath == systemDir || strings.HasPrefix(remotePath, systemDir+"/")
+}
+
+// listFiles returns all files below remotePath, a missing path has no files.
+func listFiles(alloc *sdk.Allocation, remotePath string) ([]sdk.ORef, error) {
+	var refs []sdk.ORef
+	offsetPath := ""
+	for {
+		oResult, err := getRegularRefs(alloc, remotePath, offsetPath, fileType, pageLimit)
+		if err != nil {
+			if isPathNoExistError(err) {
+				return refs, nil
+			}
+			return nil, err
+		}
+		refs = append(refs, oResult.Refs...)
+		if len(oResult.Refs) < pageLimit {
+			return refs, nil
+		}
+		offsetPath = oResult.OffsetPath
+	}
+}
+
+// putSystemFile writes a small file of gateway data below systemDir. Its
+// content is repeated in customMeta so that listing the refs is enough to read it.
+func putSystemFile(alloc *sdk.Allocation, remotePath string, data []byte, customMeta string, exists bool) error {
+	opRequest := sdk.OperationRequest{
+		OperationType: constants.FileOperationInsert,
+		FileReader:    bytes.NewReader(data),
+		Workdir:       workDir,
+		RemotePath:    remotePath,
+		FileMeta: sdk.FileMeta{
+			RemotePath: remotePath,
+			RemoteName: path.Base(remotePath),
+			ActualSize: int64(len(data)),
+			MimeType:   "application/json",
+			CustomMeta: customMeta,
+		},
+		Opts: []sdk.ChunkedUploadOption{
+			sdk.WithChunkNumber(120),
+		},
+	}
+	if exists {
+		opRequest.OperationType = constants.FileOperationUpdate
+	}
+	err := alloc.DoMultiOperation([]sdk.OperationRequest{opRequest})
+	if err != nil && !exists && !isSameRootError(err) {
+		// The file may have been written by another gateway.
+		opRequest.OperationType = constants.FileOperationUpdate
+		opRequest.FileReader = bytes.NewReader(data)
+		err = alloc.DoMultiOperation([]sdk.OperationRequest{opRequest})
+	}
+	if err != nil && !isSameRootError(err) {
+		return err
+	}
+	return nil
+}
+
+func sidecarPath(remotePath string) string {
+	sum := sha256.Sum256([]byte(remotePath))
+	return path.Join(sidecarDir, hex.EncodeToString(sum[:]))
+}
+
+// load reads the sidecars stored on all allocations.
+func (ss *sidecarStore) load() error {
+	loaded := make(map[string]*metaSidecar)
+	for _, za := range allocations.list() {
+		refs, err := listFiles(za.alloc, sidecarDir)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			s := &metaSidecar{}
+			if err := json.Unmarshal([]byte(ref.CustomMeta), s); err != nil || s.RemotePath == "" {
+				continue
+			}
+			if allocations.forPath(s.RemotePath).id != za.id {
+				// Left behind by a bucket since mapped to another allocation.
+				continue
+			}
+			loaded[s.RemotePath] = s
+		}
+	}
+
+	ss.Lock()
+	ss.sidecars = loaded
+	ss.Unlock()
+	return nil
+}
+
+func (ss *sidecarStore) get(remotePath string) *metaSidecar {
+	ss.RLock()
+	defer ss.RUnlock()
+	return ss.sidecars[remotePath]
+}
+
+// apply replaces the mime type and CustomMeta of ref with the ones of its
+// sidecar, if it has one.
+func (ss *sidecarStore) apply(ref *sdk.ORef) {
+	s := ss.get(ref.Path)
+	if s == nil || ref.Type != fileType || !s.appliesTo(ref) {
+		return
+	}
+	ref.MimeType = s.MimeType
+	ref.CustomMeta = s.CustomMeta
+}
+
+// reload reads the sidecar of the object at remotePath from its allocation,
+// another gateway sharing the allocation may have changed it.
+func (ss *sidecarStore) reload(remotePath string) error {
+	ref, err := getStoredRef(allocations.forPath(remotePath).alloc, sidecarPath(remotePath))
+	if err != nil {
+		if !isPathNoExistError(err) {
+			return err
+		}
+		ss.Lock()
+		delete(ss.sidecars, remotePath)
+		ss.Unlock()
+		return nil
+	}
+	s := &metaSidecar{}
+	if err = json.Unmarshal([]byte(ref.CustomMeta), s); err != nil {
+		return err
+	}
+	ss.Lock()
+	ss.sidecars[remotePath] = s
+	ss.Unlock()
+	return nil
+}
+
+func (ss *sidecarStore) save(s *metaSidecar) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	exists := ss.get(s.RemotePath) != nil
+	alloc := allocations.forPath(s.RemotePath).alloc
+	if err = putSystemFile(alloc, sidecarPath(s.RemotePath), data, string(data), exists); err != nil {
+		return err
+	}
+	ss.Lock()
+	ss.sidecars[s.RemotePath] = s
+	ss.Unlock()
+	return nil
+}
+
+// put sets the mime type and CustomMeta of the object stored in ref, as read
+// from the allocation without its sidecar. The object must be locked with lockPath.
+func (ss *sidecarStore) put(stored *sdk.ORef, mimeType string, userDefined map[string]string) error {
+	var customMeta string
+	if len(userDefined) > 0 {
+		meta, _ := json.Marshal(userDefined)
+		customMeta = string(meta)
+	}
+	return ss.save(&metaSidecar{
+		RemotePath:    stored.Path,
+		ObjectHash:    stored.ActualFileHash,
+		ObjectModTime: uploadModTime(stored),
+		MimeType:      mimeType,
+		CustomMeta:    customMeta,
+	})
+}
+
+// copy gives the object at dstPath, just copied from srcPath, the sidecar of
+// the source. A sidecar left at dstPath is removed when the source has none.
+func (ss *sidecarStore) copy(srcPath, dstPath string) error {
+	s := ss.get(srcPath)
+	if s == nil {
+		ss.remove(dstPath)
+		return nil
+	}
+	dst := *s
+	dst.RemotePath = dstPath
+	return ss.save(&dst)
+}
+
+// remove deletes the sidecars of the objects at remotePaths. Failures are only
+// logged as a sidecar does not apply to the object once it is uploaded again.
+func (ss *sidecarStore) remove(remotePaths ...string) {
+	ops := make(map[*sdk.Allocation][]sdk.OperationRequest)
+	ss.Lock()
+	for _, remotePath := range remotePaths {
+		if _, ok := ss.sidecars[remotePath]; !ok {
+			continue
+		}
+		delete(ss.sidecars, remotePath)
+		alloc := allocations.forPath(remotePath).alloc
+		ops[alloc] = append(ops[alloc], sdk.OperationRequest{
+			OperationType: constants.FileOperationDelete,
+			RemotePath:    sidecarPath(remotePath),
+		})
+	}
+	ss.Unlock()
+	for alloc, allocOps := range ops {
+		if err := alloc.DoMultiOperation(allocOps); err != nil && !isSameRootError(err) {
+			logger.Error("error removing metadata sidecars: %v", err)
+		}
+	}
+}
+
+// setMetaInfo sets the ETag and tags recorded in the metadata of an object.
+// Tags stored with the user metadata are moved to UserTags and a stored ETag
+// replaces the content hash.
+func setMetaInfo(objInfo *minio.ObjectInfo) {
+	if etag := objInfo.UserDefined[zcnETagKey]; etag != "" {
+		objInfo.ETag = etag
+	}
+	if tags, ok := objInfo.UserDefined[xhttp.AmzObjectTagging]; ok {
+		objInfo.UserTags = tags
+		delete(objInfo.UserDefined, xhttp.AmzObjectTagging)
+	}
+}
+
+func isInternalMetaKey(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), minio.ReservedMetadataPrefixLower)
+}
+
+// userMetadata returns the part of userDefined that clients may replace,
+// without internal metadata and tags.
+func userMetadata(userDefined map[string]string) map[string]string {
+	meta := make(map[string]string, len(userDefined))
+	for k, v := range userDefined {
+		if isInternalMetaKey(k) || strings.EqualFold(k, xhttp.AmzObjectTagging) || strings.EqualFold(k, xhttp.AmzTagDirective) {
+			continue
+		}
+		meta[k] = v
+	}
+	return meta
+}
+
+// setUserMetadata replaces the user metadata of userDefined with meta,
+// internal metadata and tags are kept.
+func setUserMetadata(userDefined, meta map[string]string) {
+	for k := range userDefined {
+		if !isInternalMetaKey(k) && !strings.EqualFold(k, xhttp.AmzObjectTagging) {
+			delete(userDefined, k)
+		}
+	}
+	for k, v := range meta {
+		userDefined[k] = v
+	}
+}
+
+// updateObjectMeta changes the metadata of the current version of an object
+// with fn and returns the updated object info. fn is given the user metadata
+// and content type of the object, the result is stored in its sidecar so the
+// data of the object is not transferred again. With newVersion the change
+// makes a new version of the object, the current one is kept as noncurrent
+// when opts is versioned.
+func (zob *zcnObjects) updateObjectMeta(ctx context.Context, bucket, object string, opts minio.ObjectOptions, newVersion bool, fn func(userDefined map[string]string, contentType *string) error) (minio.ObjectInfo, error) {
+	if err := zob.health.writable(bucket); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	var remotePath string
+	if bucket == rootBucketName {
+		remotePath = filepath.Join(rootPath, object)
+	} else {
+		remotePath = filepath.Join(rootPath, bucket, object)
+	}
+
+	za := allocations.forBucket(bucket)
+	unlock, err := lockPath(ctx, za, remotePath)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	defer unlock()
+
+	if minio.IsGatewayDistributed() {
+		if err = sidecars.reload(remotePath); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	}
+	stored, err := getStoredRef(za.alloc, remotePath)
+	if err != nil {
+		if isPathNoExistError(err) {
+			return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: bucket, Object: object}
+		}
+		return minio.ObjectInfo{}, err
+	}
+	if stored.Type != fileType {
+		return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: bucket, Object: object}
+	}
+	ref := *stored
+	sidecars.apply(&ref)
+	if opts.VersionID != "" && currentVersion(remotePath, &ref).versionID != opts.VersionID {
+		// Noncurrent versions are kept as they were written.
+		return minio.ObjectInfo{}, minio.NotImplemented{Message: "Changing metadata of noncurrent versions is not supported"}
+	}
+
+	userDefined := make(map[string]string)
+	if ref.CustomMeta != "" {
+		if err = json.Unmarshal([]byte(ref.CustomMeta), &userDefined); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	}
+	_, compressed := userDefined[zcnCompressionKey]
+	contentType := ref.MimeType
+	if compressed {
+		contentType = userDefined[zcnContentTypeKey]
+	}
+
+	current, currentType := maps.Clone(userDefined), contentType
+	if err = fn(userDefined, &contentType); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if newVersion {
+		if err = zob.archiveCurrent(remotePath, &ref, opts.Versioned); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+		delete(userDefined, zcnVersionIDKey)
+		userDefined, _ = versionMeta(userDefined, opts.Versioned, time.Now())
+		opts.VersionID = ""
+	} else if contentType == currentType && maps.Equal(userDefined, current) {
+		// Nothing to store, like tags set again to the same value.
+		return zob.GetObjectInfo(ctx, bucket, object, opts)
+	}
+	mimeType := contentType
+	if compressed {
+		// Compressed objects keep the mime type of their codec.
+		userDefined[zcnContentTypeKey] = contentType
+		mimeType = ref.MimeType
+	}
+	if err = sidecars.put(stored, mimeType, userDefined); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	indexRefresh(za, remotePath)
+	return zob.GetObjectInfo(ctx, bucket, object, opts)
+}
+
+// replaceMetadata sets the user metadata, content type and tags of an object
+// from userDefined without the client uploading its data again.
+func (zob *zcnObjects) replaceMetadata(ctx context.Context, bucket, object string, userDefined map[string]string, opts minio.ObjectOptions, newVersion bool) (minio.ObjectInfo, error) {
+	return zob.updateObjectMeta(ctx, bucket, object, opts, newVersion, func(meta map[string]string, contentType *string) error {
+		setUserMetadata(meta, userMetadata(userDefined))
+		if tags := userDefined[xhttp.AmzObjectTagging]; tags != "" {
+			meta[xhttp.AmzObjectTagging] = tags
+		} else {
+			delete(meta, xhttp.AmzObjectTagging)
+		}
+		if ct := userDefined["content-type"]; ct != "" {
+			*contentType = ct
+		}
+		return nil
+	})
+}
+
+// PutObjectMetadata updates the metadata of an object.
+func (zob *zcnObjects) PutObjectMetadata(ctx context.Context, bucket, object string, opts minio.ObjectOptions) (minio.ObjectInfo, error) {
+	objInfo, err := zob.GetObjectInfo(ctx, bucket, object, opts)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if objInfo.DeleteMarker {
+		return minio.ObjectInfo{}, minio.MethodNotAllowed{Bucket: bucket, Object: object}
+	}
+	if opts.EvalMetadataFn != nil {
+		if err = opts.EvalMetadataFn(objInfo); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	}
+	userDefined := make(map[string]string, len(objInfo.UserDefined)+len(opts.UserDefined)+1)
+	for k, v := range objInfo.UserDefined {
+		userDefined[k] = v
+	}
+	for k, v := range opts.UserDefined {
+		userDefined[k] = v
+	}
+	if _, ok := userDefined[xhttp.AmzObjectTagging]; !ok && objInfo.UserTags != "" {
+		userDefined[xhttp.AmzObjectTagging] = objInfo.UserTags
+	}
+	return zob.replaceMetadata(ctx, bucket, object, userDefined, opts, false)
+}
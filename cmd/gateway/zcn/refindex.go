@@ -0,0 +1,467 @@
+package zcn
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+	art "github.com/plar/go-adaptive-radix-tree"
+)
+
+const (
+	defaultRefIndexInterval = 60 // minutes
+
+	// refIndexDir is the directory next to zs3server.json the ref index of
+	// each allocation is saved to.
+	refIndexDir = "refindex"
+)
+
+// refIndexes holds the ref indexes of the allocations, it is nil when the
+// ref index is not enabled in zs3server.json.
+var refIndexes *refIndexRegistry
+
+type refIndexRegistry struct {
+	sync.Mutex
+	ctx      context.Context
+	dir      string
+	interval time.Duration
+	indexes  map[string]*refIndex // keyed by allocation id
+}
+
+func newRefIndexRegistry(ctx context.Context, dir string, interval time.Duration) *refIndexRegistry {
+	return &refIndexRegistry{
+		ctx:      ctx,
+		dir:      dir,
+		interval: interval,
+		indexes:  make(map[string]*refIndex),
+	}
+}
+
+// get returns the index of za, the index of an allocation is built when it
+// is first asked for. It returns nil when the ref index is not enabled.
+func (rr *refIndexRegistry) get(za *zcnAllocation) *refIndex {
+	if rr == nil {
+		return nil
+	}
+	rr.Lock()
+	defer rr.Unlock()
+	ri, ok := rr.indexes[za.id]
+	if !ok {
+		ri = newRefIndex(za.id, za.alloc, filepath.Join(rr.dir, za.id+".json"))
+		rr.indexes[za.id] = ri
+		go ri.run(rr.ctx, rr.interval)
+	}
+	return ri
+}
+
+// ready returns the tree of the index of za, nil when the index cannot
+// answer for the allocation.
+func (rr *refIndexRegistry) ready(za *zcnAllocation) *minio.ThreadSafeListTree {
+	ri := rr.get(za)
+	if ri == nil {
+		return nil
+	}
+	return ri.current()
+}
+
+// save writes the indexes which are ready to disk.
+func (rr *refIndexRegistry) save() {
+	if rr == nil {
+		return
+	}
+	rr.Lock()
+	defer rr.Unlock()
+	for _, ri := range rr.indexes {
+		if err := ri.save(); err != nil {
+			log.Println("saving ref index of allocation", ri.id, ":", err)
+		}
+	}
+}
+
+// indexRefresh updates the refs of remotePaths in the index of za after the
+// gateway wrote them.
+func indexRefresh(za *zcnAllocation, remotePaths ...string) {
+	ri := refIndexes.get(za)
+	if ri == nil {
+		return
+	}
+	for _, remotePath := range remotePaths {
+		if err := ri.refresh(remotePath); err != nil {
+			log.Println("refreshing", remotePath, "in ref index of allocation", ri.id, ":", err)
+			ri.invalidate()
+			return
+		}
+	}
+}
+
+// refIndex is a local copy of the refs of an allocation, which answers
+// listings and HEAD requests without asking the blobbers. Files are keyed by
+// their remote path and directories by their remote path with a trailing
+// slash, so that the keys are in the order S3 lists objects. The index is
+// bootstrapped from the saved copy or a walk of the allocation, kept current
+// by the writes of the gateway and rebuilt every interval to pick up the
+// changes made by other clients.
+type refIndex struct {
+	id       string
+	alloc    *sdk.Allocation
+	file     string
+	rebuildC chan struct{}
+
+	mu         sync.Mutex
+	tree       *minio.ThreadSafeListTree // nil until the index is ready
+	rebuilding bool
+	pending    []func(*minio.ThreadSafeListTree) // updates to replay on the rebuilt tree
+}
+
+func newRefIndex(id string, alloc *sdk.Allocation, file string) *refIndex {
+	return &refIndex{
+		id:       id,
+		alloc:    alloc,
+		file:     file,
+		rebuildC: make(chan struct{}, 1),
+	}
+}
+
+func refKey(remotePath, refType string) art.Key {
+	if refType == dirType {
+		return art.Key(strings.TrimSuffix(remotePath, "/") + "/")
+	}
+	return art.Key(remotePath)
+}
+
+func insertRef(tree *minio.ThreadSafeListTree, ref sdk.ORef) {
+	if ref.Path == rootPath || isSystemPath(ref.Path) {
+		return
+	}
+	tree.Insert(refKey(ref.Path, ref.Type), ref)
+}
+
+// deleteRefs removes remotePath and everything below it from tree.
+func deleteRefs(tree *minio.ThreadSafeListTree, remotePath string) {
+	var keys []art.Key
+	tree.ForEachPrefix(refKey(remotePath, dirType), func(n art.Node) bool {
+		if n.Kind() == art.Leaf {
+			keys = append(keys, n.Key())
+		}
+		return true
+	})
+	keys = append(keys, refKey(remotePath, fileType))
+	for _, key := range keys {
+		tree.Delete(key)
+	}
+}
+
+// run bootstraps the index and rebuilds it every interval until ctx is
+// canceled.
+func (ri *refIndex) run(ctx context.Context, interval time.Duration) {
+	if err := ri.load(); err != nil && !os.IsNotExist(err) {
+		log.Println("loading ref index of allocation", ri.id, ":", err)
+	}
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ri.rebuildC:
+		case <-t.C:
+		}
+		start := time.Now()
+		if err := ri.rebuild(ctx); err != nil {
+			log.Println("rebuilding ref index of allocation", ri.id, ":", err)
+		} else if err = ri.save(); err != nil {
+			log.Println("saving ref index of allocation", ri.id, ":", err)
+		} else {
+			log.Println("rebuilt ref index of allocation", ri.id, "in", time.Since(start))
+		}
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(interval)
+	}
+}
+
+// current returns the tree of the index, nil when it is not ready.
+func (ri *refIndex) current() *minio.ThreadSafeListTree {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	return ri.tree
+}
+
+// invalidate stops answering from the index until it is rebuilt, which is
+// done right away.
+func (ri *refIndex) invalidate() {
+	ri.mu.Lock()
+	ri.tree = nil
+	ri.mu.Unlock()
+	select {
+	case ri.rebuildC <- struct{}{}:
+	default:
+	}
+}
+
+// update applies fn to the tree, and to the tree being rebuilt once the walk
+// of the allocation is done.
+func (ri *refIndex) update(fn func(*minio.ThreadSafeListTree)) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if ri.tree != nil {
+		fn(ri.tree)
+	}
+	if ri.rebuilding {
+		ri.pending = append(ri.pending, fn)
+	}
+}
+
+// refresh gets the ref of remotePath from the allocation and replaces the
+// refs of the path in the index with it. Missing parent directories are
+// added, the allocation creates them with the file.
+func (ri *refIndex) refresh(remotePath string) error {
+	remotePath = filepath.Clean(remotePath)
+	ref, err := getSingleRegularRef(ri.alloc, remotePath)
+	if err != nil {
+		if !isPathNoExistError(err) {
+			return err
+		}
+		ri.update(func(tree *minio.ThreadSafeListTree) {
+			deleteRefs(tree, remotePath)
+		})
+		return nil
+	}
+	found := *ref
+	ri.update(func(tree *minio.ThreadSafeListTree) {
+		if found.Type == fileType {
+			deleteRefs(tree, remotePath)
+		} else {
+			tree.Delete(refKey(remotePath, fileType))
+		}
+		insertRef(tree, found)
+		for dir := filepath.Dir(remotePath); dir != rootPath; dir = filepath.Dir(dir) {
+			if _, ok := tree.Search(refKey(dir, dirType)); ok {
+				break
+			}
+			insertRef(tree, sdk.ORef{
+				Path:      dir,
+				Name:      filepath.Base(dir),
+				Type:      dirType,
+				CreatedAt: found.UpdatedAt,
+				UpdatedAt: found.UpdatedAt,
+			})
+		}
+	})
+	return nil
+}
+
+// lookupRef returns the ref of remotePath in tree, a file or a directory.
+func lookupRef(tree *minio.ThreadSafeListTree, remotePath string) (*sdk.ORef, bool) {
+	remotePath = filepath.Clean(remotePath)
+	for _, refType := range []string{fileType, dirType} {
+		if v, ok := tree.Search(refKey(remotePath, refType)); ok {
+			ref := v.(sdk.ORef)
+			return &ref, true
+		}
+	}
+	return nil, false
+}
+
+// rebuild walks the allocation into a new tree, which replaces the current
+// one. The updates made during the walk are replayed on the new tree.
+func (ri *refIndex) rebuild(ctx context.Context) error {
+	ri.mu.Lock()
+	ri.rebuilding, ri.pending = true, nil
+	ri.mu.Unlock()
+
+	tree := minio.NewThreadSafeListTree()
+	err := walkRefs(ctx, ri.alloc, func(ref sdk.ORef) {
+		insertRef(tree, ref)
+	})
+
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if err == nil {
+		for _, fn := range ri.pending {
+			fn(tree)
+		}
+		ri.tree = tree
+	}
+	ri.rebuilding, ri.pending = false, nil
+	return err
+}
+
+// walkRefs calls fn with every ref of the allocation.
+func walkRefs(ctx context.Context, alloc *sdk.Allocation, fn func(sdk.ORef)) error {
+	offsetPath := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		oResult, err := alloc.GetRefs(rootPath, offsetPath, "", "", "", "regular", 0, pageLimit)
+		if err != nil {
+			if isPathNoExistError(err) {
+				return nil
+			}
+			return err
+		}
+		if len(oResult.Refs) == 0 {
+			return nil
+		}
+		for _, ref := range oResult.Refs {
+			sidecars.apply(&ref)
+			fn(ref)
+		}
+		offsetPath = oResult.OffsetPath
+	}
+}
+
+// load reads the index saved by a previous run, which answers until the
+// allocation is walked again.
+func (ri *refIndex) load() error {
+	data, err := os.ReadFile(ri.file)
+	if err != nil {
+		return err
+	}
+	var refs []sdk.ORef
+	if err = json.Unmarshal(data, &refs); err != nil {
+		return err
+	}
+	tree := minio.NewThreadSafeListTree()
+	for _, ref := range refs {
+		insertRef(tree, ref)
+	}
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if ri.tree == nil {
+		ri.tree = tree
+	}
+	return nil
+}
+
+// save writes the index to its file, an index which is not ready is not
+// saved.
+func (ri *refIndex) save() error {
+	tree := ri.current()
+	if tree == nil {
+		return nil
+	}
+	refs := make([]sdk.ORef, 0, tree.Size())
+	tree.ForEachPrefix(art.Key(""), func(n art.Node) bool {
+		if n.Kind() == art.Leaf {
+			refs = append(refs, n.Value().(sdk.ORef))
+		}
+		return true
+	})
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(ri.file), 0o700); err != nil {
+		return err
+	}
+	tmp := ri.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ri.file)
+}
+
+// indexedEntry is a ref listed from the index with its object name.
+type indexedEntry struct {
+	name string
+	ref  sdk.ORef
+}
+
+// listIndexedObjects lists the objects of bucket from the index. Keys are
+// matched by prefix as on S3, the directory of the prefix is listed as an
+// object like ListObjects does without the index.
+func (zob *zcnObjects) listIndexedObjects(ctx context.Context, tree *minio.ThreadSafeListTree, za *zcnAllocation, bucket, prefix, marker, delimiter string, maxKeys int) (result minio.ListObjectsInfo, err error) {
+	base := filepath.Join(rootPath, bucket) + "/"
+	var entries []indexedEntry
+	var last string
+	tree.ForEachPrefix(art.Key(base+prefix), func(n art.Node) bool {
+		if n.Kind() != art.Leaf {
+			return true
+		}
+		name := strings.TrimPrefix(string(n.Key()), base)
+		if name == "" || name <= marker {
+			return true
+		}
+		ref := n.Value().(sdk.ORef)
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := name[:len(prefix)+i+len(delimiter)]
+				if commonPrefix <= marker || commonPrefix == last {
+					return true
+				}
+				if maxKeys > 0 && len(entries)+len(result.Prefixes) == maxKeys {
+					result.IsTruncated = true
+					return false
+				}
+				result.Prefixes = append(result.Prefixes, commonPrefix)
+				last = commonPrefix
+				return true
+			}
+		}
+		// Directories are listed through their prefixes.
+		if ref.Type == dirType && name != prefix {
+			return true
+		}
+		if maxKeys > 0 && len(entries)+len(result.Prefixes) == maxKeys {
+			result.IsTruncated = true
+			return false
+		}
+		entries = append(entries, indexedEntry{name: name, ref: ref})
+		last = name
+		return true
+	})
+	if result.IsTruncated {
+		result.NextMarker = last
+	}
+
+	for _, entry := range entries {
+		ref := entry.ref
+		userDefined := make(map[string]string)
+		if ref.CustomMeta != "" {
+			_ = json.Unmarshal([]byte(ref.CustomMeta), &userDefined)
+		}
+		if ref.Type == dirType {
+			result.Objects = append(result.Objects, minio.ObjectInfo{
+				Bucket:       bucket,
+				Name:         entry.name,
+				ModTime:      ref.UpdatedAt.ToTime(),
+				IsDir:        true,
+				ContentType:  s3DirectoryContentType,
+				ETag:         s3ContentHash,
+				StorageClass: "STANDARD",
+				UserDefined:  userDefined,
+			})
+			continue
+		}
+		objInfo := minio.ObjectInfo{
+			Bucket:       bucket,
+			Name:         entry.name,
+			ModTime:      ref.UpdatedAt.ToTime(),
+			Size:         ref.ActualFileSize,
+			ContentType:  ref.MimeType,
+			ETag:         ref.ActualFileHash,
+			StorageClass: "STANDARD",
+			UserDefined:  userDefined,
+		}
+		setMetaInfo(&objInfo)
+		setVersionInfo(&objInfo)
+		if _, err = setDecompressedInfo(ctx, za.alloc, ref.Path, &objInfo, ref.EncryptedKey != "", false); err != nil {
+			return minio.ListObjectsInfo{}, err
+		}
+		result.Objects = append(result.Objects, objInfo)
+	}
+	return result, nil
+}
@@ -0,0 +1,307 @@
+package zcn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+	"github.com/minio/minio/internal/logger"
+)
+
+const shareDir = systemDir + "/shares"
+
+// shares holds the auth tickets issued by the gateway.
+var shares *shareStore
+
+// shareInfo is an auth ticket issued for an object or a prefix. The ticket
+// lets ClientID download the shared files with the Züs sdk, when the files are
+// encrypted they are re-encrypted for EncryptionPublicKey by the blobbers.
+type shareInfo struct {
+	ID                  string    `json:"id"`
+	Bucket              string    `json:"bucket"`
+	Object              string    `json:"object,omitempty"` // a prefix when it ends with a slash
+	RemotePath          string    `json:"path"`
+	ClientID            string    `json:"clientId,omitempty"` // empty for a public share
+	EncryptionPublicKey string    `json:"encryptionPublicKey,omitempty"`
+	Created             time.Time `json:"created"`
+	Expiration          time.Time `json:"expiration,omitempty"`
+	AvailableAfter      time.Time `json:"availableAfter,omitempty"`
+}
+
+// expired returns whether the ticket of si is no longer valid at now.
+func (si *shareInfo) expired(now time.Time) bool {
+	return !si.Expiration.IsZero() && !now.Before(si.Expiration)
+}
+
+// issuedShare is returned when a share is created, the only time its ticket
+// is handed out as it is neither stored nor listed.
+type issuedShare struct {
+	shareInfo
+	AuthTicket string `json:"authTicket"`
+}
+
+// shareID identifies the share of remotePath with clientID, a new ticket for
+// them replaces the previous one as they are revoked together.
+func shareID(remotePath, clientID string) string {
+	sum := sha256.Sum256([]byte(remotePath + "\x00" + clientID))
+	return hex.EncodeToString(sum[:16])
+}
+
+func sharePath(id string) string {
+	return path.Join(shareDir, id)
+}
+
+// shareStore keeps one file per share under shareDir, which is repeated in the
+// CustomMeta of the file like the bucket configurations. A share is stored on
+// the allocation of its path.
+type shareStore struct {
+	sync.RWMutex
+	shares map[string]*shareInfo
+}
+
+func newShareStore() *shareStore {
+	return &shareStore{
+		shares: make(map[string]*shareInfo),
+	}
+}
+
+// load reads the shares stored on all allocations.
+func (ss *shareStore) load() error {
+	loaded := make(map[string]*shareInfo)
+	for _, za := range allocations.list() {
+		refs, err := listFiles(za.alloc, shareDir)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			si := &shareInfo{}
+			if err := json.Unmarshal([]byte(ref.CustomMeta), si); err != nil || si.ID == "" {
+				continue
+			}
+			if allocations.forPath(si.RemotePath).id != za.id {
+				continue
+			}
+			loaded[si.ID] = si
+		}
+	}
+
+	ss.Lock()
+	ss.shares = loaded
+	ss.Unlock()
+	return nil
+}
+
+func (ss *shareStore) get(id string) (*shareInfo, bool) {
+	ss.RLock()
+	defer ss.RUnlock()
+	si, ok := ss.shares[id]
+	return si, ok
+}
+
+func (ss *shareStore) put(si *shareInfo) error {
+	data, err := json.Marshal(si)
+	if err != nil {
+		return err
+	}
+	_, exists := ss.get(si.ID)
+	alloc := allocations.forPath(si.RemotePath).alloc
+	if err := putSystemFile(alloc, sharePath(si.ID), data, string(data), exists); err != nil {
+		return err
+	}
+
+	ss.Lock()
+	ss.shares[si.ID] = si
+	ss.Unlock()
+	return nil
+}
+
+func (ss *shareStore) delete(si *shareInfo) error {
+	err := allocations.forPath(si.RemotePath).alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    sharePath(si.ID),
+	}})
+	if err != nil && !isSameRootError(err) && !isPathNoExistError(err) {
+		return err
+	}
+
+	ss.Lock()
+	delete(ss.shares, si.ID)
+	ss.Unlock()
+	return nil
+}
+
+// list returns the shares of bucket below prefix, all buckets when bucket is
+// empty, and of clientID when it is set. Expired shares are deleted instead.
+func (ss *shareStore) list(bucket, prefix, clientID string) []shareInfo {
+	ss.prune(time.Now())
+
+	ss.RLock()
+	defer ss.RUnlock()
+	list := []shareInfo{}
+	for _, si := range ss.shares {
+		if bucket != "" && si.Bucket != bucket {
+			continue
+		}
+		if !strings.HasPrefix(si.Object, prefix) {
+			continue
+		}
+		if clientID != "" && si.ClientID != clientID {
+			continue
+		}
+		list = append(list, *si)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].RemotePath != list[j].RemotePath {
+			return list[i].RemotePath < list[j].RemotePath
+		}
+		return list[i].ClientID < list[j].ClientID
+	})
+	return list
+}
+
+// prune deletes the shares whose tickets expired before now.
+func (ss *shareStore) prune(now time.Time) {
+	var expired []*shareInfo
+	ss.RLock()
+	for _, si := range ss.shares {
+		if si.expired(now) {
+			expired = append(expired, si)
+		}
+	}
+	ss.RUnlock()
+
+	for _, si := range expired {
+		if err := ss.delete(si); err != nil {
+			logger.Error("error deleting expired share %s: %v", si.ID, err)
+		}
+	}
+}
+
+func shareRemotePath(bucket, object string) string {
+	if bucket == rootBucketName {
+		return filepath.Join(rootPath, object)
+	}
+	return filepath.Join(rootPath, bucket, object)
+}
+
+func invalidShareArg(msg string) error {
+	return minio.AdminError{
+		Code:       "XZcnInvalidShare",
+		Message:    msg,
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// parseShareTime reads a time given either as RFC3339 or as a duration from now.
+func parseShareTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// shareObject issues an auth ticket for the object or prefix named by the
+// query of r: bucket, object, clientid, encryptionkey, expiry and
+// availableafter. Times are RFC3339 or a duration such as 72h.
+func (zob *zcnObjects) shareObject(r *http.Request) (*issuedShare, error) {
+	q := r.URL.Query()
+	bucket, object := q.Get("bucket"), q.Get("object")
+	if bucket == "" {
+		return nil, invalidShareArg("bucket is required")
+	}
+	now := time.Now().UTC()
+	expiration, err := parseShareTime(q.Get("expiry"), now)
+	if err != nil {
+		return nil, invalidShareArg("invalid expiry: " + err.Error())
+	}
+	availableAfter, err := parseShareTime(q.Get("availableafter"), now)
+	if err != nil {
+		return nil, invalidShareArg("invalid availableafter: " + err.Error())
+	}
+	if !expiration.IsZero() && (!expiration.After(now) || !expiration.After(availableAfter)) {
+		return nil, invalidShareArg("expiry must be in the future and after availableafter")
+	}
+
+	remotePath := shareRemotePath(bucket, object)
+	if isSystemPath(remotePath) {
+		return nil, minio.ObjectNotFound{Bucket: bucket, Object: object}
+	}
+	alloc := allocations.forBucket(bucket).alloc
+	ref, err := getSingleRegularRef(alloc, remotePath)
+	if err != nil {
+		if isPathNoExistError(err) {
+			return nil, minio.ObjectNotFound{Bucket: bucket, Object: object}
+		}
+		return nil, err
+	}
+	if object != "" && strings.HasSuffix(object, "/") != (ref.Type == dirType) {
+		return nil, invalidShareArg("a prefix must end with a slash")
+	}
+
+	si := &issuedShare{shareInfo: shareInfo{
+		ID:                  shareID(remotePath, q.Get("clientid")),
+		Bucket:              bucket,
+		Object:              object,
+		RemotePath:          remotePath,
+		ClientID:            q.Get("clientid"),
+		EncryptionPublicKey: q.Get("encryptionkey"),
+		Created:             now,
+		Expiration:          expiration,
+		AvailableAfter:      availableAfter,
+	}}
+	var expiry int64
+	if !expiration.IsZero() {
+		expiry = expiration.Unix()
+	}
+	var after *time.Time
+	if !availableAfter.IsZero() {
+		after = &availableAfter
+	}
+	si.AuthTicket, err = alloc.GetAuthTicket(remotePath, path.Base(remotePath), ref.Type, si.ClientID, si.EncryptionPublicKey, expiry, after)
+	if err != nil {
+		return nil, err
+	}
+	if err := shares.put(&si.shareInfo); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// revokeShare revokes the share given by the id query of r, or by its bucket,
+// object and clientid.
+func (zob *zcnObjects) revokeShare(r *http.Request) error {
+	q := r.URL.Query()
+	id := q.Get("id")
+	if id == "" {
+		if q.Get("bucket") == "" {
+			return invalidShareArg("id or bucket is required")
+		}
+		id = shareID(shareRemotePath(q.Get("bucket"), q.Get("object")), q.Get("clientid"))
+	}
+	si, ok := shares.get(id)
+	if !ok {
+		return minio.AdminError{
+			Code:       "XZcnNoSuchShare",
+			Message:    "share " + id + " does not exist",
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	err := allocations.forPath(si.RemotePath).alloc.RevokeShare(si.RemotePath, si.ClientID)
+	if err != nil && !isPathNoExistError(err) {
+		return err
+	}
+	return shares.delete(si)
+}
@@ -0,0 +1,75 @@
+package zcn
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	minio "github.com/minio/minio/cmd"
+)
+
+// minioConfigPrefix holds the server config and its history in
+// minioMetaBucket, which the admin config API reads and writes. They are
+// stored as they are below systemDir of the default allocation.
+const minioConfigPrefix = "config"
+
+func isServerConfig(object string) bool {
+	return strings.HasPrefix(object, minioConfigPrefix+"/")
+}
+
+func serverConfigPath(object string) string {
+	return path.Join(systemDir, object)
+}
+
+func getServerConfigInfo(object string) (minio.ObjectInfo, error) {
+	alloc := allocations.forBucket(minioMetaBucket).alloc
+	objInfo, _, err := getObjectRef(alloc, minioMetaBucket, object, serverConfigPath(object))
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	objInfo.Name = object
+	return *objInfo, nil
+}
+
+func getServerConfig(ctx context.Context, object string, opts minio.ObjectOptions) (*minio.GetObjectReader, error) {
+	alloc := allocations.forBucket(minioMetaBucket).alloc
+	r, objInfo, fCloser, err := getFileReader(ctx, alloc, minioMetaBucket, object, serverConfigPath(object), nil)
+	if err != nil {
+		return nil, err
+	}
+	objInfo.Name = object
+	return minio.NewGetObjectReaderFromReader(r, *objInfo, opts, fCloser)
+}
+
+// putServerConfig writes the file as an update when it exists already.
+func putServerConfig(object string, r *minio.PutObjReader) (minio.ObjectInfo, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	alloc := allocations.forBucket(minioMetaBucket).alloc
+	if err = putSystemFile(alloc, serverConfigPath(object), data, "", false); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return metaObjectInfo(object, data), nil
+}
+
+// deleteServerConfig deletes the file or, as the config history is cleared,
+// the directory of object.
+func deleteServerConfig(object string) (minio.ObjectInfo, error) {
+	alloc := allocations.forBucket(minioMetaBucket).alloc
+	err := alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    serverConfigPath(object),
+	}})
+	if err != nil && !isSameRootError(err) {
+		if isPathNoExistError(err) {
+			return minio.ObjectInfo{}, minio.ObjectNotFound{Bucket: minioMetaBucket, Object: object}
+		}
+		return minio.ObjectInfo{}, err
+	}
+	return minio.ObjectInfo{Bucket: minioMetaBucket, Name: object}, nil
+}
@@ -0,0 +1,42 @@
+package zcn
+
+import (
+	"context"
+
+	"github.com/minio/minio-go/v7/pkg/tags"
+	minio "github.com/minio/minio/cmd"
+	xhttp "github.com/minio/minio/internal/http"
+)
+
+// IsTaggingSupported returns true, tags are kept with the object metadata.
+func (zob *zcnObjects) IsTaggingSupported() bool {
+	return true
+}
+
+// PutObjectTags replaces the tags of an object. They are kept with its user
+// metadata, tags set after the upload are stored in the sidecar of the object
+// and its data is left as is.
+func (zob *zcnObjects) PutObjectTags(ctx context.Context, bucket, object string, tags string, opts minio.ObjectOptions) (minio.ObjectInfo, error) {
+	return zob.updateObjectMeta(ctx, bucket, object, opts, false, func(userDefined map[string]string, _ *string) error {
+		if tags != "" {
+			userDefined[xhttp.AmzObjectTagging] = tags
+		} else {
+			delete(userDefined, xhttp.AmzObjectTagging)
+		}
+		return nil
+	})
+}
+
+// GetObjectTags returns the tags of an object.
+func (zob *zcnObjects) GetObjectTags(ctx context.Context, bucket, object string, opts minio.ObjectOptions) (*tags.Tags, error) {
+	objInfo, err := zob.GetObjectInfo(ctx, bucket, object, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tags.ParseObjectTags(objInfo.UserTags)
+}
+
+// DeleteObjectTags removes the tags of an object.
+func (zob *zcnObjects) DeleteObjectTags(ctx context.Context, bucket, object string, opts minio.ObjectOptions) (minio.ObjectInfo, error) {
+	return zob.PutObjectTags(ctx, bucket, object, "", opts)
+}
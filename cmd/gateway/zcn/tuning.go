@@ -0,0 +1,92 @@
+package zcn
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/minio/minio/internal/config"
+	zcnconfig "github.com/minio/minio/internal/config/zcn"
+)
+
+// tuning holds the settings of the zcn config sub-system, which override
+// those of zs3server.json while the gateway runs.
+var (
+	tuningMu sync.RWMutex
+	tuning   zcnconfig.Config
+)
+
+// currentOptions returns the server options with the settings of the zcn
+// config sub-system applied.
+func currentOptions() serverOptions {
+	tuningMu.RLock()
+	defer tuningMu.RUnlock()
+	opts := serverConfig
+	if tuning.MaxBatchSize > 0 {
+		opts.MaxBatchSize = tuning.MaxBatchSize
+	}
+	if tuning.BatchWaitTime > 0 {
+		opts.BatchWaitTime = int(tuning.BatchWaitTime / time.Millisecond)
+		if opts.BatchWaitTime == 0 {
+			opts.BatchWaitTime = 1
+		}
+	}
+	if tuning.BatchWorkers > 0 {
+		opts.BatchWorkers = tuning.BatchWorkers
+	}
+	if tuning.UploadWorkers > 0 {
+		opts.UploadWorkers = tuning.UploadWorkers
+	}
+	if tuning.DownloadWorkers > 0 {
+		opts.DownloadWorkers = tuning.DownloadWorkers
+	}
+	if tuning.MaxConcurrentRequests > 0 {
+		opts.MaxConcurrentRequests = tuning.MaxConcurrentRequests
+	}
+	if tuning.Encrypt != nil {
+		opts.Encrypt = *tuning.Encrypt
+	}
+	if tuning.Compress != nil {
+		opts.Compress = *tuning.Compress
+	}
+	return opts
+}
+
+// applySDKOptions sets the transfer settings of the sdk, they apply to the
+// uploads and downloads started afterwards.
+func applySDKOptions(opts serverOptions) {
+	if opts.UploadWorkers > 0 {
+		sdk.SetHighModeWorkers(opts.UploadWorkers)
+	}
+	if opts.DownloadWorkers > 0 {
+		sdk.SetDownloadWorkerCount(opts.DownloadWorkers)
+	}
+	sdk.BatchSize = opts.MaxConcurrentRequests
+	sdk.SetMultiOpBatchSize(opts.MaxBatchSize)
+}
+
+// SetGatewayConfig applies the zcn config sub-system. The batch uploaders are
+// resized without dropping the uploads they queued and the sdk settings apply
+// to the next transfers.
+func (zob *zcnObjects) SetGatewayConfig(ctx context.Context, kvs config.KVS) error {
+	cfg, err := zcnconfig.LookupConfig(kvs)
+	if err != nil {
+		return err
+	}
+	tuningMu.Lock()
+	tuning = cfg
+	tuningMu.Unlock()
+
+	opts := currentOptions()
+	applySDKOptions(opts)
+	allocations.setDefaultUploads(opts.Encrypt, opts.Compress)
+	for _, za := range allocations.list() {
+		za.batch.resize(za.options.batchSettings())
+	}
+	log.Println("gateway tuning applied: max batch size", opts.MaxBatchSize, "batch wait time", opts.BatchWaitTime, "batch workers", opts.BatchWorkers,
+		"upload workers", opts.UploadWorkers, "download workers", opts.DownloadWorkers, "max concurrent requests", opts.MaxConcurrentRequests,
+		"encrypt", opts.Encrypt, "compress", opts.Compress)
+	return nil
+}
@@ -0,0 +1,679 @@
+package zcn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/google/uuid"
+	minio "github.com/minio/minio/cmd"
+	"github.com/minio/minio/internal/bucket/versioning"
+)
+
+const (
+	// versionsDir mirrors the object paths of the allocation. Each noncurrent
+	// version of an object and each delete marker is kept in its own directory
+	// <versionsDir>/<object path>/<mod time in ns>.<version id>/.
+	versionsDir = systemDir + "/versions"
+
+	bucketVersioningConfigFile = "versioning.xml"
+
+	zcnVersionIDKey    = minio.ReservedMetadataPrefix + "Zcn-Version-Id"
+	zcnModTimeKey      = minio.ReservedMetadataPrefix + "Zcn-Mod-Time"
+	zcnDeleteMarkerKey = minio.ReservedMetadataPrefix + "Zcn-Delete-Marker"
+)
+
+// objectVersion is a version of an object, either the object itself or one
+// kept under versionsDir.
+type objectVersion struct {
+	remotePath   string // path of the object
+	refPath      string // path of the version, remotePath for the current version
+	versionID    string
+	modTime      time.Time
+	deleteMarker bool
+	ref          sdk.ORef
+}
+
+func (v *objectVersion) isCurrent() bool {
+	return v.refPath == v.remotePath
+}
+
+func (v *objectVersion) objectInfo(bucket, object string, isLatest bool) minio.ObjectInfo {
+	objInfo := minio.ObjectInfo{
+		Bucket:       bucket,
+		Name:         object,
+		ModTime:      v.modTime,
+		VersionID:    v.versionID,
+		IsLatest:     isLatest,
+		DeleteMarker: v.deleteMarker,
+		StorageClass: "STANDARD",
+	}
+	if v.deleteMarker {
+		return objInfo
+	}
+	var userDefined map[string]string
+	if v.ref.CustomMeta != "" {
+		_ = json.Unmarshal([]byte(v.ref.CustomMeta), &userDefined)
+	}
+	objInfo.Size = v.ref.ActualFileSize
+	objInfo.ETag = v.ref.ActualFileHash
+	objInfo.ContentType = v.ref.MimeType
+	objInfo.UserDefined = userDefined
+	setMetaInfo(&objInfo)
+	setEncryptionInfo(&objInfo, v.ref.EncryptedKey != "")
+	return objInfo
+}
+
+func versionEntryPath(remotePath, versionID string, modTime time.Time) string {
+	versionDir := fmt.Sprintf("%019d.%s", modTime.UnixNano(), versionID)
+	return path.Join(versionsDir, remotePath, versionDir, path.Base(remotePath))
+}
+
+// parseVersionRef returns the version kept in ref, a file below versionsDir.
+func parseVersionRef(ref sdk.ORef) (objectVersion, bool) {
+	if !strings.HasPrefix(ref.Path, versionsDir+"/") {
+		return objectVersion{}, false
+	}
+	versionDir := path.Dir(strings.TrimPrefix(ref.Path, versionsDir))
+	nanos, versionID, ok := strings.Cut(path.Base(versionDir), ".")
+	if !ok {
+		return objectVersion{}, false
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return objectVersion{}, false
+	}
+	var meta map[string]string
+	if ref.CustomMeta != "" {
+		_ = json.Unmarshal([]byte(ref.CustomMeta), &meta)
+	}
+	return objectVersion{
+		remotePath:   path.Dir(versionDir),
+		refPath:      ref.Path,
+		versionID:    versionID,
+		modTime:      time.Unix(0, n).UTC(),
+		deleteMarker: meta[zcnDeleteMarkerKey] == "true",
+		ref:          ref,
+	}, true
+}
+
+// currentVersion returns the version of the object ref at remotePath. Objects
+// written while versioning was not enabled are the null version.
+func currentVersion(remotePath string, ref *sdk.ORef) objectVersion {
+	v := objectVersion{
+		remotePath: remotePath,
+		refPath:    remotePath,
+		versionID:  nullVersionID,
+		modTime:    ref.UpdatedAt.ToTime(),
+		ref:        *ref,
+	}
+	var meta map[string]string
+	if ref.CustomMeta != "" {
+		_ = json.Unmarshal([]byte(ref.CustomMeta), &meta)
+	}
+	if versionID := meta[zcnVersionIDKey]; versionID != "" {
+		v.versionID = versionID
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, meta[zcnModTimeKey]); err == nil {
+		v.modTime = modTime
+	}
+	return v
+}
+
+// setVersionInfo sets the version recorded in the metadata of an object.
+func setVersionInfo(objInfo *minio.ObjectInfo) {
+	if versionID := objInfo.UserDefined[zcnVersionIDKey]; versionID != "" {
+		objInfo.VersionID = versionID
+		objInfo.IsLatest = true
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, objInfo.UserDefined[zcnModTimeKey]); err == nil {
+		objInfo.ModTime = modTime
+	}
+}
+
+// versionMeta returns a copy of userDefined carrying the version of a new
+// object along with its version id.
+func versionMeta(userDefined map[string]string, versioned bool, modTime time.Time) (map[string]string, string) {
+	meta := make(map[string]string, len(userDefined)+2)
+	for k, v := range userDefined {
+		meta[k] = v
+	}
+	versionID := nullVersionID
+	if versioned {
+		versionID = uuid.New().String()
+		meta[zcnVersionIDKey] = versionID
+	}
+	meta[zcnModTimeKey] = modTime.UTC().Format(time.RFC3339Nano)
+	return meta, versionID
+}
+
+func sortVersions(versions []objectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].modTime.After(versions[j].modTime)
+	})
+}
+
+func (zob *zcnObjects) isVersioningConfigured(bucket string) bool {
+	_, ok := bucketConfigs.get(bucket, bucketVersioningConfigFile)
+	return ok
+}
+
+// getCurrentRef returns the ref of the object at remotePath, nil if there is none.
+func (zob *zcnObjects) getCurrentRef(remotePath string) (*sdk.ORef, error) {
+	alloc := allocations.forPath(remotePath).alloc
+	ref, err := getSingleRegularRef(alloc, remotePath)
+	if err != nil {
+		if isPathNoExistError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if ref.Type != fileType {
+		return nil, nil
+	}
+	return ref, nil
+}
+
+// listObjectVersions returns the versions of the object at remotePath newest
+// first, starting with current when the object exists.
+func (zob *zcnObjects) listObjectVersions(remotePath string, current *sdk.ORef) ([]objectVersion, error) {
+	alloc := allocations.forPath(remotePath).alloc
+	refs, err := listFiles(alloc, path.Join(versionsDir, remotePath))
+	if err != nil {
+		return nil, err
+	}
+	var versions []objectVersion
+	if current != nil {
+		versions = append(versions, currentVersion(remotePath, current))
+	}
+	archived := len(versions)
+	for _, ref := range refs {
+		v, ok := parseVersionRef(ref)
+		if !ok || v.remotePath != remotePath {
+			continue
+		}
+		// An overwrite that did not complete leaves behind a copy of the
+		// version that is still current.
+		if archived > 0 && versions[0].versionID == v.versionID {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sortVersions(versions[archived:])
+	return versions, nil
+}
+
+// getObjectVersion returns the version versionID of the object at remotePath
+// and whether it is the latest version.
+func (zob *zcnObjects) getObjectVersion(bucket, object, remotePath, versionID string) (objectVersion, bool, error) {
+	ref, err := zob.getCurrentRef(remotePath)
+	if err != nil {
+		return objectVersion{}, false, err
+	}
+	if ref != nil {
+		if v := currentVersion(remotePath, ref); v.versionID == versionID {
+			return v, true, nil
+		}
+	}
+	versions, err := zob.listObjectVersions(remotePath, ref)
+	if err != nil {
+		return objectVersion{}, false, err
+	}
+	for i, v := range versions {
+		if v.versionID == versionID {
+			return v, i == 0, nil
+		}
+	}
+	return objectVersion{}, false, minio.VersionNotFound{Bucket: bucket, Object: object, VersionID: versionID}
+}
+
+func (zob *zcnObjects) getObjectVersionInfo(ctx context.Context, bucket, object, remotePath, versionID string) (minio.ObjectInfo, error) {
+	alloc := allocations.forBucket(bucket).alloc
+	v, isLatest, err := zob.getObjectVersion(bucket, object, remotePath, versionID)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	objInfo := v.objectInfo(bucket, object, isLatest)
+	if v.deleteMarker {
+		return objInfo, minio.MethodNotAllowed{Bucket: bucket, Object: object}
+	}
+	if _, err = setDecompressedInfo(ctx, alloc, v.refPath, &objInfo, v.ref.EncryptedKey != "", true); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return objInfo, nil
+}
+
+// objectNotFound returns the error for a missing object along with its
+// latest version when that is a delete marker.
+func (zob *zcnObjects) objectNotFound(bucket, object, remotePath string) (minio.ObjectInfo, error) {
+	notFound := minio.ObjectNotFound{Bucket: bucket, Object: object}
+	if !zob.isVersioningConfigured(bucket) {
+		return minio.ObjectInfo{}, notFound
+	}
+	versions, err := zob.listObjectVersions(remotePath, nil)
+	if err != nil || len(versions) == 0 || !versions[0].deleteMarker {
+		return minio.ObjectInfo{}, notFound
+	}
+	return versions[0].objectInfo(bucket, object, true), notFound
+}
+
+// archiveCurrent keeps the object ref at remotePath as a noncurrent version
+// before it is overwritten or deleted. While versioning is suspended there is
+// only a single null version, which is replaced rather than kept.
+func (zob *zcnObjects) archiveCurrent(remotePath string, ref *sdk.ORef, versioned bool) error {
+	alloc := allocations.forPath(remotePath).alloc
+	archived, err := zob.listObjectVersions(remotePath, nil)
+	if err != nil {
+		return err
+	}
+	var ops []sdk.OperationRequest
+	if !versioned {
+		for _, v := range archived {
+			if v.versionID == nullVersionID {
+				ops = append(ops, sdk.OperationRequest{
+					OperationType: constants.FileOperationDelete,
+					RemotePath:    path.Dir(v.refPath),
+				})
+			}
+		}
+	}
+	var entryPath string
+	if ref != nil && ref.Type == fileType {
+		cur := currentVersion(remotePath, ref)
+		isArchived := false
+		for _, v := range archived {
+			if v.versionID == cur.versionID {
+				isArchived = true
+				break
+			}
+		}
+		if !isArchived && (versioned || cur.versionID != nullVersionID) {
+			entryPath = versionEntryPath(remotePath, cur.versionID, cur.modTime)
+			ops = append(ops, sdk.OperationRequest{
+				OperationType: constants.FileOperationCopy,
+				RemotePath:    remotePath,
+				DestPath:      entryPath,
+			})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	err = alloc.DoMultiOperation(ops)
+	if err != nil && !isSameRootError(err) {
+		return err
+	}
+	if entryPath != "" {
+		return sidecars.copy(remotePath, entryPath)
+	}
+	return nil
+}
+
+// putDeleteMarker keeps the object ref at remotePath, if any, as a noncurrent
+// version and makes a new delete marker the latest version of the object.
+func (zob *zcnObjects) putDeleteMarker(bucket, object, remotePath string, ref *sdk.ORef, versioned bool) (minio.ObjectInfo, error) {
+	alloc := allocations.forBucket(bucket).alloc
+	if err := zob.archiveCurrent(remotePath, ref, versioned); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if ref != nil {
+		err := alloc.DoMultiOperation([]sdk.OperationRequest{{
+			OperationType: constants.FileOperationDelete,
+			RemotePath:    remotePath,
+		}})
+		if err != nil && !isSameRootError(err) {
+			return minio.ObjectInfo{}, err
+		}
+		sidecars.remove(remotePath)
+	}
+
+	modTime := time.Now().UTC()
+	meta, versionID := versionMeta(nil, versioned, modTime)
+	meta[zcnDeleteMarkerKey] = "true"
+	data, _ := json.Marshal(meta)
+	if err := putSystemFile(alloc, versionEntryPath(remotePath, versionID, modTime), data, string(data), false); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return minio.ObjectInfo{
+		Bucket:       bucket,
+		Name:         object,
+		ModTime:      modTime,
+		VersionID:    versionID,
+		DeleteMarker: true,
+	}, nil
+}
+
+// deleteObjectVersion permanently removes the version versionID of the object
+// at remotePath. When the latest version goes away and the newest remaining
+// one is not a delete marker, that version becomes the object again.
+func (zob *zcnObjects) deleteObjectVersion(bucket, object, remotePath, versionID string) (minio.ObjectInfo, error) {
+	alloc := allocations.forBucket(bucket).alloc
+	ref, err := zob.getCurrentRef(remotePath)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	versions, err := zob.listObjectVersions(remotePath, ref)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	idx := -1
+	for i, v := range versions {
+		if v.versionID == versionID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return minio.ObjectInfo{}, minio.VersionNotFound{Bucket: bucket, Object: object, VersionID: versionID}
+	}
+
+	v := versions[idx]
+	deletePath := path.Dir(v.refPath)
+	if v.isCurrent() {
+		deletePath = remotePath
+	}
+	err = alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    deletePath,
+	}})
+	if err != nil && !isSameRootError(err) {
+		return minio.ObjectInfo{}, err
+	}
+	if v.isCurrent() {
+		sidecars.remove(remotePath)
+	} else {
+		sidecars.remove(v.refPath)
+	}
+
+	remaining := append(versions[:idx:idx], versions[idx+1:]...)
+	if len(remaining) > 0 && !remaining[0].isCurrent() && !remaining[0].deleteMarker {
+		if err = zob.restoreVersion(remaining[0]); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	}
+	return minio.ObjectInfo{
+		Bucket:       bucket,
+		Name:         object,
+		ModTime:      v.modTime,
+		VersionID:    versionID,
+		DeleteMarker: v.deleteMarker,
+	}, nil
+}
+
+// restoreVersion makes the noncurrent version v the object again.
+func (zob *zcnObjects) restoreVersion(v objectVersion) error {
+	alloc := allocations.forPath(v.remotePath).alloc
+	err := alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationCopy,
+		RemotePath:    v.refPath,
+		DestPath:      v.remotePath,
+	}})
+	if err != nil && !isSameRootError(err) {
+		return err
+	}
+	if err = sidecars.copy(v.refPath, v.remotePath); err != nil {
+		return err
+	}
+	err = alloc.DoMultiOperation([]sdk.OperationRequest{{
+		OperationType: constants.FileOperationDelete,
+		RemotePath:    path.Dir(v.refPath),
+	}})
+	if err != nil && !isSameRootError(err) {
+		return err
+	}
+	sidecars.remove(v.refPath)
+	return nil
+}
+
+// SetBucketVersioning stores the versioning configuration of bucket on the allocation.
+func (zob *zcnObjects) SetBucketVersioning(ctx context.Context, bucket string, v *versioning.Versioning) error {
+	if err := zob.health.writable(bucket); err != nil {
+		return err
+	}
+	if _, err := zob.GetBucketInfo(ctx, bucket); err != nil {
+		return err
+	}
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucketConfigs.put(bucket, bucketVersioningConfigFile, data)
+}
+
+// GetBucketVersioning returns the versioning configuration of bucket, buckets
+// that never had versioning configured are unversioned.
+func (zob *zcnObjects) GetBucketVersioning(ctx context.Context, bucket string) (*versioning.Versioning, error) {
+	data, ok := bucketConfigs.get(bucket, bucketVersioningConfigFile)
+	if !ok {
+		return &versioning.Versioning{XMLNS: "http://s3.amazonaws.com/doc/2006-03-01/"}, nil
+	}
+	return versioning.ParseConfig(bytes.NewReader(data))
+}
+
+// refPager pages through refs of the allocation with fetch, which returns
+// the refs following offset along with the offset of the next page and whether
+// there may be more.
+type refPager struct {
+	fetch  func(offset string) ([]sdk.ORef, string, bool, error)
+	offset string
+	refs   []sdk.ORef
+	done   bool
+}
+
+// peek returns the next ref, nil once all were read.
+func (p *refPager) peek() (*sdk.ORef, error) {
+	for len(p.refs) == 0 && !p.done {
+		refs, offset, more, err := p.fetch(p.offset)
+		if err != nil {
+			if isPathNoExistError(err) {
+				p.done = true
+				break
+			}
+			return nil, err
+		}
+		p.refs, p.offset, p.done = refs, offset, !more || len(refs) == 0
+	}
+	if len(p.refs) == 0 {
+		return nil, nil
+	}
+	return &p.refs[0], nil
+}
+
+func (p *refPager) pop() {
+	p.refs = p.refs[1:]
+}
+
+// versionLister merges the objects below a path with their noncurrent
+// versions, reading both a page at a time.
+type versionLister struct {
+	bucket   string
+	current  *refPager
+	archived *refPager
+	// group holds the noncurrent versions of the next object read from archived.
+	group []objectVersion
+}
+
+// nextGroup reads the noncurrent versions of the next object kept in archived.
+func (vl *versionLister) nextGroup() error {
+	vl.group = nil
+	for {
+		ref, err := vl.archived.peek()
+		if err != nil || ref == nil {
+			return err
+		}
+		v, ok := parseVersionRef(*ref)
+		if ok && len(vl.group) > 0 && v.remotePath != vl.group[0].remotePath {
+			return nil
+		}
+		vl.archived.pop()
+		if ok {
+			vl.group = append(vl.group, v)
+		}
+	}
+}
+
+// next returns the name and the versions of the next object, newest first,
+// and an empty name once all objects were read.
+func (vl *versionLister) next() (string, []objectVersion, error) {
+	if len(vl.group) == 0 {
+		if err := vl.nextGroup(); err != nil {
+			return "", nil, err
+		}
+	}
+	cur, err := vl.current.peek()
+	if err != nil {
+		return "", nil, err
+	}
+	var curName, archivedName string
+	if cur != nil {
+		curName = getRelativePathOfObj(cur.Path, vl.bucket)
+	}
+	if len(vl.group) > 0 {
+		archivedName = getRelativePathOfObj(vl.group[0].remotePath, vl.bucket)
+	}
+
+	var versions []objectVersion
+	name := curName
+	switch {
+	case cur == nil && len(vl.group) == 0:
+		return "", nil, nil
+	case cur != nil && (len(vl.group) == 0 || curName < archivedName):
+		versions = []objectVersion{currentVersion(cur.Path, cur)}
+		vl.current.pop()
+	case cur == nil || archivedName < curName:
+		name, versions = archivedName, vl.group
+		vl.group = nil
+	default:
+		versions = []objectVersion{currentVersion(cur.Path, cur)}
+		vl.current.pop()
+		for _, v := range vl.group {
+			// An overwrite that did not complete leaves behind a copy of the
+			// version that is still current.
+			if v.versionID != versions[0].versionID {
+				versions = append(versions, v)
+			}
+		}
+		vl.group = nil
+	}
+	start := 0
+	if versions[0].isCurrent() {
+		start = 1
+	}
+	sortVersions(versions[start:])
+	return name, versions, nil
+}
+
+// ListObjectVersions lists the versions of the objects in bucket. The objects
+// below the prefix and their noncurrent versions are read a page at a time
+// from the marker on, until maxKeys entries are listed.
+func (zob *zcnObjects) ListObjectVersions(ctx context.Context, bucket, prefix, marker, versionMarker, delimiter string, maxKeys int) (result minio.ListObjectVersionsInfo, err error) {
+	if maxKeys <= 0 {
+		return result, nil
+	}
+	alloc := allocations.forBucket(bucket).alloc
+	var bucketPath string
+	if bucket == rootBucketName {
+		bucketPath = rootPath
+	} else {
+		bucketPath = path.Join(rootPath, bucket)
+	}
+	listPath := path.Join(bucketPath, prefix[:strings.LastIndex(prefix, "/")+1])
+	archivePath := path.Join(versionsDir, listPath)
+
+	vl := &versionLister{
+		bucket: bucket,
+		current: &refPager{fetch: func(offset string) ([]sdk.ORef, string, bool, error) {
+			refs, isTruncated, next, _, err := listRegularRefs(alloc, listPath, offset, fileType, pageLimit, false)
+			return refs, next, isTruncated, err
+		}},
+		archived: &refPager{fetch: func(offset string) ([]sdk.ORef, string, bool, error) {
+			oResult, err := getRegularRefs(alloc, archivePath, offset, fileType, pageLimit)
+			if err != nil {
+				return nil, "", false, err
+			}
+			return oResult.Refs, oResult.OffsetPath, len(oResult.Refs) == pageLimit, nil
+		}},
+	}
+	if markerPath := path.Join(bucketPath, marker); marker != "" && strings.HasPrefix(markerPath, listPath+"/") {
+		// Both listings start after the marker, the noncurrent versions of
+		// the marker are below its path and still listed.
+		vl.current.offset = strings.TrimPrefix(markerPath, listPath+"/")
+		vl.archived.offset = path.Join(versionsDir, markerPath)
+		if versionMarker != "" {
+			ref, err := zob.getCurrentRef(markerPath)
+			if err != nil {
+				return result, err
+			}
+			if ref != nil {
+				vl.current.refs = []sdk.ORef{*ref}
+			}
+		}
+	}
+
+	count := 0
+	prefixes := make(map[string]bool)
+	for {
+		name, versions, err := vl.next()
+		if err != nil {
+			return minio.ListObjectVersionsInfo{}, err
+		}
+		if name == "" {
+			break
+		}
+		if !strings.HasPrefix(name, prefix) || name < marker || (name == marker && versionMarker == "") {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := name[:len(prefix)+i+len(delimiter)]
+				if prefixes[commonPrefix] || commonPrefix <= marker {
+					continue
+				}
+				if count == maxKeys {
+					result.IsTruncated = true
+					return result, nil
+				}
+				prefixes[commonPrefix] = true
+				result.Prefixes = append(result.Prefixes, commonPrefix)
+				result.NextMarker = commonPrefix
+				result.NextVersionIDMarker = ""
+				count++
+				continue
+			}
+		}
+
+		skip := name == marker
+		for i, v := range versions {
+			if skip {
+				skip = v.versionID != versionMarker
+				continue
+			}
+			if count == maxKeys {
+				result.IsTruncated = true
+				return result, nil
+			}
+			objInfo := v.objectInfo(bucket, name, i == 0)
+			if !v.deleteMarker {
+				if _, err = setDecompressedInfo(ctx, alloc, v.refPath, &objInfo, v.ref.EncryptedKey != "", false); err != nil {
+					return minio.ListObjectVersionsInfo{}, err
+				}
+			}
+			result.Objects = append(result.Objects, objInfo)
+			result.NextMarker = name
+			result.NextVersionIDMarker = v.versionID
+			count++
+		}
+	}
+	result.NextMarker = ""
+	result.NextVersionIDMarker = ""
+	return result, nil
+}
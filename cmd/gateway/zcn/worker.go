@@ -4,24 +4,37 @@ import (
 	"context"
 	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/0chain/gosdk/zboxcore/sdk"
 )
 
-var (
-	batchUploadChan chan sdk.OperationRequest
-	workerChan      chan []sdk.OperationRequest
-)
-
-func IntiBatchUploadWorkers(ctx context.Context, alloc *sdk.Allocation, waitTime, maxOperations, maxWorkers int) {
+// batchUploader collects the uploads to an allocation into batches of up to
+// maxOperations, which are committed by maxWorkers workers. The settings can
+// be changed with resize while uploads are queued.
+type batchUploader struct {
+	ctx        context.Context
+	alloc      *sdk.Allocation
+	uploadChan chan sdk.OperationRequest
+	workerChan chan []sdk.OperationRequest
 
-	batchUploadChan = make(chan sdk.OperationRequest, maxOperations*maxWorkers)
-	workerChan = make(chan []sdk.OperationRequest, maxWorkers)
+	mu            sync.Mutex
+	waitTime      time.Duration
+	maxOperations int
+	workers       []chan struct{} // closed to stop the worker
+}
 
-	for i := 0; i < maxWorkers; i++ {
-		go batchUploadWorker(ctx, alloc, workerChan)
+func startBatchUploader(ctx context.Context, alloc *sdk.Allocation, waitTime, maxOperations, maxWorkers int) *batchUploader {
+	bu := &batchUploader{
+		ctx:        ctx,
+		alloc:      alloc,
+		uploadChan: make(chan sdk.OperationRequest, maxOperations*maxWorkers),
+		workerChan: make(chan []sdk.OperationRequest, maxWorkers),
 	}
+	bu.resize(waitTime, maxOperations, maxWorkers)
+	batchUploadChan, workerChan := bu.uploadChan, bu.workerChan
+
 	opRequest := make([]sdk.OperationRequest, 0, 5)
 	iterations := 0
 	go func() {
@@ -30,9 +43,10 @@ func IntiBatchUploadWorkers(ctx context.Context, alloc *sdk.Allocation, waitTime
 			case <-ctx.Done():
 				return
 			case op := <-batchUploadChan:
+				waitTime, maxOperations := bu.settings()
 				// process the batch upload or wait for more operations
 				opRequest = append(opRequest, op)
-				if len(opRequest) == maxOperations || iterations > 2 {
+				if len(opRequest) >= maxOperations || iterations > 2 {
 					log.Println("process batch for time condition")
 					workerChan <- opRequest
 					opRequest = make([]sdk.OperationRequest, 0, 5)
@@ -43,7 +57,7 @@ func IntiBatchUploadWorkers(ctx context.Context, alloc *sdk.Allocation, waitTime
 					// wait for more operations
 					log.Println("waiting for more operations: ", len(opRequest))
 					iterations++
-					time.Sleep(time.Duration(waitTime) * time.Millisecond)
+					time.Sleep(waitTime)
 				} else {
 					// consume more operations
 					continue
@@ -58,17 +72,50 @@ func IntiBatchUploadWorkers(ctx context.Context, alloc *sdk.Allocation, waitTime
 			}
 		}
 	}()
+	return bu
+}
 
+func (bu *batchUploader) settings() (time.Duration, int) {
+	bu.mu.Lock()
+	defer bu.mu.Unlock()
+	return bu.waitTime, bu.maxOperations
 }
 
-func batchUploadWorker(ctx context.Context, alloc *sdk.Allocation, opsChan chan []sdk.OperationRequest) {
+// resize changes the batch settings, at least one worker is kept. Workers
+// beyond maxWorkers stop once they committed their current batch, the
+// batches and uploads still queued are committed by the remaining workers.
+// The queues keep their size, uploads wait when they are full.
+func (bu *batchUploader) resize(waitTime, maxOperations, maxWorkers int) {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	bu.mu.Lock()
+	defer bu.mu.Unlock()
+	bu.waitTime = time.Duration(waitTime) * time.Millisecond
+	bu.maxOperations = maxOperations
+	for len(bu.workers) < maxWorkers {
+		stop := make(chan struct{})
+		bu.workers = append(bu.workers, stop)
+		go batchUploadWorker(bu.ctx, bu.alloc, bu.workerChan, stop)
+	}
+	for len(bu.workers) > maxWorkers {
+		last := len(bu.workers) - 1
+		close(bu.workers[last])
+		bu.workers = bu.workers[:last]
+	}
+}
+
+func batchUploadWorker(ctx context.Context, alloc *sdk.Allocation, opsChan chan []sdk.OperationRequest, stop <-chan struct{}) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-stop:
+			return
 		case ops := <-opsChan:
 			// process the batch upload or wait for more operations
 			log.Println("processing batch upload: ", len(ops))
+			countBatch(len(ops))
 			err := alloc.DoMultiOperation(ops)
 			if err != nil {
 				if isSameRootError(err) {
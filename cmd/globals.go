@@ -142,6 +142,9 @@ var (
 	// Name of gateway server, e.g S3, GCS, Azure, etc
 	globalGatewayName = ""
 
+	// Implementation of the running gateway server.
+	globalGateway Gateway
+
 	// This flag is set to 'true' by default
 	globalBrowserEnabled = true
 
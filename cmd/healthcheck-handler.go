@@ -34,11 +34,6 @@ func shouldProxy() bool {
 
 // ClusterCheckHandler returns if the server is ready for requests.
 func ClusterCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if globalIsGateway {
-		writeResponse(w, http.StatusOK, nil, mimeNone)
-		return
-	}
-
 	ctx := newContext(r, w, "ClusterCheckHandler")
 
 	if shouldProxy() {
@@ -77,11 +72,6 @@ func ClusterCheckHandler(w http.ResponseWriter, r *http.Request) {
 
 // ClusterReadCheckHandler returns if the server is ready for requests.
 func ClusterReadCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if globalIsGateway {
-		writeResponse(w, http.StatusOK, nil, mimeNone)
-		return
-	}
-
 	ctx := newContext(r, w, "ClusterReadCheckHandler")
 
 	if shouldProxy() {
@@ -104,8 +94,13 @@ func ClusterReadCheckHandler(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, http.StatusOK, nil, mimeNone)
 }
 
-// ReadinessCheckHandler Checks if the process is up. Always returns success.
+// ReadinessCheckHandler Checks if the process is up. Gateways are not ready
+// while their backend cannot serve reads.
 func ReadinessCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if objLayer := newObjectLayerFn(); globalIsGateway && objLayer != nil && !objLayer.ReadHealth(r.Context()) {
+		writeResponse(w, http.StatusServiceUnavailable, nil, mimeNone)
+		return
+	}
 	LivenessCheckHandler(w, r)
 }
 
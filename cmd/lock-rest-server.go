@@ -224,7 +224,7 @@ func lockMaintenance(ctx context.Context) {
 		break
 	}
 
-	if _, ok := objAPI.(*erasureServerPools); !ok {
+	if _, ok := objAPI.(*erasureServerPools); !ok && !IsGatewayDistributed() {
 		return
 	}
 
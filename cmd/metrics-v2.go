@@ -60,6 +60,7 @@ func init() {
 		getS3TTFBMetric(),
 		getILMNodeMetrics(),
 		getScannerNodeMetrics(),
+		getGatewayBackendMetrics(),
 	}
 
 	allMetricsGroups := func() (allMetrics []*MetricsGroup) {
@@ -75,6 +76,7 @@ func init() {
 		getNetworkMetrics(),
 		getMinioVersionMetrics(),
 		getS3TTFBMetric(),
+		getGatewayBackendMetrics(),
 	})
 
 	clusterCollector = newMinioClusterCollector(allMetricsGroups)
@@ -89,6 +91,7 @@ type MetricSubsystem string
 const (
 	bucketMetricNamespace    MetricNamespace = "minio_bucket"
 	clusterMetricNamespace   MetricNamespace = "minio_cluster"
+	gatewayMetricNamespace   MetricNamespace = "minio_gateway"
 	healMetricNamespace      MetricNamespace = "minio_heal"
 	interNodeMetricNamespace MetricNamespace = "minio_inter_node"
 	nodeMetricNamespace      MetricNamespace = "minio_node"
@@ -175,6 +178,10 @@ const (
 	expiryPendingTasks     MetricName = "expiry_pending_tasks"
 	transitionPendingTasks MetricName = "transition_pending_tasks"
 	transitionActiveTasks  MetricName = "transition_active_tasks"
+
+	writeBackPending       MetricName = "writeback_pending_total"
+	writeBackFailed        MetricName = "writeback_failed_total"
+	writeBackOldestPending MetricName = "writeback_oldest_pending_seconds"
 )
 
 const (
@@ -685,6 +692,36 @@ func getCacheSentBytesMD() MetricDescription {
 	}
 }
 
+func getCacheWriteBackPendingMD() MetricDescription {
+	return MetricDescription{
+		Namespace: minioNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      writeBackPending,
+		Help:      "Number of objects on the cache disk waiting to be committed to the backend",
+		Type:      gaugeMetric,
+	}
+}
+
+func getCacheWriteBackFailedMD() MetricDescription {
+	return MetricDescription{
+		Namespace: minioNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      writeBackFailed,
+		Help:      "Number of objects on the cache disk that failed all their write back attempts",
+		Type:      gaugeMetric,
+	}
+}
+
+func getCacheWriteBackOldestPendingMD() MetricDescription {
+	return MetricDescription{
+		Namespace: minioNamespace,
+		Subsystem: cacheSubsystem,
+		Name:      writeBackOldestPending,
+		Help:      "Age in seconds of the oldest object on the cache disk waiting to be committed to the backend",
+		Type:      gaugeMetric,
+	}
+}
+
 func getHealObjectsTotalMD() MetricDescription {
 	return MetricDescription{
 		Namespace: healMetricNamespace,
@@ -1361,6 +1398,106 @@ func getCacheMetrics() *MetricsGroup {
 				Value:          float64(cdStats.TotalCapacity),
 				VariableLabels: map[string]string{"disk": cdStats.Dir},
 			})
+			if cdStats.WriteBack {
+				var oldest float64
+				if !cdStats.WriteBackOldest.IsZero() {
+					oldest = time.Since(cdStats.WriteBackOldest).Seconds()
+				}
+				metrics = append(metrics, Metric{
+					Description:    getCacheWriteBackPendingMD(),
+					Value:          float64(cdStats.WriteBackPending),
+					VariableLabels: map[string]string{"disk": cdStats.Dir},
+				})
+				metrics = append(metrics, Metric{
+					Description:    getCacheWriteBackFailedMD(),
+					Value:          float64(cdStats.WriteBackFailed),
+					VariableLabels: map[string]string{"disk": cdStats.Dir},
+				})
+				metrics = append(metrics, Metric{
+					Description:    getCacheWriteBackOldestPendingMD(),
+					Value:          oldest,
+					VariableLabels: map[string]string{"disk": cdStats.Dir},
+				})
+			}
+		}
+		return
+	})
+	return mg
+}
+
+// getGatewayBackendMetrics exports the traffic of the gateway to its backend
+// and the metrics of gateways implementing GatewayMetrics.
+func getGatewayBackendMetrics() *MetricsGroup {
+	mg := &MetricsGroup{
+		cacheInterval: 10 * time.Second,
+	}
+	mg.RegisterRead(func(ctx context.Context) (metrics []Metric) {
+		objLayer := newObjectLayerFn()
+		// Service not initialized yet
+		if !globalIsGateway || objLayer == nil {
+			return
+		}
+		subsystem := MetricSubsystem(globalGatewayName)
+		if m, err := objLayer.GetMetrics(ctx); err == nil {
+			metrics = append(metrics, Metric{
+				Description: MetricDescription{
+					Namespace: gatewayMetricNamespace,
+					Subsystem: subsystem,
+					Name:      "bytes_received",
+					Help:      "Total number of bytes received from the gateway backend",
+					Type:      counterMetric,
+				},
+				Value: float64(m.GetBytesReceived()),
+			}, Metric{
+				Description: MetricDescription{
+					Namespace: gatewayMetricNamespace,
+					Subsystem: subsystem,
+					Name:      "bytes_sent",
+					Help:      "Total number of bytes sent to the gateway backend",
+					Type:      counterMetric,
+				},
+				Value: float64(m.GetBytesSent()),
+			})
+			reqs := m.GetRequests()
+			for method, n := range map[string]uint64{
+				http.MethodGet:  atomic.LoadUint64(&reqs.Get),
+				http.MethodHead: atomic.LoadUint64(&reqs.Head),
+				http.MethodPut:  atomic.LoadUint64(&reqs.Put),
+				http.MethodPost: atomic.LoadUint64(&reqs.Post),
+			} {
+				metrics = append(metrics, Metric{
+					Description: MetricDescription{
+						Namespace: gatewayMetricNamespace,
+						Subsystem: subsystem,
+						Name:      "requests",
+						Help:      "Total number of requests made to the gateway backend",
+						Type:      counterMetric,
+					},
+					Value:          float64(n),
+					VariableLabels: map[string]string{"method": method},
+				})
+			}
+		}
+		gm, ok := unwrapGatewayLayer(objLayer).(GatewayMetrics)
+		if !ok {
+			return
+		}
+		for _, m := range gm.GatewayMetrics(ctx) {
+			typ := MetricType(gaugeMetric)
+			if m.Counter {
+				typ = counterMetric
+			}
+			metrics = append(metrics, Metric{
+				Description: MetricDescription{
+					Namespace: gatewayMetricNamespace,
+					Subsystem: subsystem,
+					Name:      MetricName(m.Name),
+					Help:      m.Help,
+					Type:      typ,
+				},
+				Value:          m.Value,
+				VariableLabels: m.Labels,
+			})
 		}
 		return
 	})
@@ -607,6 +607,15 @@ func (e InvalidPart) Error() string {
 		e.PartNumber, e.ExpETag, e.GotETag)
 }
 
+// InvalidPartOrder - error if the parts of a complete multipart request are not in ascending order.
+type InvalidPartOrder struct {
+	PartNumber int
+}
+
+func (e InvalidPartOrder) Error() string {
+	return fmt.Sprintf("The list of parts was not in ascending order. PartNumber %d", e.PartNumber)
+}
+
 // PartTooSmall - error if part size is less than 5MB.
 type PartTooSmall struct {
 	PartSize   int64
@@ -698,3 +707,13 @@ func isErrMethodNotAllowed(err error) bool {
 	var methodNotAllowed MethodNotAllowed
 	return errors.As(err, &methodNotAllowed)
 }
+
+// putMultipleObjectsNotImplemented fails every object of a PutMultipleObjects
+// call with NotImplemented.
+func putMultipleObjectsNotImplemented(objects []string) ([]ObjectInfo, []error) {
+	errs := make([]error, len(objects))
+	for i := range errs {
+		errs[i] = NotImplemented{}
+	}
+	return make([]ObjectInfo, len(objects)), errs
+}
@@ -329,6 +329,8 @@ func (api objectAPIHandlers) getObjectHandler(ctx context.Context, objectAPI Obj
 		return
 	}
 
+	r = withExistingObjectTags(ctx, objectAPI, r, bucket, object, opts)
+
 	// Check for auth type to return S3 compatible error.
 	// type to return the correct error (NoSuchKey vs AccessDenied)
 	if s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, bucket, object); s3Error != ErrNone {
@@ -603,6 +605,8 @@ func (api objectAPIHandlers) headObjectHandler(ctx context.Context, objectAPI Ob
 		return
 	}
 
+	r = withExistingObjectTags(ctx, objectAPI, r, bucket, object, opts)
+
 	if s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, bucket, object); s3Error != ErrNone {
 		if getRequestAuthType(r) == authTypeAnonymous {
 			// As per "Permission" section in
@@ -1876,7 +1880,8 @@ func (api objectAPIHandlers) PutObjectHandler(w http.ResponseWriter, r *http.Req
 // allowed or not. If not allowed on one file, it tries to upload the other files.
 // ----------
 // This implementation of the PUT operation adds multiple objects to a bucket.
-
+// The response lists the objects uploaded and the error of each object which
+// was not, in XML or in JSON when the client accepts application/json.
 func (api objectAPIHandlers) PutMultipleObjectsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := newContext(r, w, "PutMultipleObjects")
 	defer logger.AuditLog(ctx, w, r, mustGetClaimsFromToken(r))
@@ -1926,59 +1931,127 @@ func (api objectAPIHandlers) PutMultipleObjectsHandler(w http.ResponseWriter, r
 		http.Error(w, e.Error(), http.StatusBadRequest)
 		return
 	}
+
+	// get the files from the request, in the order of their keys
+	files := r.MultipartForm.File
+	keys := make([]string, 0, len(files))
+	for objectKey := range files {
+		keys = append(keys, objectKey)
+	}
+	sort.Strings(keys)
+
+	// objects and errs hold every file of the request, the files which
+	// cannot be uploaded are reported with their error.
+	var objects []string
+	var errs []error
 	var objectKeys []string
 	var pReaders []*PutObjReader
 	var opts []ObjectOptions
-
-	// get the files from the request
-	files := r.MultipartForm.File
-	for objectKey, fileHeaders := range files {
-		// check if put is allowed
-		if s3Err := isPutActionAllowed(ctx, rAuthType, bucket, objectKey, r, iampolicy.PutObjectAction); s3Err != ErrNone {
+	var indexes []int
+	for _, objectKey := range keys {
+		// check if put is allowed, the objects which are denied are
+		// reported while the others are uploaded.
+		s3Err := isPutActionAllowed(ctx, rAuthType, bucket, objectKey, r, iampolicy.PutObjectAction)
+		if s3Err != ErrNone && s3Err != ErrAccessDenied {
 			writeErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL)
 			return
 		}
-		for _, fileHeader := range fileHeaders {
+		for _, fileHeader := range files[objectKey] {
+			objects = append(objects, objectKey)
+			if s3Err == ErrAccessDenied {
+				errs = append(errs, PrefixAccessDenied{Bucket: bucket, Object: objectKey})
+				continue
+			}
 			file, err := fileHeader.Open()
 			if err != nil {
-				writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
-				return
+				errs = append(errs, err)
+				continue
 			}
 			defer file.Close()
-
-			var reader io.Reader = file
-			size := fileHeader.Size
-			actualSize := size
-			hashReader, err := hash.NewReader(reader, size, "", "", actualSize)
+			pReader, putOptions, err := newMultiPutObjReader(ctx, r, bucket, objectKey, file, fileHeader.Size, metadata)
 			if err != nil {
-				writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
-				return
-			}
-
-			rawReader := hashReader
-			pReader := NewPutObjReader(rawReader)
-
-			putOptions, err := putOpts(ctx, r, bucket, objectKey, metadata)
-			if err != nil {
-				writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
-				return
+				errs = append(errs, err)
+				continue
 			}
+			errs = append(errs, nil)
 
 			// append these values in the last to upload only non-errored objects
+			indexes = append(indexes, len(objects)-1)
 			objectKeys = append(objectKeys, objectKey)
 			opts = append(opts, putOptions)
 			pReaders = append(pReaders, pReader)
 		}
 	}
-
-	_, err = objectAPI.PutMultipleObjects(ctx, bucket, objectKeys, pReaders, opts)
-	if err != nil {
-		logger.LogIf(ctx, fmt.Errorf("error during put multi objects"), logger.Application)
-		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
+	if len(objects) == 0 {
+		writeErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrIncompleteBody), r.URL)
 		return
 	}
 
-	writeSuccessResponseHeadersOnly(w)
+	objInfos := make([]ObjectInfo, len(objects))
+	if len(objectKeys) > 0 {
+		uploaded, putErrs := objectAPI.PutMultipleObjects(ctx, bucket, objectKeys, pReaders, opts)
+		for i, idx := range indexes {
+			objInfos[idx], errs[idx] = uploaded[i], putErrs[i]
+		}
+	}
+
+	ovs := make([]ObjectV, len(objects))
+	for i, object := range objects {
+		ovs[i] = ObjectV{ObjectName: object, VersionID: objInfos[i].VersionID}
+	}
+	ctx = updateReqContext(ctx, ovs...)
+
+	response := generateMultiPutResponse(ctx, objects, objInfos, errs)
+	if strings.Contains(r.Header.Get(xhttp.Accept), string(mimeJSON)) {
+		writeSuccessResponseJSON(w, encodeResponseJSON(response))
+	} else {
+		writeSuccessResponseXML(w, encodeResponse(response))
+	}
+
+	for i, object := range objects {
+		status := http.StatusText(http.StatusOK)
+		if errs[i] != nil {
+			status = toAPIError(ctx, errs[i]).Code
+			logger.LogIf(ctx, fmt.Errorf("unable to upload %s/%s in put multi objects: %w", bucket, object, errs[i]), logger.Application)
+		}
+		auditLogInternal(ctx, bucket, object, AuditLogOptions{
+			Trigger:   "incoming",
+			APIName:   "PutObject",
+			Status:    status,
+			VersionID: objInfos[i].VersionID,
+		})
+		if errs[i] != nil {
+			continue
+		}
+
+		// Notify object created event.
+		objInfo := objInfos[i]
+		objInfo.Bucket = bucket
+		objInfo.Name = object
+		sendEvent(eventArgs{
+			EventName:    event.ObjectCreatedPut,
+			BucketName:   bucket,
+			Object:       objInfo,
+			ReqParams:    extractReqParams(r),
+			RespElements: extractRespElements(w),
+			UserAgent:    r.UserAgent(),
+			Host:         handlers.GetSourceIP(r),
+		})
+	}
+}
+
+// newMultiPutObjReader returns the reader and options of a file of a
+// PutMultipleObjects request.
+func newMultiPutObjReader(ctx context.Context, r *http.Request, bucket, object string, file io.Reader, size int64, metadata map[string]string) (*PutObjReader, ObjectOptions, error) {
+	hashReader, err := hash.NewReader(file, size, "", "", size)
+	if err != nil {
+		return nil, ObjectOptions{}, err
+	}
+	putOptions, err := putOpts(ctx, r, bucket, object, metadata)
+	if err != nil {
+		return nil, ObjectOptions{}, err
+	}
+	return NewPutObjReader(hashReader), putOptions, nil
 }
 
 // PutObjectExtractHandler - PUT Object extract is an extended API
@@ -2362,6 +2435,20 @@ func (api objectAPIHandlers) NewMultipartUploadHandler(w http.ResponseWriter, r
 		return
 	}
 
+	if objTags := r.Header.Get(xhttp.AmzObjectTagging); objTags != "" {
+		if !objectAPI.IsTaggingSupported() {
+			writeErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrNotImplemented), r.URL)
+			return
+		}
+
+		if _, err := tags.ParseObjectTags(objTags); err != nil {
+			writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
+			return
+		}
+
+		metadata[xhttp.AmzObjectTagging] = objTags
+	}
+
 	retPerms := isPutActionAllowed(ctx, getRequestAuthType(r), bucket, object, r, iampolicy.PutObjectRetentionAction)
 	holdPerms := isPutActionAllowed(ctx, getRequestAuthType(r), bucket, object, r, iampolicy.PutObjectLegalHoldAction)
 
@@ -2641,7 +2728,11 @@ func (api objectAPIHandlers) CopyObjectPartHandler(w http.ResponseWriter, r *htt
 	actualPartSize = length
 	var reader io.Reader = etag.NewReader(gr, nil)
 
-	mi, err := objectAPI.GetMultipartInfo(ctx, dstBucket, dstObject, uploadID, dstOpts)
+	getMultipartInfo := objectAPI.GetMultipartInfo
+	if api.CacheAPI() != nil {
+		getMultipartInfo = api.CacheAPI().GetMultipartInfo
+	}
+	mi, err := getMultipartInfo(ctx, dstBucket, dstObject, uploadID, dstOpts)
 	if err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 		return
@@ -2891,7 +2982,11 @@ func (api objectAPIHandlers) PutObjectPartHandler(w http.ResponseWriter, r *http
 		}
 	}
 
-	mi, err := objectAPI.GetMultipartInfo(ctx, bucket, object, uploadID, opts)
+	getMultipartInfo := objectAPI.GetMultipartInfo
+	if api.CacheAPI() != nil {
+		getMultipartInfo = api.CacheAPI().GetMultipartInfo
+	}
+	mi, err := getMultipartInfo(ctx, bucket, object, uploadID, opts)
 	if err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 		return
@@ -3104,8 +3199,12 @@ func (api objectAPIHandlers) ListObjectPartsHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	listObjectParts := objectAPI.ListObjectParts
+	if api.CacheAPI() != nil {
+		listObjectParts = api.CacheAPI().ListObjectParts
+	}
 	opts := ObjectOptions{}
-	listPartsInfo, err := objectAPI.ListObjectParts(ctx, bucket, object, uploadID, partNumberMarker, maxParts, opts)
+	listPartsInfo, err := listObjectParts(ctx, bucket, object, uploadID, partNumberMarker, maxParts, opts)
 	if err != nil {
 		writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 		return
@@ -3273,7 +3372,11 @@ func (api objectAPIHandlers) CompleteMultipartUploadHandler(w http.ResponseWrite
 	var objectEncryptionKey []byte
 	var isEncrypted, ssec bool
 	if objectAPI.IsEncryptionSupported() {
-		mi, err := objectAPI.GetMultipartInfo(ctx, bucket, object, uploadID, ObjectOptions{})
+		getMultipartInfo := objectAPI.GetMultipartInfo
+		if api.CacheAPI() != nil {
+			getMultipartInfo = api.CacheAPI().GetMultipartInfo
+		}
+		mi, err := getMultipartInfo(ctx, bucket, object, uploadID, ObjectOptions{})
 		if err != nil {
 			writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 			return
@@ -3296,7 +3399,11 @@ func (api objectAPIHandlers) CompleteMultipartUploadHandler(w http.ResponseWrite
 	partsMap := make(map[string]PartInfo)
 	if isEncrypted {
 		maxParts := 10000
-		listPartsInfo, err := objectAPI.ListObjectParts(ctx, bucket, object, uploadID, 0, maxParts, ObjectOptions{})
+		listObjectParts := objectAPI.ListObjectParts
+		if api.CacheAPI() != nil {
+			listObjectParts = api.CacheAPI().ListObjectParts
+		}
+		listPartsInfo, err := listObjectParts(ctx, bucket, object, uploadID, 0, maxParts, ObjectOptions{})
 		if err != nil {
 			writeErrorResponse(ctx, w, toAPIError(ctx, err), r.URL)
 			return
@@ -11,7 +11,9 @@ type ThreadSafeListTree struct {
 	mu   sync.RWMutex
 }
 
-func newThreadSafeListTree() *ThreadSafeListTree {
+// NewThreadSafeListTree returns an empty tree, its keys are iterated in
+// lexical order.
+func NewThreadSafeListTree() *ThreadSafeListTree {
 	return &ThreadSafeListTree{tree: art.New()}
 }
 
@@ -27,6 +29,20 @@ func (t *ThreadSafeListTree) Delete(key art.Key) (value art.Value, deleted bool)
 	return t.tree.Delete(key)
 }
 
+// Search returns the value of key.
+func (t *ThreadSafeListTree) Search(key art.Key) (value art.Value, found bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Search(key)
+}
+
+// Size returns the number of keys in the tree.
+func (t *ThreadSafeListTree) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Size()
+}
+
 func (t *ThreadSafeListTree) ForEachPrefix(keyPrefix art.Key, callback art.Callback) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
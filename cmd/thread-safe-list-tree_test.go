@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	art "github.com/plar/go-adaptive-radix-tree"
+)
+
+func TestThreadSafeListTree(t *testing.T) {
+	tree := NewThreadSafeListTree()
+	for _, key := range []string{"b/a/y", "b/a-1", "b/a/x", "b/c", "c/a"} {
+		tree.Insert(art.Key(key), key)
+	}
+	if tree.Size() != 5 {
+		t.Fatalf("Expected 5 keys, got %d", tree.Size())
+	}
+	if v, ok := tree.Search(art.Key("b/a/x")); !ok || v.(string) != "b/a/x" {
+		t.Fatalf("Expected to find b/a/x, got %v, %v", v, ok)
+	}
+	if _, ok := tree.Search(art.Key("b/a")); ok {
+		t.Fatal("Expected b/a not to be found")
+	}
+
+	// Keys are iterated in lexical order.
+	var keys []string
+	tree.ForEachPrefix(art.Key("b/"), func(n art.Node) bool {
+		if n.Kind() == art.Leaf {
+			keys = append(keys, string(n.Key()))
+		}
+		return true
+	})
+	expected := []string{"b/a-1", "b/a/x", "b/a/y", "b/c"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+
+	tree.Delete(art.Key("b/c"))
+	if _, ok := tree.Search(art.Key("b/c")); ok {
+		t.Fatal("Expected b/c to be deleted")
+	}
+}
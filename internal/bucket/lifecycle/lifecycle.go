@@ -526,3 +526,32 @@ func (lc Lifecycle) NoncurrentVersionsExpirationLimit(obj ObjectOpts) (string, i
 	}
 	return ruleID, days, lim
 }
+
+// RemoveAbortIncompleteMultipartUpload drops the AbortIncompleteMultipartUpload
+// action of all rules, for backends which do not apply it.
+func (lc *Lifecycle) RemoveAbortIncompleteMultipartUpload() {
+	for i := range lc.Rules {
+		lc.Rules[i].AbortIncompleteMultipartUpload = AbortIncompleteMultipartUpload{}
+	}
+}
+
+// AbortIncompleteUpload returns whether the multipart upload of obj.Name,
+// initiated at obj.ModTime, should be aborted by one of the rules.
+func (lc Lifecycle) AbortIncompleteUpload(obj ObjectOpts) bool {
+	if obj.Name == "" || obj.ModTime.IsZero() {
+		return false
+	}
+	for _, rule := range lc.Rules {
+		if rule.Status == Disabled || rule.AbortIncompleteMultipartUpload.IsDaysNull() {
+			continue
+		}
+		if !strings.HasPrefix(obj.Name, rule.GetPrefix()) {
+			continue
+		}
+		days := int(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		if time.Now().UTC().After(ExpectedExpiryTime(obj.ModTime, days)) {
+			return true
+		}
+	}
+	return false
+}
@@ -704,3 +704,56 @@ func TestMaxNoncurrentBackwardCompat(t *testing.T) {
 		}
 	}
 }
+
+func TestAbortIncompleteUpload(t *testing.T) {
+	inputConfig := `<LifecycleConfiguration>
+			<Rule>
+			<Filter><Prefix>uploads/</Prefix></Filter>
+			<Status>Enabled</Status>
+			<AbortIncompleteMultipartUpload><DaysAfterInitiation>2</DaysAfterInitiation></AbortIncompleteMultipartUpload>
+			</Rule>
+			</LifecycleConfiguration>`
+	lc, err := ParseLifecycleConfig(bytes.NewReader([]byte(inputConfig)))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if err = lc.Validate(); err != nil {
+		t.Fatalf("Got unexpected validation error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		modTime  time.Time
+		expected bool
+	}{
+		{"uploads/obj", time.Now().UTC().Add(-72 * time.Hour), true},
+		{"uploads/obj", time.Now().UTC().Add(-1 * time.Hour), false},
+		{"other/obj", time.Now().UTC().Add(-72 * time.Hour), false},
+	}
+	for i, tc := range testCases {
+		if got := lc.AbortIncompleteUpload(ObjectOpts{Name: tc.name, ModTime: tc.modTime}); got != tc.expected {
+			t.Fatalf("%d: expected %v but got %v", i+1, tc.expected, got)
+		}
+	}
+
+	// A rule left without action once the action is removed is invalid.
+	lc.RemoveAbortIncompleteMultipartUpload()
+	if err = lc.Validate(); err != errXMLNotWellFormed {
+		t.Fatalf("Expected %v but got %v", errXMLNotWellFormed, err)
+	}
+
+	withTags := `<LifecycleConfiguration>
+			<Rule>
+			<Filter><Tag><Key>key</Key><Value>value</Value></Tag></Filter>
+			<Status>Enabled</Status>
+			<AbortIncompleteMultipartUpload><DaysAfterInitiation>2</DaysAfterInitiation></AbortIncompleteMultipartUpload>
+			</Rule>
+			</LifecycleConfiguration>`
+	lc, err = ParseLifecycleConfig(bytes.NewReader([]byte(withTags)))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if err = lc.Validate(); err != errAbortMultipartWithTags {
+		t.Fatalf("Expected %v but got %v", errAbortMultipartWithTags, err)
+	}
+}
@@ -85,6 +85,7 @@ const (
 	ScannerSubSys        = "scanner"
 	CrawlerSubSys        = "crawler"
 	SubnetSubSys         = "subnet"
+	ZCNSubSys            = "zcn"
 
 	// Add new constants here if you add new fields to config.
 )
@@ -135,6 +136,7 @@ var SubSystems = set.CreateStringSet(
 	NotifyRedisSubSys,
 	NotifyWebhookSubSys,
 	SubnetSubSys,
+	ZCNSubSys,
 )
 
 // SubSystemsDynamic - all sub-systems that have dynamic config.
@@ -144,6 +146,7 @@ var SubSystemsDynamic = set.CreateStringSet(
 	ScannerSubSys,
 	HealSubSys,
 	SubnetSubSys,
+	ZCNSubSys,
 )
 
 // SubSystemsSingleTargets - subsystems which only support single target.
@@ -162,6 +165,7 @@ var SubSystemsSingleTargets = set.CreateStringSet([]string{
 	IdentityTLSSubSys,
 	HealSubSys,
 	ScannerSubSys,
+	ZCNSubSys,
 }...)
 
 // Constant separators
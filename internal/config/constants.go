@@ -61,6 +61,9 @@ const (
 
 	EnvUpdate = "MINIO_UPDATE"
 
+	// Gateways sharing a backend, they lock its namespace together.
+	EnvGatewayPeers = "MINIO_GATEWAY_PEERS"
+
 	EnvKMSSecretKey     = "MINIO_KMS_SECRET_KEY"
 	EnvKMSSecretKeyFile = "MINIO_KMS_SECRET_KEY_FILE"
 	EnvKESEndpoint      = "MINIO_KMS_KES_ENDPOINT"
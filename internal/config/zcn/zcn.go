@@ -0,0 +1,223 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package zcn
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/minio/minio/internal/config"
+	"github.com/minio/pkg/env"
+)
+
+// ZCN gateway tuning environment variables
+const (
+	MaxBatchSize          = "max_batch_size"
+	BatchWaitTime         = "batch_wait_time"
+	BatchWorkers          = "batch_workers"
+	UploadWorkers         = "upload_workers"
+	DownloadWorkers       = "download_workers"
+	MaxConcurrentRequests = "max_concurrent_requests"
+	Encrypt               = "encrypt"
+	Compress              = "compress"
+
+	EnvMaxBatchSize          = "MINIO_ZCN_MAX_BATCH_SIZE"
+	EnvBatchWaitTime         = "MINIO_ZCN_BATCH_WAIT_TIME"
+	EnvBatchWorkers          = "MINIO_ZCN_BATCH_WORKERS"
+	EnvUploadWorkers         = "MINIO_ZCN_UPLOAD_WORKERS"
+	EnvDownloadWorkers       = "MINIO_ZCN_DOWNLOAD_WORKERS"
+	EnvMaxConcurrentRequests = "MINIO_ZCN_MAX_CONCURRENT_REQUESTS"
+	EnvEncrypt               = "MINIO_ZCN_ENCRYPT"
+	EnvCompress              = "MINIO_ZCN_COMPRESS"
+)
+
+// Config represents the tuning of the ZCN gateway. Zero values and nil
+// pointers are not set, the gateway keeps the value of its zs3server.json
+// for them.
+type Config struct {
+	// MaxBatchSize is the maximum number of operations committed at once.
+	MaxBatchSize int `json:"max_batch_size"`
+	// BatchWaitTime is how long operations are collected before a batch is committed.
+	BatchWaitTime time.Duration `json:"batch_wait_time"`
+	// BatchWorkers is the number of batches committed concurrently.
+	BatchWorkers int `json:"batch_workers"`
+	// UploadWorkers and DownloadWorkers are the sdk workers per transfer.
+	UploadWorkers   int `json:"upload_workers"`
+	DownloadWorkers int `json:"download_workers"`
+	// MaxConcurrentRequests is the number of requests sent to the blobbers concurrently.
+	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+	// Encrypt and Compress apply to uploads to the default allocation.
+	Encrypt  *bool `json:"encrypt"`
+	Compress *bool `json:"compress"`
+}
+
+var (
+	// DefaultKVS - default KV config for the ZCN gateway tuning, empty
+	// values keep the zs3server.json settings.
+	DefaultKVS = config.KVS{
+		config.KV{
+			Key:   MaxBatchSize,
+			Value: "",
+		},
+		config.KV{
+			Key:   BatchWaitTime,
+			Value: "",
+		},
+		config.KV{
+			Key:   BatchWorkers,
+			Value: "",
+		},
+		config.KV{
+			Key:   UploadWorkers,
+			Value: "",
+		},
+		config.KV{
+			Key:   DownloadWorkers,
+			Value: "",
+		},
+		config.KV{
+			Key:   MaxConcurrentRequests,
+			Value: "",
+		},
+		config.KV{
+			Key:   Encrypt,
+			Value: "",
+		},
+		config.KV{
+			Key:   Compress,
+			Value: "",
+		},
+	}
+
+	// Help provides help for config values
+	Help = config.HelpKVS{
+		config.HelpKV{
+			Key:         MaxBatchSize,
+			Description: `maximum number of operations committed in one batch e.g. "25"`,
+			Optional:    true,
+			Type:        "number",
+		},
+		config.HelpKV{
+			Key:         BatchWaitTime,
+			Description: `time operations are collected before a batch is committed e.g. "500ms"`,
+			Optional:    true,
+			Type:        "duration",
+		},
+		config.HelpKV{
+			Key:         BatchWorkers,
+			Description: `number of batches committed concurrently e.g. "5"`,
+			Optional:    true,
+			Type:        "number",
+		},
+		config.HelpKV{
+			Key:         UploadWorkers,
+			Description: `number of sdk workers per upload`,
+			Optional:    true,
+			Type:        "number",
+		},
+		config.HelpKV{
+			Key:         DownloadWorkers,
+			Description: `number of sdk workers per download`,
+			Optional:    true,
+			Type:        "number",
+		},
+		config.HelpKV{
+			Key:         MaxConcurrentRequests,
+			Description: `number of requests sent to the blobbers concurrently`,
+			Optional:    true,
+			Type:        "number",
+		},
+		config.HelpKV{
+			Key:         Encrypt,
+			Description: `set to "on" to encrypt uploads to the default allocation`,
+			Optional:    true,
+			Type:        "on|off",
+		},
+		config.HelpKV{
+			Key:         Compress,
+			Description: `set to "on" to compress uploads to the default allocation`,
+			Optional:    true,
+			Type:        "on|off",
+		},
+	}
+)
+
+func lookupInt(kvs config.KVS, key, envKey string) (int, error) {
+	v := env.Get(envKey, kvs.Get(key))
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, config.Errorf("invalid %s value %q: %v", key, v, err)
+	}
+	if i <= 0 {
+		return 0, config.Errorf("invalid %s value %q: must be positive", key, v)
+	}
+	return i, nil
+}
+
+func lookupBool(kvs config.KVS, key, envKey string) (*bool, error) {
+	v := env.Get(envKey, kvs.Get(key))
+	if v == "" {
+		return nil, nil
+	}
+	b, err := config.ParseBool(v)
+	if err != nil {
+		return nil, config.Errorf("invalid %s value %q: %v", key, v, err)
+	}
+	return &b, nil
+}
+
+// LookupConfig - lookup config and override with valid environment settings if any.
+func LookupConfig(kvs config.KVS) (cfg Config, err error) {
+	if err = config.CheckValidKeys(config.ZCNSubSys, kvs, DefaultKVS); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBatchSize, err = lookupInt(kvs, MaxBatchSize, EnvMaxBatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchWorkers, err = lookupInt(kvs, BatchWorkers, EnvBatchWorkers); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadWorkers, err = lookupInt(kvs, UploadWorkers, EnvUploadWorkers); err != nil {
+		return cfg, err
+	}
+	if cfg.DownloadWorkers, err = lookupInt(kvs, DownloadWorkers, EnvDownloadWorkers); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConcurrentRequests, err = lookupInt(kvs, MaxConcurrentRequests, EnvMaxConcurrentRequests); err != nil {
+		return cfg, err
+	}
+	if waitTime := env.Get(EnvBatchWaitTime, kvs.Get(BatchWaitTime)); waitTime != "" {
+		cfg.BatchWaitTime, err = time.ParseDuration(waitTime)
+		if err != nil {
+			return cfg, config.Errorf("invalid %s value %q: %v", BatchWaitTime, waitTime, err)
+		}
+		if cfg.BatchWaitTime <= 0 {
+			return cfg, config.Errorf("invalid %s value %q: must be positive", BatchWaitTime, waitTime)
+		}
+	}
+	if cfg.Encrypt, err = lookupBool(kvs, Encrypt, EnvEncrypt); err != nil {
+		return cfg, err
+	}
+	if cfg.Compress, err = lookupBool(kvs, Compress, EnvCompress); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package zcn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minio/minio/internal/config"
+)
+
+func TestLookupConfig(t *testing.T) {
+	on := true
+	testCases := []struct {
+		name     string
+		kvs      config.KVS
+		expected Config
+		success  bool
+	}{
+		{"defaults", DefaultKVS, Config{}, true},
+		{"batch", config.KVS{
+			config.KV{Key: MaxBatchSize, Value: "50"},
+			config.KV{Key: BatchWaitTime, Value: "200ms"},
+			config.KV{Key: BatchWorkers, Value: "10"},
+		}, Config{MaxBatchSize: 50, BatchWaitTime: 200 * time.Millisecond, BatchWorkers: 10}, true},
+		{"encrypt", config.KVS{config.KV{Key: Encrypt, Value: "on"}}, Config{Encrypt: &on}, true},
+		{"zero workers", config.KVS{config.KV{Key: BatchWorkers, Value: "0"}}, Config{}, false},
+		{"bad wait time", config.KVS{config.KV{Key: BatchWaitTime, Value: "500"}}, Config{}, false},
+		{"bad bool", config.KVS{config.KV{Key: Compress, Value: "maybe"}}, Config{}, false},
+		{"unknown key", config.KVS{config.KV{Key: "batch", Value: "1"}}, Config{}, false},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg, err := LookupConfig(testCase.kvs)
+			if !testCase.success {
+				if err == nil {
+					t.Error("expected failure but success instead")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected success but failed instead %s", err)
+			}
+			if cfg.MaxBatchSize != testCase.expected.MaxBatchSize ||
+				cfg.BatchWaitTime != testCase.expected.BatchWaitTime ||
+				cfg.BatchWorkers != testCase.expected.BatchWorkers ||
+				(cfg.Encrypt == nil) != (testCase.expected.Encrypt == nil) ||
+				(cfg.Encrypt != nil && *cfg.Encrypt != *testCase.expected.Encrypt) {
+				t.Errorf("expected %+v but got %+v", testCase.expected, cfg)
+			}
+		})
+	}
+}